@@ -0,0 +1,169 @@
+package wsproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+	"wsproxy/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+)
+
+const (
+	MetricsPath   = "/metrics"
+	ProfilingPath = "/debug/pprof"
+	DrainPath     = "/drain"
+	LogLevelPath  = "/log-level"
+)
+
+// newAdminHandler returns the handler of the operational endpoints, served on the admin listener.
+// Callers are authenticated and authorized by "adminAuth" (configured independently of the back-end API's).
+// The requests with a body have "requestTimeout" as deadline.
+func newAdminHandler(adminAuth *backendAuthenticator, service *backendService, health *healthChecker, payloadLog *payloadLogger, requestTimeout time.Duration, trustedProxies []string) *gin.Engine {
+	adminEngine := gin.New()
+	trustProxies(adminEngine, trustedProxies)
+	adminEngine.Use(gin.Recovery())
+	adminEngine.Use(requestLogger("admin", payloadLog))
+
+	adminEngine.GET(
+		MetricsPath,
+		requireAdmin(adminAuth.forEndpoint(MetricsEndpoint)),
+		gin.WrapH(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})),
+	)
+
+	profiling := adminEngine.Group(ProfilingPath, requireAdmin(adminAuth.forEndpoint(ProfilingEndpoint)))
+	profiling.GET("/", gin.WrapF(pprof.Index))
+	profiling.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	profiling.GET("/profile", gin.WrapF(pprof.Profile))
+	profiling.GET("/symbol", gin.WrapF(pprof.Symbol))
+	profiling.POST("/symbol", requestDeadline(requestTimeout), gin.WrapF(pprof.Symbol))
+	profiling.GET("/trace", gin.WrapF(pprof.Trace))
+	// pprof.Index serves the named profiles (heap, goroutine, etc.) by the last segment of the path
+	profiling.GET("/:profile", gin.WrapF(pprof.Index))
+
+	adminEngine.GET(
+		string(ConnectionsPath),
+		listConnectionsHandler(adminAuth.forEndpoint(GetConnectionEndpoint), service),
+	)
+	adminEngine.GET(
+		fmt.Sprintf("%s/:%s", ConnectionsPath, connIdPathParamName),
+		getConnectionHandler(adminAuth.forEndpoint(GetConnectionEndpoint), service),
+	)
+	adminEngine.DELETE(
+		fmt.Sprintf("%s/:%s", ConnectionsPath, connIdPathParamName),
+		requestDeadline(requestTimeout),
+		closeConnectionHandler(adminAuth.forEndpoint(CloseConnectionEndpoint), service),
+	)
+	adminEngine.DELETE(
+		fmt.Sprintf("%s/:%s%s", UsersPath, userIdPathParamName, ConnectionsPath),
+		requestDeadline(requestTimeout),
+		closeUserConnectionsHandler(adminAuth.forEndpoint(CloseConnectionEndpoint), service),
+	)
+
+	adminEngine.POST(DrainPath, drainHandler(adminAuth.forEndpoint(DrainEndpoint), health))
+
+	logLevel := adminEngine.Group(LogLevelPath, requireAdmin(adminAuth.forEndpoint(LogLevelEndpoint)))
+	logLevel.GET("", getLogLevelHandler())
+	logLevel.PUT("", requestDeadline(requestTimeout), setLogLevelHandler())
+	logLevel.PUT(fmt.Sprintf("%s/:%s", ConnectionsPath, connIdPathParamName), debugTargetHandler(logging.ConnectionTarget, connIdPathParamName, true))
+	logLevel.DELETE(fmt.Sprintf("%s/:%s", ConnectionsPath, connIdPathParamName), debugTargetHandler(logging.ConnectionTarget, connIdPathParamName, false))
+	logLevel.PUT(fmt.Sprintf("%s/:%s", UsersPath, userIdPathParamName), debugTargetHandler(logging.UserTarget, userIdPathParamName, true))
+	logLevel.DELETE(fmt.Sprintf("%s/:%s", UsersPath, userIdPathParamName), debugTargetHandler(logging.UserTarget, userIdPathParamName, false))
+
+	return adminEngine
+}
+
+// requireAdmin aborts the requests of callers failing authentication or authorization
+func requireAdmin(authenticate func(c *gin.Context) error) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if authErr := authenticate(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+		g.Next()
+	}
+}
+
+// drainHandler makes the proxy report itself not ready, so that load balancers stop sending it new clients ahead of
+// a shutdown. Established connections are kept.
+func drainHandler(authenticate func(c *gin.Context) error, health *healthChecker) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "drainHandler").Logger()
+
+		if authErr := authenticate(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		logger.Info().Msg("draining")
+		health.startDraining()
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// logLevelSettings is the body of the `/log-level` endpoints
+type logLevelSettings struct {
+	Level string `json:"level"`
+	// DebugConnections and DebugUsers are the connections and the users debug logging is enabled for
+	DebugConnections []string `json:"debugConnections"`
+	DebugUsers       []string `json:"debugUsers"`
+}
+
+func currentLogLevelSettings() logLevelSettings {
+	return logLevelSettings{
+		Level:            logging.Level().String(),
+		DebugConnections: logging.DebugTargets(logging.ConnectionTarget),
+		DebugUsers:       logging.DebugTargets(logging.UserTarget),
+	}
+}
+
+func getLogLevelHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.JSON(http.StatusOK, currentLogLevelSettings())
+	}
+}
+
+// setLogLevelHandler changes the log level of the instance to the one in the `{ "level": string }` request body
+func setLogLevelHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "setLogLevelHandler").Logger()
+
+		var request struct {
+			Level string `json:"level"`
+		}
+		if bindErr := g.ShouldBindJSON(&request); bindErr != nil {
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		level, parseErr := zerolog.ParseLevel(request.Level)
+		if parseErr != nil || len(request.Level) == 0 || level == zerolog.NoLevel {
+			logger.Info().Str("level", request.Level).Msg("unknown log level")
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		logger.Info().Str("level", level.String()).Msg("changing log level")
+		logging.SetLevel(level)
+		g.JSON(http.StatusOK, currentLogLevelSettings())
+	}
+}
+
+// debugTargetHandler enables (or disables) debug logging for the connection or the user in the path parameter
+func debugTargetHandler(kind logging.TargetKind, pathParamName string, enable bool) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id := g.Param(pathParamName)
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "debugTargetHandler").Str("kind", kind).Str("id", id).Logger()
+
+		if enable {
+			logger.Info().Msg("enabling debug logging")
+			logging.EnableDebug(kind, id)
+		} else {
+			logger.Info().Msg("disabling debug logging")
+			logging.DisableDebug(kind, id)
+		}
+		g.JSON(http.StatusOK, currentLogLevelSettings())
+	}
+}
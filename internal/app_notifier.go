@@ -0,0 +1,223 @@
+package wsproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"wsproxy/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+const defaultEventStream = "wsproxy:events"
+
+// awaitAppResult waits for the result of a message delivered to the application
+type awaitAppResult func() appResult
+
+// resultOf is the awaitAppResult of the messages delivered synchronously
+func resultOf(result appResult) awaitAppResult {
+	return func() appResult { return result }
+}
+
+// AppNotifier delivers the connection lifecycle events and the messages of clients to the application.
+// The clients' connection requests are relayed to the application's `GET /ws/connect` endpoint regardless of the notifier.
+type AppNotifier interface {
+	// connected is called once the client has been acknowledged the new connection
+	connected(ctx context.Context, appConn *appConnection)
+	// message delivers a message of the client and returns the function waiting for the result to report to the client.
+	// The messages of a connection reach the application in the order of the calls, whose results may be awaited later.
+	message(ctx context.Context, appConn *appConnection, correlationId string, msg string) awaitAppResult
+	// disconnected is called once the connection is lost, after all the messages received over it have been delivered
+	disconnected(ctx context.Context, appConn *appConnection)
+	// presenceChanged is called when a user comes online or goes offline (if presence events are enabled)
+	presenceChanged(ctx context.Context, userId string, online bool)
+	// close releases the resources of the notifier once the server is shut down
+	close() error
+}
+
+func newAppNotifier(ctx context.Context, conf config.Config, appUrls applicationURLs) AppNotifier {
+	if conf.RedisStreamsDelivery != nil {
+		return newRedisStreamsNotifier(conf)
+	}
+	return &httpAppNotifier{
+		appUrls:    appUrls,
+		batcher:    newMessageBatcher(ctx, conf.MessageBatching, appUrls, conf.ClientMessageDispatch.Ordering != config.UnorderedOrdering),
+		httpClient: newAppHTTPClient(),
+	}
+}
+
+// httpAppNotifier calls the application's `POST /ws/connected`, `POST /ws/message` (or `POST /ws/messages`),
+// `POST /ws/disconnected` and `POST /ws/presence` endpoints
+type httpAppNotifier struct {
+	appUrls applicationURLs
+	batcher *messageBatcher
+	// httpClient calls the endpoints not concerning a connection in particular
+	httpClient http.Client
+}
+
+// connected notifies the application only of the connections it hasn't authenticated itself
+func (n *httpAppNotifier) connected(ctx context.Context, appConn *appConnection) {
+	if appConn.notifyApp {
+		handleClientConnected(ctx, n.appUrls, appConn, *zerolog.Ctx(ctx))
+	}
+}
+
+func (n *httpAppNotifier) message(ctx context.Context, appConn *appConnection, correlationId string, msg string) awaitAppResult {
+	if n.batcher != nil {
+		return n.batcher.submit(ctx, appConn, correlationId, msg)
+	}
+	return resultOf(sendClientMessage(ctx, appConn, n.appUrls, correlationId, msg, *zerolog.Ctx(ctx)))
+}
+
+func (n *httpAppNotifier) disconnected(ctx context.Context, appConn *appConnection) {
+	handleClientDisconnected(ctx, n.appUrls, appConn, *zerolog.Ctx(ctx))
+}
+
+// presenceChanged posts `{ "userId": string, "online": bool }`
+func (n *httpAppNotifier) presenceChanged(ctx context.Context, userId string, online bool) {
+	logger := zerolog.Ctx(ctx).With().Str("method", "presenceChanged").Str("appUrl", n.appUrls.presence()).Str("userId", userId).Logger()
+
+	body, marshalErr := json.Marshal(map[string]any{"userId": userId, "online": online})
+	if marshalErr != nil {
+		logger.Error().Err(marshalErr).Msg("failed to marshal presence change")
+		return
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.appUrls.presence(), bytes.NewReader(body))
+	if err != nil {
+		logger.Error().Msgf("failed to create request object: %v", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(UserIDHeaderKey, userId)
+
+	response, requestErr := n.httpClient.Do(request)
+	if requestErr != nil {
+		logger.Error().Msgf("failed to send request: %v", requestErr)
+		return
+	}
+	defer cleanupResponse(response)
+
+	if response.StatusCode != 200 {
+		logger.Info().Msgf("Received status code %d", response.StatusCode)
+	}
+}
+
+func (n *httpAppNotifier) close() error {
+	return nil
+}
+
+type appEventType string
+
+const (
+	connectedEvent    appEventType = "connected"
+	messageEvent      appEventType = "message"
+	disconnectedEvent appEventType = "disconnected"
+	presenceEvent     appEventType = "presence"
+)
+
+// redisStreamsNotifier appends the events to a Redis stream the application consumes at its own pace (typically via
+// a consumer group). Each entry has a `type` field (`connected`, `message`, `disconnected` or `presence`), the fields
+// identifying the connection and, for messages, the `correlationId` and the `message` itself. Presence events have the
+// `userId` and `online` ("true" or "false") fields only.
+type redisStreamsNotifier struct {
+	rdb    *redis.Client
+	stream string
+	maxLen int64
+}
+
+func newRedisStreamsNotifier(conf config.Config) *redisStreamsNotifier {
+	address := conf.RedisStreamsDelivery.Address
+	if len(address) == 0 {
+		address = fmt.Sprintf("%s:%d", conf.RedisHost, conf.RedisPort)
+	}
+	stream := conf.RedisStreamsDelivery.Stream
+	if len(stream) == 0 {
+		stream = defaultEventStream
+	}
+	return &redisStreamsNotifier{
+		rdb:    redis.NewClient(&redis.Options{Addr: address}),
+		stream: stream,
+		maxLen: conf.RedisStreamsDelivery.MaxLen,
+	}
+}
+
+func (n *redisStreamsNotifier) connected(ctx context.Context, appConn *appConnection) {
+	_ = n.publish(ctx, connectedEvent, appConn, nil)
+}
+
+// message reports the message accepted (HTTP 202) to the client once it is on the stream.
+// The application is expected to push its replies, if any, via the back-end API.
+func (n *redisStreamsNotifier) message(ctx context.Context, appConn *appConnection, correlationId string, msg string) awaitAppResult {
+	fields := map[string]any{"message": msg}
+	if len(correlationId) > 0 {
+		fields["correlationId"] = correlationId
+	}
+	if publishErr := n.publish(ctx, messageEvent, appConn, fields); publishErr != nil {
+		return resultOf(appResult{errorCode: appUnreachableErrorCode, errorMessage: "failed to send message to application"})
+	}
+	return resultOf(appResult{status: http.StatusAccepted})
+}
+
+func (n *redisStreamsNotifier) disconnected(ctx context.Context, appConn *appConnection) {
+	var fields map[string]any
+	if len(appConn.disconnectReason) > 0 {
+		fields = map[string]any{"reason": appConn.disconnectReason}
+	}
+	// The connection's context may well be canceled by now
+	_ = n.publish(context.WithoutCancel(ctx), disconnectedEvent, appConn, fields)
+}
+
+func (n *redisStreamsNotifier) presenceChanged(ctx context.Context, userId string, online bool) {
+	_ = n.add(ctx, presenceEvent, map[string]any{"type": string(presenceEvent), "userId": userId, "online": strconv.FormatBool(online)})
+}
+
+func (n *redisStreamsNotifier) close() error {
+	return n.rdb.Close()
+}
+
+func (n *redisStreamsNotifier) publish(ctx context.Context, eventType appEventType, appConn *appConnection, fields map[string]any) error {
+	ctx = zerolog.Ctx(ctx).With().Str(ConnectionIDKey, string(appConn.id)).Logger().WithContext(ctx)
+
+	values := map[string]any{
+		"type":         string(eventType),
+		"connectionId": string(appConn.id),
+	}
+	if len(appConn.userId) > 0 {
+		values["userId"] = appConn.userId
+	}
+	if len(appConn.tenantId) > 0 {
+		values["tenantId"] = appConn.tenantId
+	}
+	if len(appConn.metadata) > 0 {
+		values["metadata"] = appConn.metadata
+	}
+	if len(appConn.subprotocol) > 0 {
+		values["subprotocol"] = appConn.subprotocol
+	}
+	for key, value := range fields {
+		values[key] = value
+	}
+	return n.add(ctx, eventType, values)
+}
+
+// add appends the entry to the stream
+func (n *redisStreamsNotifier) add(ctx context.Context, eventType appEventType, values map[string]any) error {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "redisStreamsNotifier").Str("event", string(eventType)).Logger()
+
+	args := &redis.XAddArgs{Stream: n.stream, Values: values}
+	if n.maxLen > 0 {
+		args.MaxLen = n.maxLen
+		args.Approx = true
+	}
+	if redisErr := n.rdb.XAdd(ctx, args).Err(); redisErr != nil {
+		countRedisError("xadd")
+		logger.Error().Err(redisErr).Msg("failed to publish event")
+		return fmt.Errorf("failed to publish %s event: %w", eventType, redisErr)
+	}
+	logger.Debug().Msg("event published")
+	return nil
+}
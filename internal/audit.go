@@ -0,0 +1,149 @@
+package wsproxy
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	auditConnect      = "connect"
+	auditAuthFailure  = "auth_failure"
+	auditDisconnect   = "disconnect"
+	auditBackendClose = "backend_close"
+	auditThrottled    = "throttled"
+
+	// authentication methods of clients
+	appAuthMethod   = "app"
+	proxyAuthMethod = "jwt"
+
+	defaultAuditMaxSizeMB = 100
+)
+
+// auditLog writes the audit trail of the connections' lifecycle as JSON lines, separately from the operational logs.
+// A nil auditLog records nothing.
+type auditLog struct {
+	logger zerolog.Logger
+	sink   io.Writer
+}
+
+// newAuditLog returns nil if "conf" is nil
+func newAuditLog(conf *config.AuditConfig) *auditLog {
+	if conf == nil {
+		return nil
+	}
+
+	var sink io.Writer = os.Stdout
+	if len(conf.File) > 0 {
+		maxSize := conf.MaxSizeMB
+		if maxSize == 0 {
+			maxSize = defaultAuditMaxSizeMB
+		}
+		sink = &lumberjack.Logger{
+			Filename:   conf.File,
+			MaxSize:    maxSize,
+			MaxBackups: conf.MaxBackups,
+			MaxAge:     conf.MaxAgeDays,
+			Compress:   conf.Compress,
+		}
+	}
+
+	return &auditLog{
+		logger: zerolog.New(sink).With().Timestamp().Logger(),
+		sink:   sink,
+	}
+}
+
+// record starts an audit record of the event. Audit records have no level: they are written regardless of the log level.
+func (a *auditLog) record(event string) *zerolog.Event {
+	return a.logger.Log().Str("event", event)
+}
+
+// connected records the establishment of a connection with the identity of the client
+func (a *auditLog) connected(appConn *appConnection, client clientInfo) {
+	if a == nil {
+		return
+	}
+	authMethod := appAuthMethod
+	if appConn.notifyApp {
+		authMethod = proxyAuthMethod
+	}
+	a.record(auditConnect).
+		Str("connectionId", string(appConn.id)).
+		Str("userId", appConn.userId).
+		Str("tenantId", appConn.tenantId).
+		Str("authMethod", authMethod).
+		Str("remoteAddress", client.remoteAddress).
+		Str("userAgent", client.userAgent).
+		Send()
+}
+
+// authFailed records the rejection of a client's connection request, by the proxy or the application
+func (a *auditLog) authFailed(authMethod string, remoteAddress string, userAgent string, statusCode int, err error) {
+	if a == nil {
+		return
+	}
+	record := a.record(auditAuthFailure).
+		Str("authMethod", authMethod).
+		Str("remoteAddress", remoteAddress).
+		Str("userAgent", userAgent).
+		Int("status", statusCode)
+	if err != nil {
+		record = record.Str("error", err.Error())
+	}
+	record.Send()
+}
+
+// throttled records the rejection of a client's connection request by the application for too many requests
+func (a *auditLog) throttled(remoteAddress string, userAgent string) {
+	if a == nil {
+		return
+	}
+	a.record(auditThrottled).
+		Str("remoteAddress", remoteAddress).
+		Str("userAgent", userAgent).
+		Send()
+}
+
+// disconnected records the end of a connection and why it ended
+func (a *auditLog) disconnected(appConn *appConnection, reason string, connectedAt time.Time) {
+	if a == nil {
+		return
+	}
+	a.record(auditDisconnect).
+		Str("connectionId", string(appConn.id)).
+		Str("userId", appConn.userId).
+		Str("tenantId", appConn.tenantId).
+		Str("reason", reason).
+		Dur("durationMs", time.Since(connectedAt)).
+		Send()
+}
+
+// backendClosed records the closing of a connection on behalf of a back-end
+func (a *auditLog) backendClosed(ctx context.Context, connId ConnectionID, request closeRequest) {
+	if a == nil {
+		return
+	}
+	a.record(auditBackendClose).
+		Str("connectionId", string(connId)).
+		Str("backend", backendIdentityOf(ctx)).
+		Int("code", int(request.code)).
+		Str("reason", request.reason).
+		Send()
+}
+
+// close closes the audit file (if any)
+func (a *auditLog) close() error {
+	if a == nil {
+		return nil
+	}
+	if file, ok := a.sink.(*lumberjack.Logger); ok {
+		return file.Close()
+	}
+	return nil
+}
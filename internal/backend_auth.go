@@ -0,0 +1,211 @@
+package wsproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"wsproxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	APIKeyHeaderKey = "X-WSGW-API-KEY"
+	// RelaySecretHeaderKey carries the secret shared by the instances of a cluster on the requests they relay to each other
+	RelaySecretHeaderKey = "X-WSGW-RELAY-SECRET"
+
+	backendIdentityContextKey = "backendIdentity"
+	relayedRequestContextKey  = "relayedRequest"
+)
+
+// BackendEndpoint identifies a back-end API endpoint in the back-end permission configuration
+type BackendEndpoint string
+
+const (
+	PushEndpoint             BackendEndpoint = "push"
+	PublishEndpoint          BackendEndpoint = "publish"
+	CloseConnectionEndpoint  BackendEndpoint = "close-connection"
+	GetConnectionEndpoint    BackendEndpoint = "get-connection"
+	ConnectionEventsEndpoint BackendEndpoint = "connection-events"
+	PresenceEndpoint         BackendEndpoint = "presence"
+	// Endpoints of the admin listener only
+	MetricsEndpoint   BackendEndpoint = "metrics"
+	ProfilingEndpoint BackendEndpoint = "pprof"
+	DrainEndpoint     BackendEndpoint = "drain"
+	LogLevelEndpoint  BackendEndpoint = "log-level"
+
+	anyBackendEndpoint = "*"
+)
+
+var (
+	errBackendUnauthenticated = errors.New("back-end not authenticated")
+	errBackendForbidden       = errors.New("back-end not authorized")
+)
+
+type backendIdentityKey struct{}
+
+// withBackendIdentity records the identity of the back-end calling the API in the context of its request
+func withBackendIdentity(ctx context.Context, identity string) context.Context {
+	if len(identity) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, backendIdentityKey{}, identity)
+}
+
+// backendIdentityOf returns the identity of the back-end (if authenticated) whose request "ctx" belongs to
+func backendIdentityOf(ctx context.Context) string {
+	identity, _ := ctx.Value(backendIdentityKey{}).(string)
+	return identity
+}
+
+type backendIdentity struct {
+	name   string
+	method string
+}
+
+type backendAuthenticator struct {
+	apiKeys     map[string]string
+	jwt         *jwtVerifier
+	jwtClaim    string
+	mtls        bool
+	permissions map[string][]string
+	// relaySecret authenticates the other instances of the cluster (none if empty)
+	relaySecret string
+}
+
+func newBackendAuthenticator(ctx context.Context, conf config.BackendAuthConfig, relaySecret string) *backendAuthenticator {
+	authenticator := &backendAuthenticator{
+		apiKeys:     conf.APIKeys,
+		mtls:        conf.MTLS,
+		permissions: conf.Permissions,
+		relaySecret: relaySecret,
+	}
+	if conf.JWT != nil {
+		authenticator.jwt = newJWTVerifier(ctx, *conf.JWT)
+		authenticator.jwtClaim = conf.JWT.IdentityClaim
+		if len(authenticator.jwtClaim) == 0 {
+			authenticator.jwtClaim = "sub"
+		}
+	}
+	return authenticator
+}
+
+func (a *backendAuthenticator) enabled() bool {
+	return len(a.apiKeys) > 0 || a.jwt != nil || a.mtls
+}
+
+// hasBackendAuthMethod tells whether the configuration sets any authentication method
+func hasBackendAuthMethod(conf config.BackendAuthConfig) bool {
+	return len(conf.APIKeys) > 0 || conf.JWT != nil || conf.MTLS
+}
+
+// forEndpoint returns the function authenticating back-ends and authorizing them to call the specified endpoint.
+// The identity of authenticated back-ends is stored in the gin context.
+func (a *backendAuthenticator) forEndpoint(endpoint BackendEndpoint) func(g *gin.Context) error {
+	return func(g *gin.Context) error {
+		identity, authErr := a.authorize(g.Request.Context(), g.Request.Header, g.Request.TLS, endpoint)
+		if len(identity) > 0 {
+			g.Set(backendIdentityContextKey, identity)
+		}
+		return authErr
+	}
+}
+
+// forPeers returns the function authenticating the other instances of the cluster by the relay secret.
+// The requests of authenticated instances are marked relayed in the gin context, so that they aren't relayed any further.
+func (a *backendAuthenticator) forPeers() func(g *gin.Context) error {
+	return func(g *gin.Context) error {
+		secret := g.GetHeader(RelaySecretHeaderKey)
+		if len(a.relaySecret) == 0 || subtle.ConstantTimeCompare([]byte(a.relaySecret), []byte(secret)) != 1 {
+			zerolog.Ctx(g.Request.Context()).Info().Str("method", "authenticatePeer").Msg("relayed request not authenticated")
+			return errBackendUnauthenticated
+		}
+		g.Set(relayedRequestContextKey, true)
+		return nil
+	}
+}
+
+// authorize authenticates the back-end by the credentials in the header (or its TLS client certificate) and checks
+// whether it may call the specified endpoint. Returns the identity of the back-end if it could be authenticated.
+func (a *backendAuthenticator) authorize(ctx context.Context, header http.Header, tlsState *tls.ConnectionState, endpoint BackendEndpoint) (string, error) {
+	if !a.enabled() {
+		return "", nil
+	}
+
+	logger := zerolog.Ctx(ctx).With().Str("method", "authenticateBackend").Str("endpoint", string(endpoint)).Logger()
+
+	identity, authnErr := a.authenticate(ctx, header, tlsState)
+	if authnErr != nil {
+		logger.Info().Err(authnErr).Msg("back-end authentication failed")
+		return "", errBackendUnauthenticated
+	}
+	logger = logger.With().Str("backendIdentity", identity.name).Str("authnMethod", identity.method).Logger()
+
+	if !a.isPermitted(identity.name, endpoint) {
+		logger.Info().Msg("back-end not permitted to call endpoint")
+		return identity.name, errBackendForbidden
+	}
+
+	logger.Debug().Msg("back-end authorized")
+	return identity.name, nil
+}
+
+func (a *backendAuthenticator) authenticate(ctx context.Context, header http.Header, tlsState *tls.ConnectionState) (*backendIdentity, error) {
+	if apiKey := header.Get(APIKeyHeaderKey); len(apiKey) > 0 && len(a.apiKeys) > 0 {
+		for key, name := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+				return &backendIdentity{name: name, method: "api-key"}, nil
+			}
+		}
+		return nil, errors.New("unknown API key")
+	}
+
+	if token, noTokenErr := bearerToken(header); noTokenErr == nil && a.jwt != nil {
+		claims, verifyErr := a.jwt.verify(ctx, token)
+		if verifyErr != nil {
+			return nil, verifyErr
+		}
+		name := claimAsString(claims, a.jwtClaim)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("identity claim %q missing from token", a.jwtClaim)
+		}
+		return &backendIdentity{name: name, method: "jwt"}, nil
+	}
+
+	if a.mtls && tlsState != nil && len(tlsState.VerifiedChains) > 0 {
+		cert := tlsState.VerifiedChains[0][0]
+		name := cert.Subject.CommonName
+		if len(name) == 0 && len(cert.DNSNames) > 0 {
+			name = cert.DNSNames[0]
+		}
+		if len(name) == 0 {
+			return nil, errors.New("client certificate has neither CN nor DNS name")
+		}
+		return &backendIdentity{name: name, method: "mtls"}, nil
+	}
+
+	return nil, errors.New("no credentials")
+}
+
+func (a *backendAuthenticator) isPermitted(identity string, endpoint BackendEndpoint) bool {
+	if a.permissions == nil {
+		return true
+	}
+	allowed := a.permissions[identity]
+	return slices.Contains(allowed, anyBackendEndpoint) || slices.Contains(allowed, string(endpoint))
+}
+
+// abortWithBackendAuthError responds with the HTTP status corresponding to the back-end authentication error
+func abortWithBackendAuthError(g *gin.Context, err error) {
+	if errors.Is(err, errBackendForbidden) {
+		g.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	g.Header("WWW-Authenticate", "Bearer")
+	g.AbortWithStatus(http.StatusUnauthorized)
+}
@@ -0,0 +1,219 @@
+package wsproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type relayedContextKey struct{}
+
+// relayedContext marks the context of a request relayed by another instance, so that it isn't relayed any further
+func relayedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, relayedContextKey{}, true)
+}
+
+func isRelayed(ctx context.Context) bool {
+	relayed, _ := ctx.Value(relayedContextKey{}).(bool)
+	return relayed
+}
+
+// backendService carries out the operations of the back-end APIs, so that the HTTP and the gRPC API behave identically
+type backendService struct {
+	ws             *wsConnections
+	clusterSupport *ClusterSupport
+	audit          *auditLog
+	// lifecycleEvents are those of the connections served by this instance unless shared by the cluster
+	lifecycleEvents *lifecycleEvents
+}
+
+func newBackendService(ws *wsConnections, clusterSupport *ClusterSupport, audit *auditLog) *backendService {
+	return &backendService{ws: ws, clusterSupport: clusterSupport, audit: audit, lifecycleEvents: ws.events}
+}
+
+// push sends the message to the connection, relaying it to the instance serving the connection if it isn't this one.
+// Returns errConnectionNotFound if no instance serves the connection.
+func (s *backendService) push(ctx context.Context, connId ConnectionID, message string) error {
+	logger := zerolog.Ctx(ctx).With().Str("method", "push").Str(ConnectionIDKey, string(connId)).Logger()
+	defer func(start time.Time) {
+		pushDurationHistogram.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	errPush := s.ws.push(ctx, message, connId)
+	if errors.Is(errPush, errConnectionNotFound) && s.clusterSupport != nil && !isRelayed(ctx) {
+		logger.Info().Msg("Connection isn't managed here, relaying payload...")
+		errPush = s.clusterSupport.relayMessage(ctx, connId, message)
+	}
+	return errPush
+}
+
+// publish delivers the message to the subscribers of the topic on every instance
+func (s *backendService) publish(ctx context.Context, topic string, message string) error {
+	logger := zerolog.Ctx(ctx).With().Str("method", "publish").Str("topic", topic).Logger()
+
+	if s.clusterSupport != nil {
+		// Every instance, this one included, delivers the message to its own subscribers
+		return s.clusterSupport.publishToTopic(ctx, topic, message)
+	}
+
+	subscriberCount := s.ws.publish(ctx, topic, message)
+	logger.Debug().Int("subscriberCount", subscriberCount).Msg("message published")
+	return nil
+}
+
+// closeConnection closes the connection, relaying the request to the instance serving the connection if it isn't this one.
+// Returns errConnectionNotFound if no instance serves the connection.
+func (s *backendService) closeConnection(ctx context.Context, connId ConnectionID, request closeRequest) error {
+	logger := zerolog.Ctx(ctx).With().Str("method", "closeConnection").Str(ConnectionIDKey, string(connId)).Logger()
+
+	errClose := s.ws.close(connId, request)
+	if errors.Is(errClose, errConnectionNotFound) && s.clusterSupport != nil && !isRelayed(ctx) {
+		logger.Info().Msg("Connection isn't managed here, relaying close request...")
+		errClose = s.clusterSupport.relayClose(ctx, connId, request)
+	}
+	// Relayed requests are audited by the instance they were made to, where the back-end is known
+	if errClose == nil && !isRelayed(ctx) {
+		s.audit.backendClosed(ctx, connId, request)
+	}
+	return errClose
+}
+
+// closeUserConnections closes the connections of the user (across all instances) and returns their number
+func (s *backendService) closeUserConnections(ctx context.Context, userId string, request closeRequest) (int, error) {
+	logger := zerolog.Ctx(ctx).With().Str("method", "closeUserConnections").Str("userId", userId).Logger()
+
+	connIds := s.ws.connectionsOfUser(userId)
+	if s.clusterSupport != nil {
+		var findErr error
+		connIds, findErr = s.clusterSupport.findConnectionsOfUser(ctx, userId)
+		if findErr != nil {
+			return 0, findErr
+		}
+	}
+
+	closedCount := 0
+	for _, connId := range connIds {
+		closeErr := s.closeConnection(ctx, connId, request)
+		if errors.Is(closeErr, errConnectionNotFound) {
+			continue // Gone in the meantime
+		}
+		if closeErr != nil {
+			logger.Error().Err(closeErr).Str(ConnectionIDKey, string(connId)).Msg("failed to close connection")
+			return closedCount, closeErr
+		}
+		closedCount++
+	}
+	return closedCount, nil
+}
+
+// connectionInfo returns the details of the connection, asking the instance serving the connection if it isn't this one.
+// Returns errConnectionNotFound if no instance serves the connection.
+func (s *backendService) connectionInfo(ctx context.Context, connId ConnectionID) (*connectionInfo, error) {
+	logger := zerolog.Ctx(ctx).With().Str("method", "connectionInfo").Str(ConnectionIDKey, string(connId)).Logger()
+
+	info, infoErr := s.ws.info(connId)
+	if !errors.Is(infoErr, errConnectionNotFound) || s.clusterSupport == nil || isRelayed(ctx) {
+		return info, infoErr
+	}
+
+	info, relayErr := s.clusterSupport.relayGetConnection(ctx, connId)
+	if relayErr == nil || errors.Is(relayErr, errConnectionNotFound) {
+		return info, relayErr
+	}
+	logger.Error().Err(relayErr).Msg("failed to get connection details from its instance")
+	// The registry still tells which instance serves the connection
+	ownerAddress, ownerErr := s.clusterSupport.findConnectionOwnersAddress(ctx, connId)
+	if ownerErr != nil {
+		return nil, ownerErr
+	}
+	return &connectionInfo{ID: connId, Node: ownerAddress}, nil
+}
+
+// connectionList is a page of the connections matching a filter
+type connectionList struct {
+	Connections []*connectionInfo `json:"connections"`
+	// Total is the number of connections matching the filter
+	Total int `json:"total"`
+}
+
+// connectionPage selects a range of connections ordered oldest first
+type connectionPage struct {
+	offset int
+	limit  int
+}
+
+func (p connectionPage) apply(infos []*connectionInfo) []*connectionInfo {
+	if p.offset >= len(infos) {
+		return []*connectionInfo{}
+	}
+	infos = infos[p.offset:]
+	if len(infos) > p.limit {
+		infos = infos[:p.limit]
+	}
+	return infos
+}
+
+// listConnections returns the page of the connections matching the filter across all instances.
+// Instances failing to respond are left out.
+func (s *backendService) listConnections(ctx context.Context, filter connectionFilter, page connectionPage) (*connectionList, error) {
+	logger := zerolog.Ctx(ctx).With().Str("method", "listConnections").Logger()
+
+	infos := s.ws.list(filter)
+	total := len(infos)
+
+	if s.clusterSupport != nil && !isRelayed(ctx) {
+		nodes, nodesErr := s.clusterSupport.findNodeAddresses(ctx)
+		if nodesErr != nil {
+			return nil, nodesErr
+		}
+		myNode := myNodeAddress()
+		// Every instance returns its connections up to the end of the page, so that the page can be cut of the lot
+		query := connectionQuery(filter, connectionPage{limit: page.offset + page.limit})
+		for _, node := range nodes {
+			if node == myNode || (len(filter.node) > 0 && node != filter.node) {
+				continue
+			}
+			list, listErr := s.clusterSupport.listConnectionsOn(ctx, node, query)
+			if listErr != nil {
+				logger.Error().Err(listErr).Str("node", node).Msg("failed to list the connections of instance")
+				continue
+			}
+			infos = append(infos, list.Connections...)
+			total += list.Total
+		}
+		sortConnectionInfos(infos)
+	}
+
+	return &connectionList{Connections: page.apply(infos), Total: total}, nil
+}
+
+// presence returns the presence of the users (across all instances), in the order of the user-ids
+func (s *backendService) presence(ctx context.Context, userIds []string) ([]userPresence, error) {
+	var counts map[string]int
+	if s.clusterSupport != nil {
+		var countErr error
+		counts, countErr = s.clusterSupport.countConnectionsOfUsers(ctx, userIds)
+		if countErr != nil {
+			return nil, countErr
+		}
+	} else {
+		counts = make(map[string]int, len(userIds))
+		for _, userId := range userIds {
+			counts[userId] = len(s.ws.connectionsOfUser(userId))
+		}
+	}
+
+	presences := make([]userPresence, len(userIds))
+	for index, userId := range userIds {
+		presences[index] = userPresence{UserID: userId, Online: counts[userId] > 0, Connections: counts[userId]}
+	}
+	return presences, nil
+}
+
+// subscribeToLifecycleEvents returns the lifecycle events of the connections served by any instance
+// and the function to call when no more events are needed
+func (s *backendService) subscribeToLifecycleEvents() (<-chan lifecycleEvent, func()) {
+	return s.lifecycleEvents.subscribe()
+}
@@ -0,0 +1,269 @@
+package wsproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultBatchMaxSize  = 100
+	defaultBatchMaxDelay = 50 * time.Millisecond
+)
+
+// batchEntry is the item of the JSON array sent to the application's `POST /ws/messages` endpoint
+type batchEntry struct {
+	ConnectionID  ConnectionID    `json:"connectionId"`
+	UserID        string          `json:"userId,omitempty"`
+	TenantID      string          `json:"tenantId,omitempty"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+	Subprotocol   string          `json:"subprotocol,omitempty"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	// Message holds the client's message if it is JSON
+	Message json.RawMessage `json:"message,omitempty"`
+	// Text holds the client's message if it isn't JSON
+	Text *string `json:"text,omitempty"`
+}
+
+func newBatchEntry(appConn *appConnection, correlationId string, msg string) batchEntry {
+	entry := batchEntry{
+		ConnectionID:  appConn.id,
+		UserID:        appConn.userId,
+		TenantID:      appConn.tenantId,
+		Subprotocol:   appConn.subprotocol,
+		CorrelationID: correlationId,
+	}
+	if len(appConn.metadata) > 0 {
+		entry.Metadata = json.RawMessage(appConn.metadata)
+	}
+	if json.Valid([]byte(msg)) {
+		entry.Message = json.RawMessage(msg)
+	} else {
+		entry.Text = &msg
+	}
+	return entry
+}
+
+// batchEntryResult is the item of the JSON array the application responds to a batch with
+type batchEntryResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchItem struct {
+	// ctx is the context of the message, whose trace the batch links to
+	ctx    context.Context
+	entry  batchEntry
+	result chan appResult
+}
+
+// messageBatcher collects the messages of all clients connected to this instance and relays them to the application
+// in batches of up to `maxSize` messages, waiting at most `maxDelay` for a batch to fill up
+type messageBatcher struct {
+	url      string
+	maxSize  int
+	maxDelay time.Duration
+	// with ordered batches, the batches holding messages of the same client are sent one after the other, so that the
+	// messages of a client reach the application in order even when spread over several batches
+	ordered    bool
+	httpClient http.Client
+	items      chan *batchItem
+}
+
+func newMessageBatcher(ctx context.Context, conf *config.MessageBatchingConfig, appUrls applicationURLs, ordered bool) *messageBatcher {
+	if conf == nil {
+		return nil
+	}
+	batcher := &messageBatcher{
+		url:        appUrls.messages(),
+		maxSize:    conf.MaxSize,
+		maxDelay:   conf.MaxDelay,
+		ordered:    ordered,
+		httpClient: newAppHTTPClient(),
+		items:      make(chan *batchItem),
+	}
+	if batcher.maxSize <= 0 {
+		batcher.maxSize = defaultBatchMaxSize
+	}
+	if batcher.maxDelay <= 0 {
+		batcher.maxDelay = defaultBatchMaxDelay
+	}
+	go batcher.run(ctx)
+	return batcher
+}
+
+// submit adds the message to the next batch and returns the function waiting for the application's result for it
+func (b *messageBatcher) submit(ctx context.Context, appConn *appConnection, correlationId string, msg string) awaitAppResult {
+	item := &batchItem{
+		ctx:    ctx,
+		entry:  newBatchEntry(appConn, correlationId, msg),
+		result: make(chan appResult, 1),
+	}
+	select {
+	case b.items <- item:
+	case <-ctx.Done():
+		return resultOf(appResult{errorCode: internalErrorCode, errorMessage: "connection closed before the message could be relayed"})
+	}
+	return func() appResult { return <-item.result }
+}
+
+func (b *messageBatcher) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "messageBatcher").Logger()
+
+	var batch []*batchItem
+	timer := time.NewTimer(b.maxDelay)
+	timer.Stop()
+
+	// With ordered batches, the messages of the connections with a batch being sent are held back until it is sent,
+	// the batches of the other connections being sent meanwhile
+	inFlight := map[ConnectionID]struct{}{}
+	var held []*batchItem
+	sent := make(chan []*batchItem)
+
+	flush := func() {
+		timer.Stop()
+		if len(batch) == 0 {
+			return
+		}
+		toSend := batch
+		batch = nil
+		if !b.ordered {
+			go b.send(logger, toSend)
+			return
+		}
+		for _, item := range toSend {
+			inFlight[item.entry.ConnectionID] = struct{}{}
+		}
+		go func() {
+			b.send(logger, toSend)
+			select {
+			case sent <- toSend:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	add := func(item *batchItem) {
+		if _, sending := inFlight[item.entry.ConnectionID]; sending {
+			held = append(held, item)
+			return
+		}
+		batch = append(batch, item)
+		if len(batch) == 1 {
+			timer.Reset(b.maxDelay)
+		}
+		if len(batch) >= b.maxSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case item := <-b.items:
+			add(item)
+		case done := <-sent:
+			for _, item := range done {
+				delete(inFlight, item.entry.ConnectionID)
+			}
+			released := held
+			held = nil
+			for _, item := range released {
+				add(item)
+			}
+		case <-timer.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			for _, item := range held {
+				item.result <- appResult{errorCode: internalErrorCode, errorMessage: "failed to relay message to application"}
+			}
+			return
+		}
+	}
+}
+
+// send relays the batch to the application and delivers the results to the submitters of the items
+func (b *messageBatcher) send(logger zerolog.Logger, batch []*batchItem) {
+	logger = logger.With().Str("method", "send").Int("batchSize", len(batch)).Logger()
+
+	// The batch continues the trace of its first message and links to those of all its messages
+	linked := make([]context.Context, len(batch))
+	for index, item := range batch {
+		linked[index] = item.ctx
+	}
+	ctx, span := startLinkedSpan(batch[0].ctx, "sendMessageBatch", trace.SpanKindClient, linked)
+	defer span.End()
+
+	results, sendErr := b.post(ctx, batch)
+	if sendErr != nil {
+		recordSpanError(span, sendErr)
+		logger.Error().Err(sendErr).Msg("failed to relay batch to application")
+	}
+	for index, item := range batch {
+		item.result <- results[index]
+	}
+}
+
+// post returns the result for each item of the batch: the same failure for all of them if the batch as a whole failed
+func (b *messageBatcher) post(ctx context.Context, batch []*batchItem) ([]appResult, error) {
+	failAll := func(result appResult, err error) ([]appResult, error) {
+		results := make([]appResult, len(batch))
+		for index := range results {
+			results[index] = result
+		}
+		return results, err
+	}
+
+	entries := make([]batchEntry, len(batch))
+	for index, item := range batch {
+		entries[index] = item.entry
+	}
+	requestBody, marshalErr := json.Marshal(entries)
+	if marshalErr != nil {
+		return failAll(appResult{errorCode: internalErrorCode, errorMessage: "failed to relay message to application"}, marshalErr)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, b.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return failAll(appResult{errorCode: internalErrorCode, errorMessage: "failed to relay message to application"}, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	injectTraceContext(ctx, request.Header)
+
+	response, requestErr := b.httpClient.Do(request)
+	if requestErr != nil {
+		return failAll(appResult{errorCode: appUnreachableErrorCode, errorMessage: "failed to send message to application"}, requestErr)
+	}
+	defer cleanupResponse(response)
+	recordStatusCode(trace.SpanFromContext(ctx), response.StatusCode)
+
+	body, readErr := readReplyBody(response)
+	if readErr != nil {
+		return failAll(appResult{errorCode: appUnreachableErrorCode, errorMessage: "failed to read application's response"}, readErr)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return failAll(appResult{status: response.StatusCode, body: body}, fmt.Errorf("received status code %d", response.StatusCode))
+	}
+
+	var entryResults []batchEntryResult
+	if unmarshalErr := json.Unmarshal(body, &entryResults); unmarshalErr != nil || len(entryResults) != len(batch) {
+		return failAll(
+			appResult{errorCode: appErrorCode, errorMessage: "invalid application response to batch"},
+			fmt.Errorf("invalid response to batch of %d messages: %v", len(batch), unmarshalErr),
+		)
+	}
+
+	results := make([]appResult, len(batch))
+	for index, entryResult := range entryResults {
+		results[index] = appResult{status: entryResult.Status, body: entryResult.Body}
+	}
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package wsproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"wsproxy/internal/config"
+)
+
+// clientIdentity holds the claims of an authenticated client which are attached to its connection
+type clientIdentity struct {
+	userId   string
+	tenantId string
+}
+
+// clientAuthenticator validates the bearer tokens of connecting clients locally, without a round-trip to the application
+type clientAuthenticator struct {
+	verifier        *jwtVerifier
+	tokenHeader     string
+	tokenQueryParam string
+	userIdClaim     string
+	tenantClaim     string
+}
+
+func newClientAuthenticator(ctx context.Context, conf *config.ClientJWTConfig) *clientAuthenticator {
+	if conf == nil {
+		return nil
+	}
+	authenticator := &clientAuthenticator{
+		verifier:        newJWTVerifier(ctx, conf.JWTConfig),
+		tokenHeader:     conf.TokenHeader,
+		tokenQueryParam: conf.TokenQueryParam,
+		userIdClaim:     conf.IdentityClaim,
+		tenantClaim:     conf.TenantClaim,
+	}
+	if len(authenticator.tokenHeader) == 0 {
+		authenticator.tokenHeader = "Authorization"
+	}
+	if len(authenticator.userIdClaim) == 0 {
+		authenticator.userIdClaim = "sub"
+	}
+	return authenticator
+}
+
+func (a *clientAuthenticator) authenticate(request *http.Request) (*clientIdentity, error) {
+	token, tokenErr := a.token(request)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+
+	claims, verifyErr := a.verifier.verify(request.Context(), token)
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+
+	identity := &clientIdentity{userId: claimAsString(claims, a.userIdClaim)}
+	if len(identity.userId) == 0 {
+		return nil, fmt.Errorf("user ID claim %q missing from token", a.userIdClaim)
+	}
+	if len(a.tenantClaim) > 0 {
+		identity.tenantId = claimAsString(claims, a.tenantClaim)
+	}
+	return identity, nil
+}
+
+func (a *clientAuthenticator) token(request *http.Request) (string, error) {
+	if len(a.tokenQueryParam) > 0 {
+		if token := request.URL.Query().Get(a.tokenQueryParam); len(token) > 0 {
+			return token, nil
+		}
+	}
+
+	if http.CanonicalHeaderKey(a.tokenHeader) == "Authorization" {
+		return bearerToken(request.Header)
+	}
+
+	token := request.Header.Get(a.tokenHeader)
+	if scheme, bearer, found := strings.Cut(token, " "); found && strings.EqualFold(scheme, "Bearer") {
+		token = bearer
+	}
+	if len(token) == 0 {
+		return "", errors.New("no token")
+	}
+	return token, nil
+}
@@ -0,0 +1,118 @@
+package wsproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	replyFrameType = "reply"
+	errorFrameType = "error"
+
+	// The application couldn't be reached
+	appUnreachableErrorCode = "app_unreachable"
+	// The application responded with a non-2xx status
+	appErrorCode = "app_error"
+	// The proxy failed to process the message
+	internalErrorCode = "internal_error"
+)
+
+// The maximum size of the application's response to a client message relayed back to the client
+const maxReplyBodySize = 1 << 20
+
+// replyFrame is the message sent to the client in response to a message it sent.
+// Messages with a correlation-id are replied to in any case, messages without one only in case of errors.
+type replyFrame struct {
+	Type          string          `json:"type"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Status        int             `json:"status,omitempty"`
+	Body          json.RawMessage `json:"body,omitempty"`
+	Error         *replyError     `json:"error,omitempty"`
+}
+
+type replyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// correlationIdOf returns the correlation-id of the client message if it is a JSON object with a string `correlationId` property
+func correlationIdOf(msg string) string {
+	if !strings.HasPrefix(strings.TrimSpace(msg), "{") {
+		return ""
+	}
+	var envelope struct {
+		CorrelationID string `json:"correlationId"`
+	}
+	if unmarshalErr := json.Unmarshal([]byte(msg), &envelope); unmarshalErr != nil {
+		return ""
+	}
+	return envelope.CorrelationID
+}
+
+// readReplyBody returns the body of the application's response as JSON: as it is if it is JSON, as a JSON string otherwise
+func readReplyBody(response *http.Response) (json.RawMessage, error) {
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxReplyBodySize))
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") && json.Valid(body) {
+		return body, nil
+	}
+	return json.Marshal(string(body))
+}
+
+// appResult is the outcome of relaying a client message to the application
+type appResult struct {
+	status int
+	body   json.RawMessage
+	// errorCode is set if the message couldn't be relayed
+	errorCode    string
+	errorMessage string
+}
+
+// frame returns the frame to send back to the client as the outcome of relaying its message (if any)
+func (result appResult) frame(correlationId string) string {
+	if len(result.errorCode) > 0 {
+		return newErrorFrame(correlationId, result.errorCode, result.errorMessage, result.status, result.body)
+	}
+	if result.status < 200 || result.status > 299 {
+		return newErrorFrame(correlationId, appErrorCode, "application failed to process message", result.status, result.body)
+	}
+	if len(correlationId) == 0 {
+		return ""
+	}
+	return newReplyFrame(correlationId, result.status, result.body)
+}
+
+func newReplyFrame(correlationId string, status int, body json.RawMessage) string {
+	return marshalFrame(replyFrame{
+		Type:          replyFrameType,
+		CorrelationID: correlationId,
+		Status:        status,
+		Body:          body,
+	})
+}
+
+func newErrorFrame(correlationId string, code string, message string, status int, body json.RawMessage) string {
+	return marshalFrame(replyFrame{
+		Type:          errorFrameType,
+		CorrelationID: correlationId,
+		Status:        status,
+		Body:          body,
+		Error:         &replyError{Code: code, Message: message},
+	})
+}
+
+func marshalFrame(frame replyFrame) string {
+	frameBytes, marshalErr := json.Marshal(frame)
+	if marshalErr != nil {
+		// Cannot happen: the frame consists of strings, numbers and valid raw JSON
+		panic(marshalErr)
+	}
+	return string(frameBytes)
+}
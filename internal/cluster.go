@@ -2,17 +2,47 @@ package wsproxy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 	"wsproxy/internal/config"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const connectionHashSetName = "connections"
+const (
+	connectionHashSetName = "connections"
+	topicChannelPrefix    = "topic:"
+	// lifecycleEventsChannel is the channel the instances share the lifecycle events of their connections over
+	lifecycleEventsChannel = "connection-events"
+	// userConnectionsKeyPrefix prefixes the keys of the sets of the connection-ids of users
+	userConnectionsKeyPrefix = "user-connections:"
+	// presenceKeyPrefix prefixes the keys marking the users reported online
+	presenceKeyPrefix = "presence:"
+)
+
+// markOfflineScript deletes the presence key of the user (KEYS[2]) if the user has no connections (KEYS[1]) left.
+// Checking and deleting atomically keeps a concurrent reconnection from being missed.
+var markOfflineScript = redis.NewScript(`
+if redis.call("SCARD", KEYS[1]) == 0 then
+	return redis.call("DEL", KEYS[2])
+end
+return 0
+`)
+
+// The maximum size of the responses to relayed requests
+const maxRelayedResponseSize = 64 << 20
 
 type KeyvalueStore struct {
 	rdb *redis.Client
@@ -27,40 +57,76 @@ func NewKeyvalueStore(host string, port int) *KeyvalueStore {
 	return &KeyvalueStore{rdb: rdb}
 }
 
-func (client *KeyvalueStore) registerConnection(ctx context.Context, connectionId ConnectionID) error {
+func (client *KeyvalueStore) registerConnection(ctx context.Context, connectionId ConnectionID, userId string) error {
 	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "registerConnection").Str(ConnectionIDKey, string(connectionId)).Logger()
 	myIpAddress, addressErr := getMyIPAddress()
 	if addressErr != nil {
 		logger.Error().Msg("Cannot register my connection ownership, I have no IP address")
 		return addressErr
 	}
-	redisError := client.rdb.HSet(ctx, connectionHashSetName, connectionId, myIpAddress)
+	_, redisError := client.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, connectionHashSetName, string(connectionId), myIpAddress)
+		if len(userId) > 0 {
+			pipe.SAdd(ctx, userConnectionsKeyPrefix+userId, string(connectionId))
+		}
+		return nil
+	})
 	if redisError != nil {
-		logger.Error().Err(redisError.Err()).Msg("error while registering connection")
-		return fmt.Errorf("connection registration error: %w", redisError.Err())
+		countRedisError("registerConnection")
+		logger.Error().Err(redisError).Msg("error while registering connection")
+		return fmt.Errorf("connection registration error: %w", redisError)
 	}
 	return nil
 }
 
-func (client *KeyvalueStore) deregisterConnection(ctx context.Context, connectionId ConnectionID) error {
+func (client *KeyvalueStore) deregisterConnection(ctx context.Context, connectionId ConnectionID, userId string) error {
 	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "deregisterConnection").Str(ConnectionIDKey, string(connectionId)).Logger()
 	logger.Debug().Send()
 
-	redisError := client.rdb.HDel(ctx, connectionHashSetName, string(connectionId))
+	_, redisError := client.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, connectionHashSetName, string(connectionId))
+		if len(userId) > 0 {
+			pipe.SRem(ctx, userConnectionsKeyPrefix+userId, string(connectionId))
+		}
+		return nil
+	})
 	if redisError != nil {
-		logger.Error().Err(redisError.Err()).Msg("error while deregistering connection")
-		return fmt.Errorf("connection deregistration error: %w", redisError.Err())
+		countRedisError("deregisterConnection")
+		logger.Error().Err(redisError).Msg("error while deregistering connection")
+		return fmt.Errorf("connection deregistration error: %w", redisError)
 	}
 	return nil
 }
 
+func (client *KeyvalueStore) findConnectionsOfUser(ctx context.Context, userId string) ([]ConnectionID, error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "findConnectionsOfUser").Str("userId", userId).Logger()
+	logger.Debug().Send()
+
+	members, redisError := client.rdb.SMembers(ctx, userConnectionsKeyPrefix+userId).Result()
+	if redisError != nil {
+		countRedisError("findConnectionsOfUser")
+		logger.Error().Err(redisError).Msg("failed to retrieve the connections of user")
+		return nil, fmt.Errorf("failed to retrieve the connections of user: %w", redisError)
+	}
+	connIds := make([]ConnectionID, len(members))
+	for index, member := range members {
+		connIds[index] = ConnectionID(member)
+	}
+	return connIds, nil
+}
+
 func (client *KeyvalueStore) findConnectionOwnersAddress(ctx context.Context, connectionId ConnectionID) (string, error) {
 	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "findConnectionOwnersAddress").Str(ConnectionIDKey, string(connectionId)).Logger()
 	logger.Debug().Send()
 
 	redisStringCmd := client.rdb.HGet(ctx, connectionHashSetName, string(connectionId))
 	err := redisStringCmd.Err()
+	if errors.Is(err, redis.Nil) {
+		logger.Debug().Msg("connection not registered")
+		return "", errConnectionNotFound
+	}
 	if err != nil {
+		countRedisError("findConnectionOwnersAddress")
 		logger.Error().Err(err).Msg("failed to retrieve connection owner's address")
 		return "", fmt.Errorf("failed to retrieve connection owner's address: %w", err)
 	}
@@ -68,68 +134,410 @@ func (client *KeyvalueStore) findConnectionOwnersAddress(ctx context.Context, co
 	return redisStringCmd.Val(), nil
 }
 
+// countConnectionsOfUsers returns the number of connections of each user
+func (client *KeyvalueStore) countConnectionsOfUsers(ctx context.Context, userIds []string) (map[string]int, error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "countConnectionsOfUsers").Logger()
+	logger.Debug().Send()
+
+	counts := make(map[string]*redis.IntCmd, len(userIds))
+	_, redisError := client.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userId := range userIds {
+			counts[userId] = pipe.SCard(ctx, userConnectionsKeyPrefix+userId)
+		}
+		return nil
+	})
+	if redisError != nil {
+		countRedisError("countConnectionsOfUsers")
+		logger.Error().Err(redisError).Msg("failed to count the connections of users")
+		return nil, fmt.Errorf("failed to count the connections of users: %w", redisError)
+	}
+	result := make(map[string]int, len(userIds))
+	for userId, count := range counts {
+		result[userId] = int(count.Val())
+	}
+	return result, nil
+}
+
+// markUserOnline returns whether the user wasn't marked online yet
+func (client *KeyvalueStore) markUserOnline(ctx context.Context, userId string) (bool, error) {
+	marked, redisError := client.rdb.SetNX(ctx, presenceKeyPrefix+userId, "1", 0).Result()
+	if redisError != nil {
+		countRedisError("markUserOnline")
+		return false, fmt.Errorf("failed to mark user online: %w", redisError)
+	}
+	return marked, nil
+}
+
+// markUserOfflineIfDisconnected returns whether the user, having no connections left, was marked online until now
+func (client *KeyvalueStore) markUserOfflineIfDisconnected(ctx context.Context, userId string) (bool, error) {
+	deleted, redisError := markOfflineScript.Run(ctx, client.rdb, []string{userConnectionsKeyPrefix + userId, presenceKeyPrefix + userId}).Int()
+	if redisError != nil {
+		countRedisError("markUserOffline")
+		return false, fmt.Errorf("failed to mark user offline: %w", redisError)
+	}
+	return deleted == 1, nil
+}
+
+// findNodeAddresses returns the addresses of the instances serving connections
+func (client *KeyvalueStore) findNodeAddresses(ctx context.Context) ([]string, error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "findNodeAddresses").Logger()
+	logger.Debug().Send()
+
+	owners, redisError := client.rdb.HVals(ctx, connectionHashSetName).Result()
+	if redisError != nil {
+		countRedisError("findNodeAddresses")
+		logger.Error().Err(redisError).Msg("failed to retrieve the addresses of connection owners")
+		return nil, fmt.Errorf("failed to retrieve the addresses of connection owners: %w", redisError)
+	}
+	slices.Sort(owners)
+	return slices.Compact(owners), nil
+}
+
+// ping checks that the Redis server is reachable
+func (client *KeyvalueStore) ping(ctx context.Context) error {
+	if redisError := client.rdb.Ping(ctx).Err(); redisError != nil {
+		countRedisError("ping")
+		return fmt.Errorf("failed to ping Redis: %w", redisError)
+	}
+	return nil
+}
+
+func (client *KeyvalueStore) publishToTopic(ctx context.Context, topic string, message string) error {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "publishToTopic").Str("topic", topic).Logger()
+	logger.Debug().Send()
+
+	redisError := client.rdb.Publish(ctx, topicChannelPrefix+topic, message).Err()
+	if redisError != nil {
+		countRedisError("publishToTopic")
+		logger.Error().Err(redisError).Msg("error while publishing to topic")
+		return fmt.Errorf("topic publishing error: %w", redisError)
+	}
+	return nil
+}
+
+// subscribeToTopics calls `deliver` with every message published to any topic until the context is done
+func (client *KeyvalueStore) subscribeToTopics(ctx context.Context, deliver func(ctx context.Context, topic string, message string)) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "subscribeToTopics").Logger()
+
+	pubsub := client.rdb.PSubscribe(ctx, topicChannelPrefix+"*")
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					logger.Info().Msg("topic subscription closed")
+					return
+				}
+				deliver(ctx, strings.TrimPrefix(message.Channel, topicChannelPrefix), message.Payload)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (client *KeyvalueStore) publishLifecycleEvent(ctx context.Context, event string) error {
+	if redisError := client.rdb.Publish(ctx, lifecycleEventsChannel, event).Err(); redisError != nil {
+		countRedisError("publishLifecycleEvent")
+		return fmt.Errorf("lifecycle event publishing error: %w", redisError)
+	}
+	return nil
+}
+
+// subscribeToLifecycleEvents calls `deliver` with every lifecycle event published by any instance until the context is
+// done
+func (client *KeyvalueStore) subscribeToLifecycleEvents(ctx context.Context, deliver func(event string)) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "subscribeToLifecycleEvents").Logger()
+
+	pubsub := client.rdb.Subscribe(ctx, lifecycleEventsChannel)
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					logger.Info().Msg("lifecycle event subscription closed")
+					return
+				}
+				deliver(message.Payload)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
 type ClusterSupport struct {
-	kvClient *KeyvalueStore
+	kvClient     *KeyvalueStore
+	payloadLog   *payloadLogger
+	relaySecret  string
+	relayTimeout time.Duration
 }
 
 func NewClusterSupport(conf config.Config) *ClusterSupport {
 	if len(conf.RedisHost) == 0 {
 		return nil
 	}
-	return &ClusterSupport{kvClient: NewKeyvalueStore(conf.RedisHost, conf.RedisPort)}
+	return &ClusterSupport{
+		kvClient:     NewKeyvalueStore(conf.RedisHost, conf.RedisPort),
+		payloadLog:   newPayloadLogger(conf),
+		relaySecret:  conf.RelaySecret,
+		relayTimeout: relayTimeout(conf.HTTPTimeouts),
+	}
+}
+
+// registerConnection records this instance as the one serving the connection (of the user if known)
+func (cluster *ClusterSupport) registerConnection(ctx context.Context, connectionId ConnectionID, userId string) error {
+	return cluster.kvClient.registerConnection(ctx, connectionId, userId)
+}
+
+func (cluster *ClusterSupport) deregisterConnection(ctx context.Context, connectionId ConnectionID, userId string) error {
+	return cluster.kvClient.deregisterConnection(ctx, connectionId, userId)
+}
+
+// findConnectionsOfUser returns the ids of the connections of the user across all instances
+func (cluster *ClusterSupport) findConnectionsOfUser(ctx context.Context, userId string) ([]ConnectionID, error) {
+	return cluster.kvClient.findConnectionsOfUser(ctx, userId)
+}
+
+// publishToTopic publishes the message to the topic's subscribers on every instance (including this one)
+func (cluster *ClusterSupport) publishToTopic(ctx context.Context, topic string, message string) error {
+	return cluster.kvClient.publishToTopic(ctx, topic, message)
+}
+
+func (cluster *ClusterSupport) subscribeToTopics(ctx context.Context, deliver func(ctx context.Context, topic string, message string)) {
+	cluster.kvClient.subscribeToTopics(ctx, deliver)
+}
+
+// shareLifecycleEvents publishes the lifecycle events of the connections served by this instance ("local") to the
+// cluster and returns the lifecycle events of the connections served by all instances
+func (cluster *ClusterSupport) shareLifecycleEvents(ctx context.Context, local *lifecycleEvents) *lifecycleEvents {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "cluster").Str("method", "shareLifecycleEvents").Logger()
+
+	shared := newLifecycleEvents()
+	cluster.kvClient.subscribeToLifecycleEvents(ctx, func(payload string) {
+		var event lifecycleEventJSON
+		if unmarshalErr := json.Unmarshal([]byte(payload), &event); unmarshalErr != nil {
+			logger.Error().Err(unmarshalErr).Msg("failed to unmarshal lifecycle event")
+			return
+		}
+		shared.publish(event.toEvent())
+	})
+
+	events, unsubscribe := local.subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case event := <-events:
+				payload, marshalErr := json.Marshal(event.toJSON())
+				if marshalErr != nil {
+					logger.Error().Err(marshalErr).Msg("failed to marshal lifecycle event")
+					continue
+				}
+				if publishErr := cluster.kvClient.publishLifecycleEvent(ctx, string(payload)); publishErr != nil {
+					logger.Error().Err(publishErr).Str(ConnectionIDKey, string(event.connectionId)).Msg("failed to share lifecycle event")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return shared
+}
+
+// findConnectionOwnersAddress returns errConnectionNotFound if no instance has registered the connection
+func (cluster *ClusterSupport) findConnectionOwnersAddress(ctx context.Context, connectionId ConnectionID) (string, error) {
+	return cluster.kvClient.findConnectionOwnersAddress(ctx, connectionId)
+}
+
+// countConnectionsOfUsers returns the number of connections of each user across all instances
+func (cluster *ClusterSupport) countConnectionsOfUsers(ctx context.Context, userIds []string) (map[string]int, error) {
+	return cluster.kvClient.countConnectionsOfUsers(ctx, userIds)
+}
+
+func (cluster *ClusterSupport) markUserOnline(ctx context.Context, userId string) (bool, error) {
+	return cluster.kvClient.markUserOnline(ctx, userId)
 }
 
-func (cluster *ClusterSupport) registerConnection(ctx context.Context, connectionId ConnectionID) error {
-	return cluster.kvClient.registerConnection(ctx, connectionId)
+func (cluster *ClusterSupport) markUserOfflineIfDisconnected(ctx context.Context, userId string) (bool, error) {
+	return cluster.kvClient.markUserOfflineIfDisconnected(ctx, userId)
 }
 
-func (cluster *ClusterSupport) deregisterConnection(ctx context.Context, connectionId ConnectionID) error {
-	return cluster.kvClient.deregisterConnection(ctx, connectionId)
+// findNodeAddresses returns the addresses of the instances serving connections
+func (cluster *ClusterSupport) findNodeAddresses(ctx context.Context) ([]string, error) {
+	return cluster.kvClient.findNodeAddresses(ctx)
 }
 
+// ping checks that the registry of the cluster is reachable
+func (cluster *ClusterSupport) ping(ctx context.Context) error {
+	return cluster.kvClient.ping(ctx)
+}
+
+// relayMessage pushes the message to the connection via the relay endpoint of the instance serving it
 func (cluster *ClusterSupport) relayMessage(ctx context.Context, connectionId ConnectionID, message string) error {
-	logger := zerolog.Ctx(ctx).With().Str("unit", "clusterSupport").Str("method", "relayMessage").Str(ConnectionIDKey, connIdPathParamName).Str("message", message).Logger()
+	relayErr := cluster.relay(ctx, connectionId, http.MethodPost, fmt.Sprintf("%s%s/%s", RelayPath, MessagePath, connectionId), "text/plain", message)
+	// The deadline of the push may be up before the one of the instance serving the connection
+	if errors.Is(relayErr, context.DeadlineExceeded) {
+		return errPushTimedOut
+	}
+	return relayErr
+}
+
+// relayClose closes the connection via the relay endpoint of the instance serving it
+func (cluster *ClusterSupport) relayClose(ctx context.Context, connectionId ConnectionID, request closeRequest) error {
+	body, marshalErr := json.Marshal(newCloseConnectionBody(request))
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal close request: %w", marshalErr)
+	}
+	return cluster.relay(ctx, connectionId, http.MethodDelete, fmt.Sprintf("%s%s/%s", RelayPath, ConnectionsPath, connectionId), "application/json", string(body))
+}
+
+// relayGetConnection returns the details of the connection from the instance serving it
+func (cluster *ClusterSupport) relayGetConnection(ctx context.Context, connectionId ConnectionID) (*connectionInfo, error) {
 	connOwnerIpAddress, errAddress := cluster.kvClient.findConnectionOwnersAddress(ctx, connectionId)
+	if errAddress != nil {
+		return nil, errAddress
+	}
+	statusCode, body, sendErr := cluster.sendToInstance(ctx, connOwnerIpAddress, http.MethodGet, fmt.Sprintf("%s%s/%s", RelayPath, ConnectionsPath, connectionId), "", "")
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, errConnectionNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("relayed request finished with unexpected HTTP status: %v", statusCode)
+	}
+	info := &connectionInfo{}
+	if unmarshalErr := json.Unmarshal(body, info); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse connection details: %w", unmarshalErr)
+	}
+	return info, nil
+}
+
+// listConnectionsOn returns the connections served by the instance at the address as selected by the query
+func (cluster *ClusterSupport) listConnectionsOn(ctx context.Context, address string, query url.Values) (*connectionList, error) {
+	statusCode, body, sendErr := cluster.sendToInstance(ctx, address, http.MethodGet, fmt.Sprintf("%s%s?%s", RelayPath, ConnectionsPath, query.Encode()), "", "")
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("relayed request finished with unexpected HTTP status: %v", statusCode)
+	}
+	list := &connectionList{}
+	if unmarshalErr := json.Unmarshal(body, list); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse connection list: %w", unmarshalErr)
+	}
+	return list, nil
+}
+
+// relay sends the request to the instance serving the connection.
+// Returns errConnectionNotFound if no instance serves the connection.
+func (cluster *ClusterSupport) relay(ctx context.Context, connectionId ConnectionID, method string, path string, contentType string, body string) error {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "clusterSupport").Str("method", "relay").Str(ConnectionIDKey, string(connectionId)).Str("path", path).Logger()
+	if loggedBody, logBody := cluster.payloadLog.payload(body); logBody {
+		logger.Debug().Str("message", loggedBody).Msg("relaying")
+	}
+	connOwnerIpAddress, errAddress := cluster.kvClient.findConnectionOwnersAddress(ctx, connectionId)
+	if errors.Is(errAddress, errConnectionNotFound) {
+		return errConnectionNotFound
+	}
 	if errAddress != nil {
 		logger.Error().Err(errAddress).Msg("failed to find connection owner's address")
 		return fmt.Errorf("cannot find connection owner's address: %w", errAddress)
 	}
-	logger = logger.With().Str("connOwnerIpAddress", connOwnerIpAddress).Logger()
+
+	statusCode, _, sendErr := cluster.sendToInstance(ctx, connOwnerIpAddress, method, path, contentType, body)
+	if sendErr != nil {
+		return sendErr
+	}
+	if statusCode == http.StatusNotFound {
+		return errConnectionNotFound
+	}
+	if statusCode == http.StatusServiceUnavailable {
+		return errPushTimedOut
+	}
+	if statusCode != http.StatusNoContent {
+		return fmt.Errorf("relayed request finished with unexpected HTTP status: %v", statusCode)
+	}
+
+	return nil
+}
+
+// sendToInstance sends the request, authenticated by the relay secret, to the instance at the address and returns the
+// status and the body of the response
+func (cluster *ClusterSupport) sendToInstance(ctx context.Context, address string, method string, path string, contentType string, body string) (int, []byte, error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "clusterSupport").Str("method", "sendToInstance").Str("instanceAddress", address).Str("path", path).Logger()
 
 	protocol := os.Getenv("MY_INSTANCE_PROTOCOL")
 	if len(protocol) == 0 {
 		errMsg := "MY_INSTANCE_PROTOCOL is not set"
 		logger.Error().Msg(errMsg)
-		return fmt.Errorf(errMsg)
+		return 0, nil, errors.New(errMsg)
 	}
 	port, portErr := getInstancePort()
 	if portErr != nil {
 		logger.Error().Err(portErr)
-		return portErr
+		return 0, nil, portErr
 	}
 
-	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s:%s/%s", protocol, connOwnerIpAddress, port, fmt.Sprintf("/message/%s", connectionId)), nil)
+	ctx, span := startSpan(
+		ctx,
+		"relay",
+		trace.SpanKindClient,
+		attribute.String("wsproxy.instance_address", address),
+		attribute.String("http.request.method", method),
+		attribute.String("url.path", path),
+	)
+	defer span.End()
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		method,
+		fmt.Sprintf("%s://%s:%s%s", protocol, address, port, path),
+		strings.NewReader(body),
+	)
 	if err != nil {
 		logger.Error().Msgf("failed to create request object: %v", err)
-		return fmt.Errorf("failed to create request object: %w", err)
+		return 0, nil, fmt.Errorf("failed to create request object: %w", err)
 	}
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	request.Header.Set(RelaySecretHeaderKey, cluster.relaySecret)
+	injectTraceContext(ctx, request.Header)
 
 	client := http.Client{
-		Timeout: time.Second * 15,
+		Timeout: cluster.relayTimeout,
 	}
 	response, requestErr := client.Do(request)
 	if requestErr != nil {
+		relaysCounter.WithLabelValues("error").Inc()
+		recordSpanError(span, requestErr)
 		logger.Error().Msgf("failed to send request: %v", requestErr)
-		return fmt.Errorf("failed to send request: %w", requestErr)
+		return 0, nil, fmt.Errorf("failed to send request: %w", requestErr)
 	}
 	defer cleanupResponse(response)
+	relaysCounter.WithLabelValues(strconv.Itoa(response.StatusCode)).Inc()
+	recordStatusCode(span, response.StatusCode)
 
 	logger.Info().Msgf("Received status code %d", response.StatusCode)
-	if response.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("sending message to client finished with unexpected HTTP status: %v", response.StatusCode)
+	responseBody, readErr := io.ReadAll(io.LimitReader(response.Body, maxRelayedResponseSize))
+	if readErr != nil {
+		logger.Error().Err(readErr).Msg("failed to read response")
+		return 0, nil, fmt.Errorf("failed to read response: %w", readErr)
 	}
+	return response.StatusCode, responseBody, nil
+}
 
-	return nil
+// myNodeAddress returns the address of this instance as registered in the cluster (empty if not known)
+func myNodeAddress() string {
+	myIpAddress, _ := getMyIPAddress()
+	return myIpAddress
 }
 
 func getMyIPAddress() (string, error) {
@@ -144,7 +552,7 @@ func getInstancePort() (string, error) {
 	port := os.Getenv("MY_INSTANCE_PORT")
 	if len(port) == 0 {
 		errMsg := "MY_INSTANCE_PORT is not set"
-		return "", fmt.Errorf(errMsg)
+		return "", errors.New(errMsg)
 	}
 	return port, nil
 }
@@ -1,12 +1,359 @@
 package config
 
+import (
+	"io"
+	"time"
+)
+
 type Config struct {
-	ServerHost          string
-	AppBaseUrl          string
-	LoadBalancerAddress string // TODO: remove this
-	ServerPort          int
-	RedisHost           string
-	RedisPort           int
+	ServerHost            string
+	AppBaseUrl            string
+	ServerPort            int
+	RedisHost             string
+	RedisPort             int
+	BackendAuthentication BackendAuthConfig
+	// RelaySecret authenticates the requests the instances of a cluster (RedisHost set) relay to each other. It must be
+	// the same on every instance and is required when clustered.
+	RelaySecret string
+	// HTTPTimeouts configures the timeouts of the HTTP listeners. No timeout applies to the web-socket connections
+	// once upgraded.
+	HTTPTimeouts HTTPTimeoutsConfig
+	// TLS, if set, makes the proxy serve its main listener (ServerPort) over TLS
+	TLS *TLSConfig
+	// PlainHTTP, if set along with TLS, makes the proxy serve plain HTTP on a port of its own too
+	PlainHTTP *PlainHTTPConfig
+	// ClientJWT, if set, makes the proxy authenticate connecting clients itself instead of relaying their requests
+	// to the application's `GET /ws/connect` endpoint. The application is then only notified of the new connections.
+	ClientJWT *ClientJWTConfig
+	// Subprotocols are the web-socket subprotocols (`Sec-WebSocket-Protocol`) the proxy supports, in order of
+	// preference. The application may choose another one of those offered by the client in its response to
+	// `GET /ws/connect`. Clients offering none of them are connected without subprotocol.
+	Subprotocols []string
+	// OriginPolicy controls the web origins browsers may connect clients from
+	OriginPolicy OriginPolicyConfig
+	// ConnectForwarding controls what the application's `GET /ws/connect` endpoint receives of the client's connection request
+	ConnectForwarding ConnectForwardingConfig
+	// ClientMessageDispatch controls how the messages of a client are relayed to the application
+	ClientMessageDispatch ClientMessageDispatchConfig
+	// MessageBatching, if set, makes the proxy relay client messages to the application's `POST /ws/messages`
+	// endpoint in batches
+	MessageBatching *MessageBatchingConfig
+	// RedisStreamsDelivery, if set, makes the proxy publish the messages of clients and the connection lifecycle events
+	// to a Redis stream instead of calling the application's HTTP endpoints. The clients' connection requests are still
+	// relayed to the application's `GET /ws/connect` endpoint (unless ClientJWT is set).
+	RedisStreamsDelivery *RedisStreamsDeliveryConfig
+	// GRPC, if set, makes the proxy expose its back-end API via gRPC too
+	GRPC *GRPCConfig
+	// Admin, if set, makes the proxy serve its operational endpoints (metrics, profiling, connection introspection,
+	// forced disconnects, draining) on a port of its own, so that they aren't exposed to clients. The connection
+	// introspection and forced disconnects are only served there.
+	Admin *AdminConfig
+	// PresenceEvents, if set, makes the proxy notify the application of users coming online (their first connection
+	// across all instances) and going offline (their last connection lost)
+	PresenceEvents *PresenceEventsConfig
+	// Tracing, if set, makes the proxy record OpenTelemetry traces of the connects, pushes, relays and application
+	// callbacks, continuing the W3C trace context (`traceparent` header) of the incoming requests
+	Tracing *TracingConfig
+	// Readiness configures the checks of the `GET /readyz` endpoint and the draining of the proxy when stopped
+	Readiness ReadinessConfig
+	// PayloadLogging, if set, makes the proxy log the payloads of messages (at debug level). They aren't logged
+	// otherwise.
+	PayloadLogging *PayloadLoggingConfig
+	// Redaction configures what is masked in the logged payloads and URLs
+	Redaction RedactionConfig
+	// ConnectionLimits caps the number of connections the instance holds, in total and by client IP and user
+	ConnectionLimits ConnectionLimitsConfig
+	// Audit, if set, makes the proxy write an audit trail of connects, authentication failures, disconnects and
+	// back-end initiated closes, separately from its logs
+	Audit *AuditConfig
+}
+
+// BackendAuthConfig configures how application back-ends calling the proxy's back-end API (e.g. `POST /message/:connectionId`)
+// are authenticated and authorized.
+// If no authentication method is configured, back-end authentication is assumed to be managed ex-machina by the environment
+// (AWS role, K8S NetworkPolicy, service-mesh, etc.) and every call is let through.
+type BackendAuthConfig struct {
+	// APIKeys maps static API keys to the identity of the back-end using it.
+	// The key is expected in the `X-WSGW-API-KEY` request header.
+	APIKeys map[string]string
+	// JWT enables the validation of bearer tokens (typically obtained via the OAuth2 client credentials flow)
+	JWT *JWTConfig
+	// MTLS enables identifying back-ends by their (verified) TLS client certificates
+	MTLS bool
+	// Permissions maps back-end identities to the back-end API endpoints they may call ("*" allows all of them).
+	// If nil, every authenticated back-end may call every endpoint.
+	Permissions map[string][]string
+}
+
+// JWTConfig holds the parameters of validating JWT bearer tokens against a JWKS
+type JWTConfig struct {
+	Issuer   string
+	JWKSURL  string
+	Audience string // the "aud" claim isn't checked if empty
+	// IdentityClaim is the claim identifying the caller. Defaults to "sub".
+	IdentityClaim string
+}
+
+// ClientJWTConfig holds the parameters of validating the bearer tokens of connecting clients.
+// The embedded JWTConfig's IdentityClaim is the claim holding the user ID.
+type ClientJWTConfig struct {
+	JWTConfig
+	// TenantClaim is the claim holding the tenant ID (if any)
+	TenantClaim string
+	// TokenHeader is the request header carrying the token. Defaults to "Authorization".
+	TokenHeader string
+	// TokenQueryParam, if set, is the query parameter carrying the token, for clients unable to set request headers.
+	// A token in the query parameter takes precedence over the one in the header.
+	TokenQueryParam string
+}
+
+// DefaultConnectHeaders are the client request headers forwarded to the application on connect if none are configured
+var DefaultConnectHeaders = []string{"Authorization", "Cookie", "User-Agent", "Accept-Language", "Origin"}
+
+// DefaultPassThroughStatusCodes are the statuses of the application's connection request rejections passed through to
+// the clients if none are configured
+var DefaultPassThroughStatusCodes = []int{401, 403, 429}
+
+// ConnectForwardingConfig holds the rules of forwarding the clients' connection requests to the application.
+// The query parameters are always forwarded; hop-by-hop and web-socket upgrade headers never are.
+type ConnectForwardingConfig struct {
+	// AllowedHeaders lists the client request headers forwarded. Defaults to DefaultConnectHeaders.
+	AllowedHeaders []string
+	// HeaderRenames maps the names of allowed client request headers to the names they are forwarded under
+	HeaderRenames map[string]string
+	// PassThroughStatusCodes lists the statuses of the application's rejections which are passed through to the client
+	// (along with their JSON body and their `Retry-After` and `WWW-Authenticate` headers). Other statuses result in
+	// HTTP 500. Defaults to DefaultPassThroughStatusCodes.
+	PassThroughStatusCodes []int
+	// TrustedProxies lists the IP addresses or CIDRs of the reverse proxies in front of the proxy. The forwarding headers
+	// (`X-Forwarded-*` and `Forwarded`) of connection requests from them are extended, those of other peers replaced by
+	// ones describing the peer's connection.
+	TrustedProxies []string
+}
+
+type MessageOrdering = string
+
+const (
+	// SequentialOrdering relays the messages of a client one after the other in the order they were received
+	SequentialOrdering MessageOrdering = "sequential"
+	// UnorderedOrdering relays the messages of a client concurrently
+	UnorderedOrdering MessageOrdering = "unordered"
+)
+
+// ClientMessageDispatchConfig configures the relaying of client messages to the application
+type ClientMessageDispatchConfig struct {
+	// Ordering defaults to SequentialOrdering
+	Ordering MessageOrdering
+	// Concurrency is the maximum number of messages per connection relayed at the same time with UnorderedOrdering.
+	// Defaults to 8.
+	Concurrency int
+}
+
+// MessageBatchingConfig configures the batching of client messages (across all connections of an instance)
+type MessageBatchingConfig struct {
+	// MaxSize is the maximum number of messages in a batch. Defaults to 100.
+	MaxSize int
+	// MaxDelay is the maximum time a message waits for its batch to fill up. Defaults to 50ms.
+	MaxDelay time.Duration
+}
+
+// RedisStreamsDeliveryConfig configures the publishing of client messages and connection lifecycle events to a Redis stream
+type RedisStreamsDeliveryConfig struct {
+	// Address is the "host:port" of the Redis server. Defaults to RedisHost:RedisPort.
+	Address string
+	// Stream is the key of the stream. Defaults to "wsproxy:events".
+	Stream string
+	// MaxLen, if positive, caps the length of the stream (approximately) by trimming the oldest events
+	MaxLen int64
+}
+
+// GRPCConfig configures the gRPC listener of the back-end API
+type GRPCConfig struct {
+	// Port is the port listened on at ServerHost. An ephemeral port is picked if zero.
+	Port int
+	// TLS, if set, makes the gRPC listener serve TLS. Its verified client certificates identify the back-ends when
+	// BackendAuthentication.MTLS is set.
+	TLS *TLSConfig
+}
+
+// AdminConfig configures the admin listener
+type AdminConfig struct {
+	// Port is the port listened on at ServerHost. An ephemeral port is picked if zero.
+	Port int
+	// Authentication configures how the callers of the admin endpoints are authenticated and authorized, independently
+	// of the back-end API. At least one authentication method is required. The permissions name the admin endpoints as
+	// "metrics", "pprof", "get-connection", "close-connection", "drain" and "log-level". Authenticates the calls to the
+	// admin service of the gRPC listener (if configured) too.
+	Authentication BackendAuthConfig
+	// TLS, if set, makes the proxy serve the admin listener over TLS
+	TLS *TLSConfig
+}
+
+// HTTPTimeoutsConfig configures the timeouts of the HTTP requests served
+type HTTPTimeoutsConfig struct {
+	// ReadHeaderTimeout is the time allowed to read the headers of a request, web-socket upgrade requests included.
+	// Defaults to 10 seconds.
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections are kept open waiting for the next request. Defaults to 2 minutes.
+	IdleTimeout time.Duration
+	// PushTimeout is the deadline of the `POST /message/:connectionId` requests, waiting for room in the queue of
+	// a slow connection (or for its rate limit) included. Requests exceeding it are responded with 503 Service
+	// Unavailable. Defaults to 30 seconds. Bounds the gRPC `Push` calls too.
+	PushTimeout time.Duration
+	// RequestTimeout is the deadline of the other requests with a body (e.g. `POST /topic/:topic`,
+	// `DELETE /connections/:connectionId`), reading the body and processing the request included. Defaults to 30 seconds. Bounds their gRPC counterparts too.
+	RequestTimeout time.Duration
+}
+
+// TLSConfig configures the TLS termination of a listener
+type TLSConfig struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate (chain) and private key of the listener.
+	// They are reloaded when the files change.
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how often the certificate files are checked for changes (upon TLS handshakes). Defaults to
+	// 1 minute.
+	ReloadInterval time.Duration
+	// ClientCAFile, if set, is the path of the PEM encoded certificates of the CAs the client certificates are
+	// verified against. Clients may connect without certificates unless RequireClientCert is set.
+	ClientCAFile string
+	// RequireClientCert makes clients without a certificate verified against ClientCAFile fail the TLS handshake
+	RequireClientCert bool
+	// MinVersion is the minimum TLS version accepted: "1.0", "1.1", "1.2" or "1.3". Defaults to "1.2".
+	MinVersion string
+	// CipherSuites are the names of the cipher suites enabled for TLS versions up to 1.2 (see `tls.CipherSuites`),
+	// e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". Go's defaults are used if empty.
+	CipherSuites []string
+}
+
+// PlainHTTPConfig configures the plain HTTP listener served alongside the TLS one
+type PlainHTTPConfig struct {
+	// Port is the port listened on at ServerHost. An ephemeral port is picked if zero.
+	Port int
+}
+
+// PresenceEventsConfig configures the notification of presence changes
+type PresenceEventsConfig struct {
+	// Debounce is how long a user has to stay without connections to be reported offline, so that quick reconnects
+	// don't make the user's presence flap. Defaults to 5s.
+	Debounce time.Duration
+}
+
+type TracingExporter = string
+
+const (
+	// OTLPTracingExporter exports spans to an OpenTelemetry collector via OTLP/HTTP
+	OTLPTracingExporter TracingExporter = "otlp"
+	// StdoutTracingExporter writes spans as JSON, for local testing
+	StdoutTracingExporter TracingExporter = "stdout"
+)
+
+// TracingConfig configures the recording and the export of traces
+type TracingConfig struct {
+	// Exporter defaults to OTLPTracingExporter
+	Exporter TracingExporter
+	// OTLPEndpoint is the "host:port" of the collector. Defaults to the standard OTEL_EXPORTER_OTLP_* environment
+	// variables (or "localhost:4318").
+	OTLPEndpoint string
+	// OTLPInsecure makes the exporter talk plain HTTP to the collector
+	OTLPInsecure bool
+	// StdoutWriter is where StdoutTracingExporter writes to. Defaults to os.Stdout.
+	StdoutWriter io.Writer
+	// ServiceName defaults to "wsproxy"
+	ServiceName string
+	// SampleRatio is the ratio of the traces started by the proxy that are sampled. Traces continued from a
+	// `traceparent` header follow the caller's sampling decision. Defaults to 1 (all traces).
+	SampleRatio float64
+}
+
+// ReadinessConfig configures the readiness of the proxy. The registry of the cluster (Redis) is always checked if
+// configured.
+type ReadinessConfig struct {
+	// CheckApp makes the readiness depend on the application responding at AppBaseUrl (with any status below 500)
+	CheckApp bool
+	// CheckTimeout is how long each check may take. Defaults to 2s.
+	CheckTimeout time.Duration
+	// DrainDelay is how long the proxy keeps serving once asked to stop while reporting itself not ready, so that
+	// load balancers stop sending it new clients first
+	DrainDelay time.Duration
+}
+
+type PayloadLogMode = string
+
+const (
+	// TruncatePayloads logs (the redacted) payloads up to PayloadLoggingConfig.MaxLength bytes
+	TruncatePayloads PayloadLogMode = "truncate"
+	// HashPayloads logs the SHA-256 hashes of the payloads only, so that identical payloads can be told apart
+	HashPayloads PayloadLogMode = "hash"
+)
+
+// PayloadLoggingConfig configures how the payloads of messages are logged
+type PayloadLoggingConfig struct {
+	// Mode defaults to TruncatePayloads
+	Mode PayloadLogMode
+	// MaxLength is the number of bytes of a payload logged with TruncatePayloads. Defaults to 256.
+	MaxLength int
+}
+
+// DefaultRedactedQueryParams are the query parameters redacted from the logged URLs if none are configured
+var DefaultRedactedQueryParams = []string{"token", "access_token", "id_token", "jwt", "api_key", "apikey", "code", "password", "secret"}
+
+// RedactionConfig configures the masking of sensitive data in logs
+type RedactionConfig struct {
+	// JSONPaths are the dot-separated paths of the fields of JSON payloads whose values are masked, e.g. "password"
+	// or "card.number". A "*" segment matches any field or array element, other segments match the fields of the
+	// objects in arrays too.
+	JSONPaths []string
+	// Patterns are regular expressions whose matches are masked in the payloads and URLs
+	Patterns []string
+	// QueryParams are the (case-insensitive) names of the query parameters whose values are masked in the logged
+	// URLs. Defaults to DefaultRedactedQueryParams. The query parameter carrying the clients' tokens (see
+	// ClientJWTConfig) is always masked.
+	QueryParams []string
+}
+
+// OriginPolicyConfig configures the web origins (`Origin` header of the connection requests) clients may connect from.
+// Requests without an origin (i.e. not from browsers) and from the proxy's own host are always allowed.
+type OriginPolicyConfig struct {
+	// AllowedOrigins are the patterns of the other origins allowed. A pattern is matched case-insensitively (with the
+	// syntax of `filepath.Match`) against the host of the origin, e.g. "app.example.com" or "*.example.com", or
+	// against its scheme and host if it has a scheme, e.g. "https://*.example.com".
+	AllowedOrigins []string
+	// TenantAllowedOrigins maps tenants to the patterns of the origins allowed for their clients besides
+	// AllowedOrigins
+	TenantAllowedOrigins map[string][]string
+	// InsecureSkipVerify allows any origin. It is meant for deployments serving native clients only: it leaves
+	// browser clients open to cross-site WebSocket hijacking.
+	InsecureSkipVerify bool
+}
+
+// ConnectionLimitsConfig configures the limits on the connections held by an instance. A limit of 0 is no limit.
+// The limits on the client IP and the total are checked before the application's `GET /ws/connect` endpoint is
+// called, the limit by user once the user is known.
+type ConnectionLimitsConfig struct {
+	// MaxConnections is the number of connections the instance holds at most. Clients are rejected with
+	// 503 Service Unavailable beyond it and the instance reports itself as not ready.
+	MaxConnections int
+	// MaxConnectionsPerIP is the number of connections a client IP holds at most on the instance. Clients are
+	// rejected with 429 Too Many Requests beyond it.
+	MaxConnectionsPerIP int
+	// MaxConnectionsPerUser is the number of connections a user holds at most on the instance. Clients are
+	// rejected with 429 Too Many Requests beyond it.
+	MaxConnectionsPerUser int
+}
+
+// AuditConfig configures the sink of the audit log. Audit records are written as JSON lines.
+type AuditConfig struct {
+	// File is the path of the audit file. The records are written to stdout if it is empty.
+	File string
+	// MaxSizeMB is the size of the audit file at which it is rotated. Defaults to 100.
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files kept. All of them are kept if 0 (unless MaxAgeDays removes them).
+	MaxBackups int
+	// MaxAgeDays is the number of days rotated files are kept for. They aren't removed because of their age if 0.
+	MaxAgeDays int
+	// Compress makes the rotated files gzipped
+	Compress bool
 }
 
 func GetConfig(args []string) Config {
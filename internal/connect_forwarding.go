@@ -0,0 +1,224 @@
+package wsproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"wsproxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers which are specific to the client-proxy hop and so are never forwarded to the application
+var nonForwardableHeaders = map[string]struct{}{
+	"Connection":               {},
+	"Keep-Alive":               {},
+	"Proxy-Authenticate":       {},
+	"Proxy-Authorization":      {},
+	"Proxy-Connection":         {},
+	"Te":                       {},
+	"Trailer":                  {},
+	"Transfer-Encoding":        {},
+	"Upgrade":                  {},
+	"Content-Length":           {},
+	"Host":                     {},
+	"Sec-Websocket-Key":        {},
+	"Sec-Websocket-Version":    {},
+	"Sec-Websocket-Extensions": {},
+	"Sec-Websocket-Protocol":   {},
+	"Sec-Websocket-Accept":     {},
+}
+
+// connectForwarding builds the request relayed to the application's `GET /ws/connect` endpoint from the client's connection request
+type connectForwarding struct {
+	allowedHeaders         []string
+	renames                map[string]string
+	passThroughStatusCodes []int
+	trustedProxies         []netip.Prefix
+}
+
+// The maximum size of the application's rejection body passed through to the client
+const maxRejectionBodySize = 64 << 10
+
+// Headers of the application's rejection passed through to the client
+var passThroughRejectionHeaders = []string{"Retry-After", "WWW-Authenticate"}
+
+// validateConnectForwarding fails on the first malformed trusted proxy
+func validateConnectForwarding(conf config.ConnectForwardingConfig) error {
+	_, parseErr := parseTrustedProxies(conf.TrustedProxies)
+	return parseErr
+}
+
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, parseErr := netip.ParsePrefix(proxy)
+			if parseErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, parseErr)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		address, parseErr := netip.ParseAddr(proxy)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, parseErr)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(address.Unmap(), address.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustProxies makes the client IP of "engine" the forwarded one only for requests of the trusted proxies (validated by
+// validateConnectForwarding), the peer address otherwise
+func trustProxies(engine *gin.Engine, proxies []string) {
+	if len(proxies) == 0 {
+		proxies = nil
+	}
+	_ = engine.SetTrustedProxies(proxies)
+}
+
+// newConnectForwarding expects the trusted proxies to have been validated by validateConnectForwarding
+func newConnectForwarding(conf config.ConnectForwardingConfig) *connectForwarding {
+	allowed := conf.AllowedHeaders
+	if allowed == nil {
+		allowed = config.DefaultConnectHeaders
+	}
+
+	trustedProxies, _ := parseTrustedProxies(conf.TrustedProxies)
+	forwarding := &connectForwarding{
+		renames:                map[string]string{},
+		passThroughStatusCodes: conf.PassThroughStatusCodes,
+		trustedProxies:         trustedProxies,
+	}
+	if forwarding.passThroughStatusCodes == nil {
+		forwarding.passThroughStatusCodes = config.DefaultPassThroughStatusCodes
+	}
+	for _, name := range allowed {
+		canonicalName := http.CanonicalHeaderKey(name)
+		if _, never := nonForwardableHeaders[canonicalName]; never {
+			continue
+		}
+		forwarding.allowedHeaders = append(forwarding.allowedHeaders, canonicalName)
+	}
+	for from, to := range conf.HeaderRenames {
+		forwarding.renames[http.CanonicalHeaderKey(from)] = to
+	}
+	return forwarding
+}
+
+// url returns the URL of the application's connect endpoint with the query parameters of the client's request
+func (f *connectForwarding) url(appConnectUrl string, clientRequest *http.Request) string {
+	if len(clientRequest.URL.RawQuery) == 0 {
+		return appConnectUrl
+	}
+	return fmt.Sprintf("%s?%s", appConnectUrl, clientRequest.URL.RawQuery)
+}
+
+// header returns a new header with the allowed headers of the client's request (renamed as configured) and the
+// standard forwarding headers describing the client's request: those of trusted proxies extended, those of other
+// peers replaced
+func (f *connectForwarding) header(clientRequest *http.Request) http.Header {
+	header := http.Header{}
+
+	for _, name := range f.allowedHeaders {
+		values := clientRequest.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		forwardedName := name
+		if rename, ok := f.renames[name]; ok {
+			forwardedName = rename
+		}
+		for _, value := range values {
+			header.Add(forwardedName, value)
+		}
+	}
+
+	clientIp, _, splitErr := net.SplitHostPort(clientRequest.RemoteAddr)
+	if splitErr != nil {
+		clientIp = clientRequest.RemoteAddr
+	}
+
+	proto := "http"
+	if clientRequest.TLS != nil {
+		proto = "https"
+	}
+	host := clientRequest.Host
+	var forwardedFor, forwarded string
+
+	if f.isTrustedProxy(clientIp) {
+		if forwardedProto := clientRequest.Header.Get("X-Forwarded-Proto"); len(forwardedProto) > 0 {
+			proto = forwardedProto
+		}
+		if forwardedHost := clientRequest.Header.Get("X-Forwarded-Host"); len(forwardedHost) > 0 {
+			host = forwardedHost
+		}
+		forwardedFor = clientRequest.Header.Get("X-Forwarded-For")
+		forwarded = strings.Join(clientRequest.Header.Values("Forwarded"), ", ")
+	}
+
+	header.Set("X-Forwarded-For", appendToList(forwardedFor, clientIp))
+	header.Set("X-Forwarded-Proto", proto)
+	header.Set("X-Forwarded-Host", host)
+	header.Set("Forwarded", appendToList(
+		forwarded,
+		fmt.Sprintf("for=%s;host=%q;proto=%s", forwardedNode(clientIp), host, proto),
+	))
+
+	return header
+}
+
+func (f *connectForwarding) isTrustedProxy(ip string) bool {
+	address, parseErr := netip.ParseAddr(ip)
+	if parseErr != nil {
+		return false
+	}
+	return slices.ContainsFunc(f.trustedProxies, func(prefix netip.Prefix) bool {
+		return prefix.Contains(address.Unmap())
+	})
+}
+
+func appendToList(list string, element string) string {
+	if len(list) == 0 {
+		return element
+	}
+	return fmt.Sprintf("%s, %s", list, element)
+}
+
+// forwardedNode formats the IP address as a node of the `Forwarded` header (RFC 7239), IPv6 addresses being quoted and bracketed
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return fmt.Sprintf("\"[%s]\"", ip)
+	}
+	return ip
+}
+
+func (f *connectForwarding) passesThrough(statusCode int) bool {
+	return slices.Contains(f.passThroughStatusCodes, statusCode)
+}
+
+// abortWithRejection responds to the client with the application's rejection of the connection request
+func (f *connectForwarding) abortWithRejection(g *gin.Context, rejection *http.Response) {
+	for _, name := range passThroughRejectionHeaders {
+		if value := rejection.Header.Get(name); len(value) > 0 {
+			g.Header(name, value)
+		}
+	}
+
+	if strings.HasPrefix(rejection.Header.Get("Content-Type"), "application/json") {
+		body, readErr := io.ReadAll(io.LimitReader(rejection.Body, maxRejectionBodySize))
+		if readErr == nil && json.Valid(body) {
+			g.Data(rejection.StatusCode, "application/json", body)
+			g.Abort()
+			return
+		}
+	}
+
+	g.AbortWithStatus(rejection.StatusCode)
+}
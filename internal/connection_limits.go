@@ -0,0 +1,118 @@
+package wsproxy
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"wsproxy/internal/config"
+)
+
+// Limits of the connection limit rejections metric
+const (
+	instanceConnectionLimit = "instance"
+	ipConnectionLimit       = "ip"
+	userConnectionLimit     = "user"
+)
+
+var errConnectionLimitReached = errors.New("the instance holds the maximum number of connections")
+
+// connectionLimitError is the rejection of a connection request by a connection limit
+type connectionLimitError struct {
+	limit string
+}
+
+func (e *connectionLimitError) Error() string {
+	return "too many connections by " + e.limit
+}
+
+// statusCode is the status the connection request is rejected with: the clients are to be sent to another instance if
+// this one is saturated and to back off otherwise
+func (e *connectionLimitError) statusCode() int {
+	if e.limit == instanceConnectionLimit {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusTooManyRequests
+}
+
+// connectionLimiter caps the number of connections held by the instance, in total and by client IP and user.
+// A limit of 0 is no limit.
+type connectionLimiter struct {
+	conf    config.ConnectionLimitsConfig
+	mux     sync.Mutex
+	total   int
+	perIP   map[string]int
+	perUser map[string]int
+}
+
+func newConnectionLimiter(conf config.ConnectionLimitsConfig) *connectionLimiter {
+	return &connectionLimiter{
+		conf:    conf,
+		perIP:   map[string]int{},
+		perUser: map[string]int{},
+	}
+}
+
+// admit reserves a connection for a client at "ip", unless the instance or the IP already has as many as allowed.
+// The reservation is to be released with `release`.
+func (l *connectionLimiter) admit(ip string) *connectionLimitError {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.conf.MaxConnections > 0 && l.total >= l.conf.MaxConnections {
+		return &connectionLimitError{limit: instanceConnectionLimit}
+	}
+	if l.conf.MaxConnectionsPerIP > 0 && l.perIP[ip] >= l.conf.MaxConnectionsPerIP {
+		return &connectionLimitError{limit: ipConnectionLimit}
+	}
+	l.total++
+	l.perIP[ip]++
+	return nil
+}
+
+// admitUser counts the admitted connection against "userId" once the user is known, unless the user already has as
+// many as allowed. Anonymous connections aren't limited by user.
+func (l *connectionLimiter) admitUser(userId string) *connectionLimitError {
+	if len(userId) == 0 {
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.conf.MaxConnectionsPerUser > 0 && l.perUser[userId] >= l.conf.MaxConnectionsPerUser {
+		return &connectionLimitError{limit: userConnectionLimit}
+	}
+	l.perUser[userId]++
+	return nil
+}
+
+// release releases the connection admitted for "ip" and, if not empty, "userId"
+func (l *connectionLimiter) release(ip string, userId string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.total--
+	decrement(l.perIP, ip)
+	if len(userId) > 0 {
+		decrement(l.perUser, userId)
+	}
+}
+
+// checkCapacity fails if the instance holds the maximum number of connections
+func (l *connectionLimiter) checkCapacity() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.conf.MaxConnections > 0 && l.total >= l.conf.MaxConnections {
+		return errConnectionLimitReached
+	}
+	return nil
+}
+
+func decrement(counts map[string]int, key string) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
@@ -0,0 +1,328 @@
+package wsproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+	"wsproxy/internal/config"
+	"wsproxy/internal/grpcapi"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcEndpoints maps the methods of the gRPC service to the back-end endpoints they are authorized as
+var grpcEndpoints = map[string]BackendEndpoint{
+	grpcapi.WsproxyService_Push_FullMethodName:                      PushEndpoint,
+	grpcapi.WsproxyService_Broadcast_FullMethodName:                 PublishEndpoint,
+	grpcapi.WsproxyService_GetPresence_FullMethodName:               PresenceEndpoint,
+	grpcapi.WsproxyService_SubscribeConnectionEvents_FullMethodName: ConnectionEventsEndpoint,
+}
+
+// grpcAdminEndpoints maps the methods of the gRPC admin service to the admin endpoints they are authorized as
+var grpcAdminEndpoints = map[string]BackendEndpoint{
+	grpcapi.WsproxyAdminService_CloseConnection_FullMethodName:      CloseConnectionEndpoint,
+	grpcapi.WsproxyAdminService_CloseUserConnections_FullMethodName: CloseConnectionEndpoint,
+	grpcapi.WsproxyAdminService_GetConnection_FullMethodName:        GetConnectionEndpoint,
+	grpcapi.WsproxyAdminService_ListConnections_FullMethodName:      GetConnectionEndpoint,
+}
+
+// grpcBackendServer is the gRPC counterpart of the HTTP back-end API
+type grpcBackendServer struct {
+	grpcapi.UnimplementedWsproxyServiceServer
+	service *backendService
+	// pushTimeout and requestTimeout bound the calls as they bound their HTTP counterparts, whatever the caller's deadline
+	pushTimeout    time.Duration
+	requestTimeout time.Duration
+}
+
+// grpcAdminServer is the gRPC counterpart of the connection endpoints of the admin listener
+type grpcAdminServer struct {
+	grpcapi.UnimplementedWsproxyAdminServiceServer
+	service        *backendService
+	requestTimeout time.Duration
+}
+
+// newGRPCServer returns the gRPC server of the back-end API, serving TLS if "tlsConfig" is set.
+// The admin service is served too if "adminAuth" (authenticating the calls to it) is set.
+func newGRPCServer(backendAuth *backendAuthenticator, adminAuth *backendAuthenticator, service *backendService, tlsConfig *tls.Config, timeouts config.HTTPTimeoutsConfig) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				ctx, authErr := authorizeGRPCCall(ctx, backendAuth, adminAuth, info.FullMethod)
+				if authErr != nil {
+					return nil, authErr
+				}
+				return handler(ctx, req)
+			},
+		),
+		grpc.ChainStreamInterceptor(
+			func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				ctx, authErr := authorizeGRPCCall(stream.Context(), backendAuth, adminAuth, info.FullMethod)
+				if authErr != nil {
+					return authErr
+				}
+				return handler(srv, &contextServerStream{ServerStream: stream, ctx: ctx})
+			},
+		),
+	}
+	if tlsConfig != nil {
+		// The TLS state of the calls, client certificates included, is available to the authentication via the peer
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	grpcapi.RegisterWsproxyServiceServer(server, &grpcBackendServer{
+		service:        service,
+		pushTimeout:    pushTimeout(timeouts),
+		requestTimeout: requestTimeout(timeouts),
+	})
+	if adminAuth != nil {
+		grpcapi.RegisterWsproxyAdminServiceServer(server, &grpcAdminServer{
+			service:        service,
+			requestTimeout: requestTimeout(timeouts),
+		})
+	}
+	return server
+}
+
+// authorizeGRPCCall returns the context of the call with a logger attached if the caller may call the method.
+// The methods of the admin service are authorized by "adminAuth", the others by "backendAuth".
+func authorizeGRPCCall(ctx context.Context, backendAuth *backendAuthenticator, adminAuth *backendAuthenticator, fullMethod string) (context.Context, error) {
+	logger := logging.Get().With().
+		Str("req_xid", xid.New().String()).
+		Str("grpc_method", fullMethod).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	header := http.Header{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+	}
+	var tlsState *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			tlsState = &tlsInfo.State
+		}
+	}
+
+	authenticator, endpoint := backendAuth, grpcEndpoints[fullMethod]
+	if adminEndpoint, isAdmin := grpcAdminEndpoints[fullMethod]; isAdmin {
+		authenticator, endpoint = adminAuth, adminEndpoint
+	}
+	identity, authErr := authenticator.authorize(ctx, header, tlsState, endpoint)
+	if authErr != nil {
+		if errors.Is(authErr, errBackendForbidden) {
+			return ctx, status.Error(codes.PermissionDenied, authErr.Error())
+		}
+		return ctx, status.Error(codes.Unauthenticated, authErr.Error())
+	}
+	return withBackendIdentity(ctx, identity), nil
+}
+
+// contextServerStream overrides the context of the stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcBackendServer) Push(ctx context.Context, request *grpcapi.PushRequest) (*grpcapi.PushResponse, error) {
+	if len(request.ConnectionId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing connection id")
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.pushTimeout)
+	defer cancel()
+	if pushErr := s.service.push(ctx, ConnectionID(request.ConnectionId), request.Message); pushErr != nil {
+		zerolog.Ctx(ctx).Error().Err(pushErr).Str(ConnectionIDKey, request.ConnectionId).Msg("failed to push to connection")
+		return nil, toGRPCError(pushErr)
+	}
+	return &grpcapi.PushResponse{}, nil
+}
+
+func (s *grpcBackendServer) Broadcast(ctx context.Context, request *grpcapi.BroadcastRequest) (*grpcapi.BroadcastResponse, error) {
+	if len(request.Topic) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing topic")
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	if publishErr := s.service.publish(ctx, request.Topic, request.Message); publishErr != nil {
+		zerolog.Ctx(ctx).Error().Err(publishErr).Str("topic", request.Topic).Msg("failed to publish to topic")
+		return nil, toGRPCError(publishErr)
+	}
+	return &grpcapi.BroadcastResponse{}, nil
+}
+
+func (s *grpcAdminServer) CloseConnection(ctx context.Context, request *grpcapi.CloseConnectionRequest) (*grpcapi.CloseConnectionResponse, error) {
+	if len(request.ConnectionId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing connection id")
+	}
+	closeReq, requestErr := newCloseRequest(int(request.Code), request.Reason, request.Message)
+	if requestErr != nil {
+		return nil, status.Error(codes.InvalidArgument, requestErr.Error())
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	closeErr := s.service.closeConnection(ctx, ConnectionID(request.ConnectionId), closeReq)
+	if closeErr != nil {
+		return nil, toGRPCError(closeErr)
+	}
+	return &grpcapi.CloseConnectionResponse{}, nil
+}
+
+func (s *grpcAdminServer) CloseUserConnections(ctx context.Context, request *grpcapi.CloseUserConnectionsRequest) (*grpcapi.CloseUserConnectionsResponse, error) {
+	if len(request.UserId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing user id")
+	}
+	closeReq, requestErr := newCloseRequest(int(request.Code), request.Reason, request.Message)
+	if requestErr != nil {
+		return nil, status.Error(codes.InvalidArgument, requestErr.Error())
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	closedCount, closeErr := s.service.closeUserConnections(ctx, request.UserId, closeReq)
+	if closeErr != nil {
+		return nil, toGRPCError(closeErr)
+	}
+	return &grpcapi.CloseUserConnectionsResponse{ClosedCount: int32(closedCount)}, nil
+}
+
+func (s *grpcAdminServer) GetConnection(ctx context.Context, request *grpcapi.GetConnectionRequest) (*grpcapi.Connection, error) {
+	if len(request.ConnectionId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing connection id")
+	}
+	info, infoErr := s.service.connectionInfo(ctx, ConnectionID(request.ConnectionId))
+	if infoErr != nil {
+		return nil, toGRPCError(infoErr)
+	}
+	return toGRPCConnection(info), nil
+}
+
+func (s *grpcAdminServer) ListConnections(ctx context.Context, request *grpcapi.ListConnectionsRequest) (*grpcapi.ListConnectionsResponse, error) {
+	if request.Limit < 0 || request.Limit > maxConnectionPageSize || request.Offset < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid page: the limit is at most %d", maxConnectionPageSize)
+	}
+	if request.MinAge.AsDuration() < 0 || request.MaxAge.AsDuration() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid age")
+	}
+	filter := connectionFilter{
+		userId:   request.UserId,
+		tenantId: request.TenantId,
+		node:     request.Node,
+		topic:    request.Topic,
+		minAge:   request.MinAge.AsDuration(),
+		maxAge:   request.MaxAge.AsDuration(),
+	}
+	page := connectionPage{limit: int(request.Limit), offset: int(request.Offset)}
+	if page.limit == 0 {
+		page.limit = defaultConnectionPageSize
+	}
+
+	list, listErr := s.service.listConnections(ctx, filter, page)
+	if listErr != nil {
+		return nil, toGRPCError(listErr)
+	}
+	response := &grpcapi.ListConnectionsResponse{Total: int32(list.Total)}
+	for _, info := range list.Connections {
+		response.Connections = append(response.Connections, toGRPCConnection(info))
+	}
+	return response, nil
+}
+
+func toGRPCConnection(info *connectionInfo) *grpcapi.Connection {
+	connection := &grpcapi.Connection{
+		Id:                 string(info.ID),
+		Instance:           info.Node,
+		UserId:             info.UserID,
+		TenantId:           info.TenantID,
+		Topics:             info.Topics,
+		RemoteAddress:      info.RemoteAddress,
+		UserAgent:          info.UserAgent,
+		Metadata:           string(info.Metadata),
+		QueueDepth:         int32(info.QueueDepth),
+		MessagesFromClient: info.MessagesFromClient,
+		MessagesToClient:   info.MessagesToClient,
+		Subprotocol:        info.Subprotocol,
+	}
+	if !info.ConnectedAt.IsZero() {
+		connection.ConnectedAt = timestamppb.New(info.ConnectedAt)
+	}
+	return connection
+}
+
+func (s *grpcBackendServer) GetPresence(ctx context.Context, request *grpcapi.GetPresenceRequest) (*grpcapi.GetPresenceResponse, error) {
+	if len(request.UserIds) > maxPresenceQuerySize {
+		return nil, status.Errorf(codes.InvalidArgument, "more than %d user ids", maxPresenceQuerySize)
+	}
+	presences, presenceErr := s.service.presence(ctx, request.UserIds)
+	if presenceErr != nil {
+		return nil, toGRPCError(presenceErr)
+	}
+	response := &grpcapi.GetPresenceResponse{}
+	for _, presence := range presences {
+		response.Presence = append(response.Presence, &grpcapi.UserPresence{
+			UserId:      presence.UserID,
+			Online:      presence.Online,
+			Connections: int32(presence.Connections),
+		})
+	}
+	return response, nil
+}
+
+func (s *grpcBackendServer) SubscribeConnectionEvents(_ *grpcapi.SubscribeConnectionEventsRequest, stream grpcapi.WsproxyService_SubscribeConnectionEventsServer) error {
+	events, unsubscribe := s.service.subscribeToLifecycleEvents()
+	defer unsubscribe()
+
+	// Lets the caller know that the events from now on are streamed
+	if headerErr := stream.SendHeader(metadata.MD{}); headerErr != nil {
+		return headerErr
+	}
+
+	for {
+		select {
+		case event := <-events:
+			eventType := grpcapi.ConnectionEvent_TYPE_CONNECTED
+			if event.eventType == disconnectedEvent {
+				eventType = grpcapi.ConnectionEvent_TYPE_DISCONNECTED
+			}
+			sendErr := stream.Send(&grpcapi.ConnectionEvent{
+				Type:         eventType,
+				ConnectionId: string(event.connectionId),
+				UserId:       event.identity.userId,
+				TenantId:     event.identity.tenantId,
+				Time:         timestamppb.New(event.time),
+			})
+			if sendErr != nil {
+				return sendErr
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func toGRPCError(err error) error {
+	if errors.Is(err, errConnectionNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, errPushTimedOut) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
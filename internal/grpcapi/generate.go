@@ -0,0 +1,4 @@
+// Package grpcapi holds the code generated from the definition of the proxy's gRPC back-end API
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wsproxy.proto
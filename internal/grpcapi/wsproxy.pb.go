@@ -0,0 +1,1256 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: wsproxy.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ConnectionEvent_Type int32
+
+const (
+	ConnectionEvent_TYPE_UNSPECIFIED  ConnectionEvent_Type = 0
+	ConnectionEvent_TYPE_CONNECTED    ConnectionEvent_Type = 1
+	ConnectionEvent_TYPE_DISCONNECTED ConnectionEvent_Type = 2
+)
+
+// Enum value maps for ConnectionEvent_Type.
+var (
+	ConnectionEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_CONNECTED",
+		2: "TYPE_DISCONNECTED",
+	}
+	ConnectionEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED":  0,
+		"TYPE_CONNECTED":    1,
+		"TYPE_DISCONNECTED": 2,
+	}
+)
+
+func (x ConnectionEvent_Type) Enum() *ConnectionEvent_Type {
+	p := new(ConnectionEvent_Type)
+	*p = x
+	return p
+}
+
+func (x ConnectionEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConnectionEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_wsproxy_proto_enumTypes[0].Descriptor()
+}
+
+func (ConnectionEvent_Type) Type() protoreflect.EnumType {
+	return &file_wsproxy_proto_enumTypes[0]
+}
+
+func (x ConnectionEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConnectionEvent_Type.Descriptor instead.
+func (ConnectionEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{16, 0}
+}
+
+type PushRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId  string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushRequest) Reset() {
+	*x = PushRequest{}
+	mi := &file_wsproxy_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushRequest) ProtoMessage() {}
+
+func (x *PushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushRequest.ProtoReflect.Descriptor instead.
+func (*PushRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PushRequest) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *PushRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type PushResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushResponse) Reset() {
+	*x = PushResponse{}
+	mi := &file_wsproxy_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushResponse) ProtoMessage() {}
+
+func (x *PushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushResponse.ProtoReflect.Descriptor instead.
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{1}
+}
+
+type BroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         string                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BroadcastRequest) Reset() {
+	*x = BroadcastRequest{}
+	mi := &file_wsproxy_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcastRequest) ProtoMessage() {}
+
+func (x *BroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcastRequest.ProtoReflect.Descriptor instead.
+func (*BroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BroadcastRequest) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *BroadcastRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type BroadcastResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BroadcastResponse) Reset() {
+	*x = BroadcastResponse{}
+	mi := &file_wsproxy_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcastResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcastResponse) ProtoMessage() {}
+
+func (x *BroadcastResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcastResponse.ProtoReflect.Descriptor instead.
+func (*BroadcastResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{3}
+}
+
+type CloseConnectionRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	// code is the web-socket close status code; defaults to 1000 (normal closure)
+	Code   int32  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	// message, if set, is sent to the client before the connection is closed
+	Message       string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionRequest) Reset() {
+	*x = CloseConnectionRequest{}
+	mi := &file_wsproxy_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionRequest) ProtoMessage() {}
+
+func (x *CloseConnectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionRequest.ProtoReflect.Descriptor instead.
+func (*CloseConnectionRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CloseConnectionRequest) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *CloseConnectionRequest) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *CloseConnectionRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CloseConnectionRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type CloseConnectionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionResponse) Reset() {
+	*x = CloseConnectionResponse{}
+	mi := &file_wsproxy_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionResponse) ProtoMessage() {}
+
+func (x *CloseConnectionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionResponse.ProtoReflect.Descriptor instead.
+func (*CloseConnectionResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{5}
+}
+
+type CloseUserConnectionsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// code, reason and message are applied to every connection as in CloseConnectionRequest
+	Code          int32  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Reason        string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Message       string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseUserConnectionsRequest) Reset() {
+	*x = CloseUserConnectionsRequest{}
+	mi := &file_wsproxy_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseUserConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseUserConnectionsRequest) ProtoMessage() {}
+
+func (x *CloseUserConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseUserConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*CloseUserConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CloseUserConnectionsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CloseUserConnectionsRequest) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *CloseUserConnectionsRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CloseUserConnectionsRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type CloseUserConnectionsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// closed_count is the number of connections closed
+	ClosedCount   int32 `protobuf:"varint,1,opt,name=closed_count,json=closedCount,proto3" json:"closed_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseUserConnectionsResponse) Reset() {
+	*x = CloseUserConnectionsResponse{}
+	mi := &file_wsproxy_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseUserConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseUserConnectionsResponse) ProtoMessage() {}
+
+func (x *CloseUserConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseUserConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*CloseUserConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CloseUserConnectionsResponse) GetClosedCount() int32 {
+	if x != nil {
+		return x.ClosedCount
+	}
+	return 0
+}
+
+type GetConnectionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId  string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConnectionRequest) Reset() {
+	*x = GetConnectionRequest{}
+	mi := &file_wsproxy_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConnectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConnectionRequest) ProtoMessage() {}
+
+func (x *GetConnectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConnectionRequest.ProtoReflect.Descriptor instead.
+func (*GetConnectionRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetConnectionRequest) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+type Connection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// instance is the address of the instance serving the connection (if known)
+	Instance string `protobuf:"bytes,2,opt,name=instance,proto3" json:"instance,omitempty"`
+	// The fields below are only set if the instance serving the connection could be reached
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	TenantId      string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Topics        []string               `protobuf:"bytes,5,rep,name=topics,proto3" json:"topics,omitempty"`
+	ConnectedAt   *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=connected_at,json=connectedAt,proto3" json:"connected_at,omitempty"`
+	RemoteAddress string                 `protobuf:"bytes,7,opt,name=remote_address,json=remoteAddress,proto3" json:"remote_address,omitempty"`
+	UserAgent     string                 `protobuf:"bytes,8,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	// metadata is the application's custom data (JSON) attached to the connection
+	Metadata string `protobuf:"bytes,9,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// queue_depth is the number of messages waiting to be sent to the client
+	QueueDepth         int32 `protobuf:"varint,10,opt,name=queue_depth,json=queueDepth,proto3" json:"queue_depth,omitempty"`
+	MessagesFromClient int64 `protobuf:"varint,11,opt,name=messages_from_client,json=messagesFromClient,proto3" json:"messages_from_client,omitempty"`
+	MessagesToClient   int64 `protobuf:"varint,12,opt,name=messages_to_client,json=messagesToClient,proto3" json:"messages_to_client,omitempty"`
+	// subprotocol is the subprotocol negotiated with the client (if any)
+	Subprotocol   string `protobuf:"bytes,13,opt,name=subprotocol,proto3" json:"subprotocol,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_wsproxy_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Connection) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Connection) GetInstance() string {
+	if x != nil {
+		return x.Instance
+	}
+	return ""
+}
+
+func (x *Connection) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Connection) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *Connection) GetTopics() []string {
+	if x != nil {
+		return x.Topics
+	}
+	return nil
+}
+
+func (x *Connection) GetConnectedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ConnectedAt
+	}
+	return nil
+}
+
+func (x *Connection) GetRemoteAddress() string {
+	if x != nil {
+		return x.RemoteAddress
+	}
+	return ""
+}
+
+func (x *Connection) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *Connection) GetMetadata() string {
+	if x != nil {
+		return x.Metadata
+	}
+	return ""
+}
+
+func (x *Connection) GetQueueDepth() int32 {
+	if x != nil {
+		return x.QueueDepth
+	}
+	return 0
+}
+
+func (x *Connection) GetMessagesFromClient() int64 {
+	if x != nil {
+		return x.MessagesFromClient
+	}
+	return 0
+}
+
+func (x *Connection) GetMessagesToClient() int64 {
+	if x != nil {
+		return x.MessagesToClient
+	}
+	return 0
+}
+
+func (x *Connection) GetSubprotocol() string {
+	if x != nil {
+		return x.Subprotocol
+	}
+	return ""
+}
+
+type ListConnectionsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The connections are filtered by the criteria set
+	UserId   string               `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	TenantId string               `protobuf:"bytes,2,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Node     string               `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
+	Topic    string               `protobuf:"bytes,4,opt,name=topic,proto3" json:"topic,omitempty"`
+	MinAge   *durationpb.Duration `protobuf:"bytes,5,opt,name=min_age,json=minAge,proto3" json:"min_age,omitempty"`
+	MaxAge   *durationpb.Duration `protobuf:"bytes,6,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"`
+	// limit defaults to 100 (at most 1000); the connections are ordered oldest first
+	Limit         int32 `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset        int32 `protobuf:"varint,8,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsRequest) Reset() {
+	*x = ListConnectionsRequest{}
+	mi := &file_wsproxy_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsRequest) ProtoMessage() {}
+
+func (x *ListConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListConnectionsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ListConnectionsRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *ListConnectionsRequest) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *ListConnectionsRequest) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *ListConnectionsRequest) GetMinAge() *durationpb.Duration {
+	if x != nil {
+		return x.MinAge
+	}
+	return nil
+}
+
+func (x *ListConnectionsRequest) GetMaxAge() *durationpb.Duration {
+	if x != nil {
+		return x.MaxAge
+	}
+	return nil
+}
+
+func (x *ListConnectionsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListConnectionsRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type ListConnectionsResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Connections []*Connection          `protobuf:"bytes,1,rep,name=connections,proto3" json:"connections,omitempty"`
+	// total is the number of connections matching the filter
+	Total         int32 `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsResponse) Reset() {
+	*x = ListConnectionsResponse{}
+	mi := &file_wsproxy_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsResponse) ProtoMessage() {}
+
+func (x *ListConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListConnectionsResponse) GetConnections() []*Connection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+func (x *ListConnectionsResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type GetPresenceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserIds       []string               `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPresenceRequest) Reset() {
+	*x = GetPresenceRequest{}
+	mi := &file_wsproxy_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPresenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPresenceRequest) ProtoMessage() {}
+
+func (x *GetPresenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPresenceRequest.ProtoReflect.Descriptor instead.
+func (*GetPresenceRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetPresenceRequest) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+type UserPresence struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Online bool                   `protobuf:"varint,2,opt,name=online,proto3" json:"online,omitempty"`
+	// connections is the number of the user's connections across all instances
+	Connections   int32 `protobuf:"varint,3,opt,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserPresence) Reset() {
+	*x = UserPresence{}
+	mi := &file_wsproxy_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserPresence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserPresence) ProtoMessage() {}
+
+func (x *UserPresence) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserPresence.ProtoReflect.Descriptor instead.
+func (*UserPresence) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UserPresence) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserPresence) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+func (x *UserPresence) GetConnections() int32 {
+	if x != nil {
+		return x.Connections
+	}
+	return 0
+}
+
+type GetPresenceResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// presence lists the presence of the users in the order of the request's user ids
+	Presence      []*UserPresence `protobuf:"bytes,1,rep,name=presence,proto3" json:"presence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPresenceResponse) Reset() {
+	*x = GetPresenceResponse{}
+	mi := &file_wsproxy_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPresenceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPresenceResponse) ProtoMessage() {}
+
+func (x *GetPresenceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPresenceResponse.ProtoReflect.Descriptor instead.
+func (*GetPresenceResponse) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GetPresenceResponse) GetPresence() []*UserPresence {
+	if x != nil {
+		return x.Presence
+	}
+	return nil
+}
+
+type SubscribeConnectionEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeConnectionEventsRequest) Reset() {
+	*x = SubscribeConnectionEventsRequest{}
+	mi := &file_wsproxy_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeConnectionEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeConnectionEventsRequest) ProtoMessage() {}
+
+func (x *SubscribeConnectionEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeConnectionEventsRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeConnectionEventsRequest) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{15}
+}
+
+type ConnectionEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          ConnectionEvent_Type   `protobuf:"varint,1,opt,name=type,proto3,enum=wsproxy.v1.ConnectionEvent_Type" json:"type,omitempty"`
+	ConnectionId  string                 `protobuf:"bytes,2,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	TenantId      string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectionEvent) Reset() {
+	*x = ConnectionEvent{}
+	mi := &file_wsproxy_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectionEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectionEvent) ProtoMessage() {}
+
+func (x *ConnectionEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_wsproxy_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectionEvent.ProtoReflect.Descriptor instead.
+func (*ConnectionEvent) Descriptor() ([]byte, []int) {
+	return file_wsproxy_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ConnectionEvent) GetType() ConnectionEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return ConnectionEvent_TYPE_UNSPECIFIED
+}
+
+func (x *ConnectionEvent) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *ConnectionEvent) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ConnectionEvent) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *ConnectionEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+var File_wsproxy_proto protoreflect.FileDescriptor
+
+const file_wsproxy_proto_rawDesc = "" +
+	"\n" +
+	"\rwsproxy.proto\x12\n" +
+	"wsproxy.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"L\n" +
+	"\vPushRequest\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x0e\n" +
+	"\fPushResponse\"B\n" +
+	"\x10BroadcastRequest\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\tR\x05topic\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x13\n" +
+	"\x11BroadcastResponse\"\x83\x01\n" +
+	"\x16CloseConnectionRequest\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"\x19\n" +
+	"\x17CloseConnectionResponse\"|\n" +
+	"\x1bCloseUserConnectionsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"A\n" +
+	"\x1cCloseUserConnectionsResponse\x12!\n" +
+	"\fclosed_count\x18\x01 \x01(\x05R\vclosedCount\";\n" +
+	"\x14GetConnectionRequest\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\"\xca\x03\n" +
+	"\n" +
+	"Connection\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\binstance\x18\x02 \x01(\tR\binstance\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x1b\n" +
+	"\ttenant_id\x18\x04 \x01(\tR\btenantId\x12\x16\n" +
+	"\x06topics\x18\x05 \x03(\tR\x06topics\x12=\n" +
+	"\fconnected_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\vconnectedAt\x12%\n" +
+	"\x0eremote_address\x18\a \x01(\tR\rremoteAddress\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\b \x01(\tR\tuserAgent\x12\x1a\n" +
+	"\bmetadata\x18\t \x01(\tR\bmetadata\x12\x1f\n" +
+	"\vqueue_depth\x18\n" +
+	" \x01(\x05R\n" +
+	"queueDepth\x120\n" +
+	"\x14messages_from_client\x18\v \x01(\x03R\x12messagesFromClient\x12,\n" +
+	"\x12messages_to_client\x18\f \x01(\x03R\x10messagesToClient\x12 \n" +
+	"\vsubprotocol\x18\r \x01(\tR\vsubprotocol\"\x8e\x02\n" +
+	"\x16ListConnectionsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
+	"\ttenant_id\x18\x02 \x01(\tR\btenantId\x12\x12\n" +
+	"\x04node\x18\x03 \x01(\tR\x04node\x12\x14\n" +
+	"\x05topic\x18\x04 \x01(\tR\x05topic\x122\n" +
+	"\amin_age\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\x06minAge\x122\n" +
+	"\amax_age\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\x06maxAge\x12\x14\n" +
+	"\x05limit\x18\a \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\b \x01(\x05R\x06offset\"i\n" +
+	"\x17ListConnectionsResponse\x128\n" +
+	"\vconnections\x18\x01 \x03(\v2\x16.wsproxy.v1.ConnectionR\vconnections\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\"/\n" +
+	"\x12GetPresenceRequest\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\"a\n" +
+	"\fUserPresence\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06online\x18\x02 \x01(\bR\x06online\x12 \n" +
+	"\vconnections\x18\x03 \x01(\x05R\vconnections\"K\n" +
+	"\x13GetPresenceResponse\x124\n" +
+	"\bpresence\x18\x01 \x03(\v2\x18.wsproxy.v1.UserPresenceR\bpresence\"\"\n" +
+	" SubscribeConnectionEventsRequest\"\x9b\x02\n" +
+	"\x0fConnectionEvent\x124\n" +
+	"\x04type\x18\x01 \x01(\x0e2 .wsproxy.v1.ConnectionEvent.TypeR\x04type\x12#\n" +
+	"\rconnection_id\x18\x02 \x01(\tR\fconnectionId\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x1b\n" +
+	"\ttenant_id\x18\x04 \x01(\tR\btenantId\x12.\n" +
+	"\x04time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"G\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eTYPE_CONNECTED\x10\x01\x12\x15\n" +
+	"\x11TYPE_DISCONNECTED\x10\x022\xcf\x02\n" +
+	"\x0eWsproxyService\x129\n" +
+	"\x04Push\x12\x17.wsproxy.v1.PushRequest\x1a\x18.wsproxy.v1.PushResponse\x12H\n" +
+	"\tBroadcast\x12\x1c.wsproxy.v1.BroadcastRequest\x1a\x1d.wsproxy.v1.BroadcastResponse\x12N\n" +
+	"\vGetPresence\x12\x1e.wsproxy.v1.GetPresenceRequest\x1a\x1f.wsproxy.v1.GetPresenceResponse\x12h\n" +
+	"\x19SubscribeConnectionEvents\x12,.wsproxy.v1.SubscribeConnectionEventsRequest\x1a\x1b.wsproxy.v1.ConnectionEvent0\x012\x83\x03\n" +
+	"\x13WsproxyAdminService\x12Z\n" +
+	"\x0fCloseConnection\x12\".wsproxy.v1.CloseConnectionRequest\x1a#.wsproxy.v1.CloseConnectionResponse\x12i\n" +
+	"\x14CloseUserConnections\x12'.wsproxy.v1.CloseUserConnectionsRequest\x1a(.wsproxy.v1.CloseUserConnectionsResponse\x12I\n" +
+	"\rGetConnection\x12 .wsproxy.v1.GetConnectionRequest\x1a\x16.wsproxy.v1.Connection\x12Z\n" +
+	"\x0fListConnections\x12\".wsproxy.v1.ListConnectionsRequest\x1a#.wsproxy.v1.ListConnectionsResponseB\x1aZ\x18wsproxy/internal/grpcapib\x06proto3"
+
+var (
+	file_wsproxy_proto_rawDescOnce sync.Once
+	file_wsproxy_proto_rawDescData []byte
+)
+
+func file_wsproxy_proto_rawDescGZIP() []byte {
+	file_wsproxy_proto_rawDescOnce.Do(func() {
+		file_wsproxy_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_wsproxy_proto_rawDesc), len(file_wsproxy_proto_rawDesc)))
+	})
+	return file_wsproxy_proto_rawDescData
+}
+
+var file_wsproxy_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_wsproxy_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_wsproxy_proto_goTypes = []any{
+	(ConnectionEvent_Type)(0),                // 0: wsproxy.v1.ConnectionEvent.Type
+	(*PushRequest)(nil),                      // 1: wsproxy.v1.PushRequest
+	(*PushResponse)(nil),                     // 2: wsproxy.v1.PushResponse
+	(*BroadcastRequest)(nil),                 // 3: wsproxy.v1.BroadcastRequest
+	(*BroadcastResponse)(nil),                // 4: wsproxy.v1.BroadcastResponse
+	(*CloseConnectionRequest)(nil),           // 5: wsproxy.v1.CloseConnectionRequest
+	(*CloseConnectionResponse)(nil),          // 6: wsproxy.v1.CloseConnectionResponse
+	(*CloseUserConnectionsRequest)(nil),      // 7: wsproxy.v1.CloseUserConnectionsRequest
+	(*CloseUserConnectionsResponse)(nil),     // 8: wsproxy.v1.CloseUserConnectionsResponse
+	(*GetConnectionRequest)(nil),             // 9: wsproxy.v1.GetConnectionRequest
+	(*Connection)(nil),                       // 10: wsproxy.v1.Connection
+	(*ListConnectionsRequest)(nil),           // 11: wsproxy.v1.ListConnectionsRequest
+	(*ListConnectionsResponse)(nil),          // 12: wsproxy.v1.ListConnectionsResponse
+	(*GetPresenceRequest)(nil),               // 13: wsproxy.v1.GetPresenceRequest
+	(*UserPresence)(nil),                     // 14: wsproxy.v1.UserPresence
+	(*GetPresenceResponse)(nil),              // 15: wsproxy.v1.GetPresenceResponse
+	(*SubscribeConnectionEventsRequest)(nil), // 16: wsproxy.v1.SubscribeConnectionEventsRequest
+	(*ConnectionEvent)(nil),                  // 17: wsproxy.v1.ConnectionEvent
+	(*timestamppb.Timestamp)(nil),            // 18: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),              // 19: google.protobuf.Duration
+}
+var file_wsproxy_proto_depIdxs = []int32{
+	18, // 0: wsproxy.v1.Connection.connected_at:type_name -> google.protobuf.Timestamp
+	19, // 1: wsproxy.v1.ListConnectionsRequest.min_age:type_name -> google.protobuf.Duration
+	19, // 2: wsproxy.v1.ListConnectionsRequest.max_age:type_name -> google.protobuf.Duration
+	10, // 3: wsproxy.v1.ListConnectionsResponse.connections:type_name -> wsproxy.v1.Connection
+	14, // 4: wsproxy.v1.GetPresenceResponse.presence:type_name -> wsproxy.v1.UserPresence
+	0,  // 5: wsproxy.v1.ConnectionEvent.type:type_name -> wsproxy.v1.ConnectionEvent.Type
+	18, // 6: wsproxy.v1.ConnectionEvent.time:type_name -> google.protobuf.Timestamp
+	1,  // 7: wsproxy.v1.WsproxyService.Push:input_type -> wsproxy.v1.PushRequest
+	3,  // 8: wsproxy.v1.WsproxyService.Broadcast:input_type -> wsproxy.v1.BroadcastRequest
+	13, // 9: wsproxy.v1.WsproxyService.GetPresence:input_type -> wsproxy.v1.GetPresenceRequest
+	16, // 10: wsproxy.v1.WsproxyService.SubscribeConnectionEvents:input_type -> wsproxy.v1.SubscribeConnectionEventsRequest
+	5,  // 11: wsproxy.v1.WsproxyAdminService.CloseConnection:input_type -> wsproxy.v1.CloseConnectionRequest
+	7,  // 12: wsproxy.v1.WsproxyAdminService.CloseUserConnections:input_type -> wsproxy.v1.CloseUserConnectionsRequest
+	9,  // 13: wsproxy.v1.WsproxyAdminService.GetConnection:input_type -> wsproxy.v1.GetConnectionRequest
+	11, // 14: wsproxy.v1.WsproxyAdminService.ListConnections:input_type -> wsproxy.v1.ListConnectionsRequest
+	2,  // 15: wsproxy.v1.WsproxyService.Push:output_type -> wsproxy.v1.PushResponse
+	4,  // 16: wsproxy.v1.WsproxyService.Broadcast:output_type -> wsproxy.v1.BroadcastResponse
+	15, // 17: wsproxy.v1.WsproxyService.GetPresence:output_type -> wsproxy.v1.GetPresenceResponse
+	17, // 18: wsproxy.v1.WsproxyService.SubscribeConnectionEvents:output_type -> wsproxy.v1.ConnectionEvent
+	6,  // 19: wsproxy.v1.WsproxyAdminService.CloseConnection:output_type -> wsproxy.v1.CloseConnectionResponse
+	8,  // 20: wsproxy.v1.WsproxyAdminService.CloseUserConnections:output_type -> wsproxy.v1.CloseUserConnectionsResponse
+	10, // 21: wsproxy.v1.WsproxyAdminService.GetConnection:output_type -> wsproxy.v1.Connection
+	12, // 22: wsproxy.v1.WsproxyAdminService.ListConnections:output_type -> wsproxy.v1.ListConnectionsResponse
+	15, // [15:23] is the sub-list for method output_type
+	7,  // [7:15] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_wsproxy_proto_init() }
+func file_wsproxy_proto_init() {
+	if File_wsproxy_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_wsproxy_proto_rawDesc), len(file_wsproxy_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_wsproxy_proto_goTypes,
+		DependencyIndexes: file_wsproxy_proto_depIdxs,
+		EnumInfos:         file_wsproxy_proto_enumTypes,
+		MessageInfos:      file_wsproxy_proto_msgTypes,
+	}.Build()
+	File_wsproxy_proto = out.File
+	file_wsproxy_proto_goTypes = nil
+	file_wsproxy_proto_depIdxs = nil
+}
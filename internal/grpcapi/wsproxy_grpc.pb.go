@@ -0,0 +1,487 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: wsproxy.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WsproxyService_Push_FullMethodName                      = "/wsproxy.v1.WsproxyService/Push"
+	WsproxyService_Broadcast_FullMethodName                 = "/wsproxy.v1.WsproxyService/Broadcast"
+	WsproxyService_GetPresence_FullMethodName               = "/wsproxy.v1.WsproxyService/GetPresence"
+	WsproxyService_SubscribeConnectionEvents_FullMethodName = "/wsproxy.v1.WsproxyService/SubscribeConnectionEvents"
+)
+
+// WsproxyServiceClient is the client API for WsproxyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WsproxyService is the gRPC counterpart of the proxy's HTTP back-end API.
+// Calls are authenticated and authorized the same way (see `BackendAuthConfig`), the credentials being expected in the
+// call metadata (`authorization`, `x-wsgw-api-key`).
+type WsproxyServiceClient interface {
+	// Push sends a message to a client connection, like `POST /message/{connectionId}`
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error)
+	// Broadcast sends a message to the subscribers of a topic, like `POST /topic/{topic}`
+	Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*BroadcastResponse, error)
+	// GetPresence returns the presence of users, like `POST /presence`
+	GetPresence(ctx context.Context, in *GetPresenceRequest, opts ...grpc.CallOption) (*GetPresenceResponse, error)
+	// SubscribeConnectionEvents streams the lifecycle events of the connections served by any instance of the cluster
+	SubscribeConnectionEvents(ctx context.Context, in *SubscribeConnectionEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionEvent], error)
+}
+
+type wsproxyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWsproxyServiceClient(cc grpc.ClientConnInterface) WsproxyServiceClient {
+	return &wsproxyServiceClient{cc}
+}
+
+func (c *wsproxyServiceClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PushResponse)
+	err := c.cc.Invoke(ctx, WsproxyService_Push_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyServiceClient) Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*BroadcastResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BroadcastResponse)
+	err := c.cc.Invoke(ctx, WsproxyService_Broadcast_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyServiceClient) GetPresence(ctx context.Context, in *GetPresenceRequest, opts ...grpc.CallOption) (*GetPresenceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPresenceResponse)
+	err := c.cc.Invoke(ctx, WsproxyService_GetPresence_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyServiceClient) SubscribeConnectionEvents(ctx context.Context, in *SubscribeConnectionEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WsproxyService_ServiceDesc.Streams[0], WsproxyService_SubscribeConnectionEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeConnectionEventsRequest, ConnectionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WsproxyService_SubscribeConnectionEventsClient = grpc.ServerStreamingClient[ConnectionEvent]
+
+// WsproxyServiceServer is the server API for WsproxyService service.
+// All implementations must embed UnimplementedWsproxyServiceServer
+// for forward compatibility.
+//
+// WsproxyService is the gRPC counterpart of the proxy's HTTP back-end API.
+// Calls are authenticated and authorized the same way (see `BackendAuthConfig`), the credentials being expected in the
+// call metadata (`authorization`, `x-wsgw-api-key`).
+type WsproxyServiceServer interface {
+	// Push sends a message to a client connection, like `POST /message/{connectionId}`
+	Push(context.Context, *PushRequest) (*PushResponse, error)
+	// Broadcast sends a message to the subscribers of a topic, like `POST /topic/{topic}`
+	Broadcast(context.Context, *BroadcastRequest) (*BroadcastResponse, error)
+	// GetPresence returns the presence of users, like `POST /presence`
+	GetPresence(context.Context, *GetPresenceRequest) (*GetPresenceResponse, error)
+	// SubscribeConnectionEvents streams the lifecycle events of the connections served by any instance of the cluster
+	SubscribeConnectionEvents(*SubscribeConnectionEventsRequest, grpc.ServerStreamingServer[ConnectionEvent]) error
+	mustEmbedUnimplementedWsproxyServiceServer()
+}
+
+// UnimplementedWsproxyServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWsproxyServiceServer struct{}
+
+func (UnimplementedWsproxyServiceServer) Push(context.Context, *PushRequest) (*PushResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (UnimplementedWsproxyServiceServer) Broadcast(context.Context, *BroadcastRequest) (*BroadcastResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Broadcast not implemented")
+}
+func (UnimplementedWsproxyServiceServer) GetPresence(context.Context, *GetPresenceRequest) (*GetPresenceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPresence not implemented")
+}
+func (UnimplementedWsproxyServiceServer) SubscribeConnectionEvents(*SubscribeConnectionEventsRequest, grpc.ServerStreamingServer[ConnectionEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeConnectionEvents not implemented")
+}
+func (UnimplementedWsproxyServiceServer) mustEmbedUnimplementedWsproxyServiceServer() {}
+func (UnimplementedWsproxyServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeWsproxyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WsproxyServiceServer will
+// result in compilation errors.
+type UnsafeWsproxyServiceServer interface {
+	mustEmbedUnimplementedWsproxyServiceServer()
+}
+
+func RegisterWsproxyServiceServer(s grpc.ServiceRegistrar, srv WsproxyServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWsproxyServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WsproxyService_ServiceDesc, srv)
+}
+
+func _WsproxyService_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyServiceServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyService_Push_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyServiceServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyService_Broadcast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyServiceServer).Broadcast(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyService_Broadcast_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyServiceServer).Broadcast(ctx, req.(*BroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyService_GetPresence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPresenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyServiceServer).GetPresence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyService_GetPresence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyServiceServer).GetPresence(ctx, req.(*GetPresenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyService_SubscribeConnectionEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeConnectionEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WsproxyServiceServer).SubscribeConnectionEvents(m, &grpc.GenericServerStream[SubscribeConnectionEventsRequest, ConnectionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WsproxyService_SubscribeConnectionEventsServer = grpc.ServerStreamingServer[ConnectionEvent]
+
+// WsproxyService_ServiceDesc is the grpc.ServiceDesc for WsproxyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WsproxyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wsproxy.v1.WsproxyService",
+	HandlerType: (*WsproxyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    _WsproxyService_Push_Handler,
+		},
+		{
+			MethodName: "Broadcast",
+			Handler:    _WsproxyService_Broadcast_Handler,
+		},
+		{
+			MethodName: "GetPresence",
+			Handler:    _WsproxyService_GetPresence_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeConnectionEvents",
+			Handler:       _WsproxyService_SubscribeConnectionEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "wsproxy.proto",
+}
+
+const (
+	WsproxyAdminService_CloseConnection_FullMethodName      = "/wsproxy.v1.WsproxyAdminService/CloseConnection"
+	WsproxyAdminService_CloseUserConnections_FullMethodName = "/wsproxy.v1.WsproxyAdminService/CloseUserConnections"
+	WsproxyAdminService_GetConnection_FullMethodName        = "/wsproxy.v1.WsproxyAdminService/GetConnection"
+	WsproxyAdminService_ListConnections_FullMethodName      = "/wsproxy.v1.WsproxyAdminService/ListConnections"
+)
+
+// WsproxyAdminServiceClient is the client API for WsproxyAdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WsproxyAdminService is the gRPC counterpart of the connection endpoints of the proxy's admin listener.
+// It is served by the gRPC listener only if the admin listener is configured, the calls being authenticated and
+// authorized as those of the admin listener (see `AdminConfig.Authentication`).
+type WsproxyAdminServiceClient interface {
+	// CloseConnection closes a client connection, like `DELETE /connections/{connectionId}`
+	CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*CloseConnectionResponse, error)
+	// CloseUserConnections closes every connection of a user, like `DELETE /users/{userId}/connections`
+	CloseUserConnections(ctx context.Context, in *CloseUserConnectionsRequest, opts ...grpc.CallOption) (*CloseUserConnectionsResponse, error)
+	// GetConnection returns what is known of a client connection, like `GET /connections/{connectionId}`
+	GetConnection(ctx context.Context, in *GetConnectionRequest, opts ...grpc.CallOption) (*Connection, error)
+	// ListConnections returns a page of the client connections matching the filter, like `GET /connections`
+	ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error)
+}
+
+type wsproxyAdminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWsproxyAdminServiceClient(cc grpc.ClientConnInterface) WsproxyAdminServiceClient {
+	return &wsproxyAdminServiceClient{cc}
+}
+
+func (c *wsproxyAdminServiceClient) CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*CloseConnectionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloseConnectionResponse)
+	err := c.cc.Invoke(ctx, WsproxyAdminService_CloseConnection_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyAdminServiceClient) CloseUserConnections(ctx context.Context, in *CloseUserConnectionsRequest, opts ...grpc.CallOption) (*CloseUserConnectionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloseUserConnectionsResponse)
+	err := c.cc.Invoke(ctx, WsproxyAdminService_CloseUserConnections_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyAdminServiceClient) GetConnection(ctx context.Context, in *GetConnectionRequest, opts ...grpc.CallOption) (*Connection, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Connection)
+	err := c.cc.Invoke(ctx, WsproxyAdminService_GetConnection_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wsproxyAdminServiceClient) ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConnectionsResponse)
+	err := c.cc.Invoke(ctx, WsproxyAdminService_ListConnections_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WsproxyAdminServiceServer is the server API for WsproxyAdminService service.
+// All implementations must embed UnimplementedWsproxyAdminServiceServer
+// for forward compatibility.
+//
+// WsproxyAdminService is the gRPC counterpart of the connection endpoints of the proxy's admin listener.
+// It is served by the gRPC listener only if the admin listener is configured, the calls being authenticated and
+// authorized as those of the admin listener (see `AdminConfig.Authentication`).
+type WsproxyAdminServiceServer interface {
+	// CloseConnection closes a client connection, like `DELETE /connections/{connectionId}`
+	CloseConnection(context.Context, *CloseConnectionRequest) (*CloseConnectionResponse, error)
+	// CloseUserConnections closes every connection of a user, like `DELETE /users/{userId}/connections`
+	CloseUserConnections(context.Context, *CloseUserConnectionsRequest) (*CloseUserConnectionsResponse, error)
+	// GetConnection returns what is known of a client connection, like `GET /connections/{connectionId}`
+	GetConnection(context.Context, *GetConnectionRequest) (*Connection, error)
+	// ListConnections returns a page of the client connections matching the filter, like `GET /connections`
+	ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error)
+	mustEmbedUnimplementedWsproxyAdminServiceServer()
+}
+
+// UnimplementedWsproxyAdminServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWsproxyAdminServiceServer struct{}
+
+func (UnimplementedWsproxyAdminServiceServer) CloseConnection(context.Context, *CloseConnectionRequest) (*CloseConnectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseConnection not implemented")
+}
+func (UnimplementedWsproxyAdminServiceServer) CloseUserConnections(context.Context, *CloseUserConnectionsRequest) (*CloseUserConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseUserConnections not implemented")
+}
+func (UnimplementedWsproxyAdminServiceServer) GetConnection(context.Context, *GetConnectionRequest) (*Connection, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConnection not implemented")
+}
+func (UnimplementedWsproxyAdminServiceServer) ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConnections not implemented")
+}
+func (UnimplementedWsproxyAdminServiceServer) mustEmbedUnimplementedWsproxyAdminServiceServer() {}
+func (UnimplementedWsproxyAdminServiceServer) testEmbeddedByValue()                             {}
+
+// UnsafeWsproxyAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WsproxyAdminServiceServer will
+// result in compilation errors.
+type UnsafeWsproxyAdminServiceServer interface {
+	mustEmbedUnimplementedWsproxyAdminServiceServer()
+}
+
+func RegisterWsproxyAdminServiceServer(s grpc.ServiceRegistrar, srv WsproxyAdminServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWsproxyAdminServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WsproxyAdminService_ServiceDesc, srv)
+}
+
+func _WsproxyAdminService_CloseConnection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseConnectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyAdminServiceServer).CloseConnection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyAdminService_CloseConnection_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyAdminServiceServer).CloseConnection(ctx, req.(*CloseConnectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyAdminService_CloseUserConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseUserConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyAdminServiceServer).CloseUserConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyAdminService_CloseUserConnections_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyAdminServiceServer).CloseUserConnections(ctx, req.(*CloseUserConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyAdminService_GetConnection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConnectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyAdminServiceServer).GetConnection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyAdminService_GetConnection_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyAdminServiceServer).GetConnection(ctx, req.(*GetConnectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WsproxyAdminService_ListConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WsproxyAdminServiceServer).ListConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WsproxyAdminService_ListConnections_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WsproxyAdminServiceServer).ListConnections(ctx, req.(*ListConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// WsproxyAdminService_ServiceDesc is the grpc.ServiceDesc for WsproxyAdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WsproxyAdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wsproxy.v1.WsproxyAdminService",
+	HandlerType: (*WsproxyAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CloseConnection",
+			Handler:    _WsproxyAdminService_CloseConnection_Handler,
+		},
+		{
+			MethodName: "CloseUserConnections",
+			Handler:    _WsproxyAdminService_CloseUserConnections_Handler,
+		},
+		{
+			MethodName: "GetConnection",
+			Handler:    _WsproxyAdminService_GetConnection_Handler,
+		},
+		{
+			MethodName: "ListConnections",
+			Handler:    _WsproxyAdminService_ListConnections_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wsproxy.proto",
+}
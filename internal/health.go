@@ -0,0 +1,161 @@
+package wsproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+
+	defaultReadinessCheckTimeout = 2 * time.Second
+
+	checkStatusOk     = "ok"
+	checkStatusFailed = "failed"
+)
+
+var errDraining = errors.New("the proxy is draining")
+
+// readinessCheck is a dependency the readiness of the proxy depends on
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a check as detailed by the health endpoints
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthReport is the body of the health endpoints
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// healthChecker tells whether the proxy is alive and ready to accept clients
+type healthChecker struct {
+	checks   []readinessCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func newHealthChecker(conf config.Config, clusterSupport *ClusterSupport, limiter *connectionLimiter) *healthChecker {
+	timeout := conf.Readiness.CheckTimeout
+	if timeout == 0 {
+		timeout = defaultReadinessCheckTimeout
+	}
+	checker := &healthChecker{timeout: timeout}
+
+	if clusterSupport != nil {
+		checker.checks = append(checker.checks, readinessCheck{name: "redis", check: clusterSupport.ping})
+	}
+	if conf.ConnectionLimits.MaxConnections > 0 {
+		// a saturated instance is to stop receiving clients
+		checker.checks = append(checker.checks, readinessCheck{
+			name: "connections",
+			check: func(ctx context.Context) error {
+				return limiter.checkCapacity()
+			},
+		})
+	}
+	if conf.Readiness.CheckApp {
+		client := http.Client{}
+		checker.checks = append(checker.checks, readinessCheck{
+			name: "app",
+			check: func(ctx context.Context) error {
+				return checkAppReachable(ctx, &client, conf.AppBaseUrl)
+			},
+		})
+	}
+
+	return checker
+}
+
+// startDraining makes the proxy report itself not ready from now on
+func (h *healthChecker) startDraining() {
+	h.draining.Store(true)
+}
+
+// readiness runs the checks and reports their outcome
+func (h *healthChecker) readiness(ctx context.Context) (bool, healthReport) {
+	ready := true
+	results := map[string]checkResult{}
+
+	record := func(name string, err error) {
+		if err != nil {
+			ready = false
+			results[name] = checkResult{Status: checkStatusFailed, Error: err.Error()}
+			return
+		}
+		results[name] = checkResult{Status: checkStatusOk}
+	}
+
+	if h.draining.Load() {
+		record("draining", errDraining)
+	} else {
+		record("draining", nil)
+	}
+
+	for _, check := range h.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		record(check.name, check.check(checkCtx))
+		cancel()
+	}
+
+	status := checkStatusOk
+	if !ready {
+		status = checkStatusFailed
+	}
+	return ready, healthReport{Status: status, Checks: results}
+}
+
+// healthzHandler reports the process as alive as long as it serves requests
+func healthzHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.JSON(http.StatusOK, healthReport{Status: checkStatusOk})
+	}
+}
+
+// readyzHandler responds with 200 if the proxy is ready to accept clients and with 503 otherwise, detailing the
+// outcome of each check in either case
+func readyzHandler(health *healthChecker) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "readyzHandler").Logger()
+
+		ready, report := health.readiness(g.Request.Context())
+		if !ready {
+			logger.Info().Interface("checks", report.Checks).Msg("not ready")
+			g.JSON(http.StatusServiceUnavailable, report)
+			return
+		}
+		g.JSON(http.StatusOK, report)
+	}
+}
+
+// checkAppReachable checks that the application responds at its base URL without a server error
+func checkAppReachable(ctx context.Context, client *http.Client, appBaseUrl string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, appBaseUrl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request object: %w", err)
+	}
+	response, requestErr := client.Do(request)
+	if requestErr != nil {
+		return fmt.Errorf("failed to reach the application: %w", requestErr)
+	}
+	defer cleanupResponse(response)
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("the application responded with status code %d", response.StatusCode)
+	}
+	return nil
+}
@@ -8,19 +8,50 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+	"wsproxy/internal/logging"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
 // TODO: make this configurable?
 const (
-	ConnectionIDHeaderKey = "X-WSGW-CONNECTION-ID"
-	connIdPathParamName   = ConnectionIDKey
+	ConnectionIDHeaderKey  = "X-WSGW-CONNECTION-ID"
+	UserIDHeaderKey        = "X-WSGW-USER-ID"
+	TenantIDHeaderKey      = "X-WSGW-TENANT-ID"
+	MetadataHeaderKey      = "X-WSGW-CONNECTION-METADATA"
+	CorrelationIDHeaderKey = "X-WSGW-CORRELATION-ID"
+	// DisconnectReasonHeaderKey tells the application why the connection was closed, if the reason is known
+	DisconnectReasonHeaderKey = "X-WSGW-DISCONNECT-REASON"
+	connIdPathParamName       = ConnectionIDKey
+	topicPathParamName        = "topic"
+	userIdPathParamName       = "userId"
 )
 
+// ClosedByAppReason is the disconnect reason of the connections closed via the back-end API
+const ClosedByAppReason = "closed by app"
+
+// ConnectionLimitReason is the disconnect reason of the connections the application accepted but the proxy rejected
+// for exceeding a connection limit
+const ConnectionLimitReason = "connection limit exceeded"
+
+// OriginNotAllowedReason is the disconnect reason of the connections the application accepted but the origin policy
+// doesn't allow for their tenant
+const OriginNotAllowedReason = "origin not allowed"
+
+// The maximum size of a web-socket close reason
+const maxCloseReasonSize = 123
+
+// The maximum size of the application's response to a connection request
+const maxConnectResponseSize = 1 << 20
+
 type wsIOAdapter struct {
 	wsConn *websocket.Conn
 }
@@ -50,46 +81,216 @@ func (wsIo *wsIOAdapter) Read(ctx context.Context) (string, error) {
 
 type applicationURLs interface {
 	connecting() string
+	connected() string
 	disconnected() string
 	message() string
+	messages() string
+	presence() string
 }
 
 type appConnection struct {
 	id         ConnectionID
 	httpClient http.Client
+	userId     string
+	tenantId   string
+	// metadata is the application's custom data (JSON) echoed back to it on every request concerning the connection
+	metadata string
+	// subprotocol is the web-socket subprotocol negotiated with the client (if any)
+	subprotocol string
+	// welcome is sent to the client right after the connection-id acknowledgement
+	welcome json.RawMessage
+	options connectionOptions
+	// notifyApp is set when the client was authenticated by the proxy itself, so the application has yet to learn about the connection
+	notifyApp bool
+	// disconnectReason is why the connection was closed (if known)
+	disconnectReason string
+}
+
+// connectResponse is the optional JSON body of the application's response to a connection request
+type connectResponse struct {
+	UserID        string   `json:"userId"`
+	TenantID      string   `json:"tenantId"`
+	Subscriptions []string `json:"subscriptions"`
+	RateLimit     *struct {
+		PerSecond float64 `json:"perSecond"`
+		Burst     int     `json:"burst"`
+	} `json:"rateLimit"`
+	MaxLifetimeSeconds int             `json:"maxLifetimeSeconds"`
+	Metadata           json.RawMessage `json:"metadata"`
+	Welcome            json.RawMessage `json:"welcome"`
+	// Subprotocol is the subprotocol chosen among those offered by the client
+	Subprotocol string `json:"subprotocol"`
+}
+
+// The defaults of the push rate limit the application's response to a connection request leaves out
+const (
+	defaultPushRatePerSecond = 10
+	defaultPushBurst         = 8
+)
+
+// newPushRateLimit fills in the default burst if "burst" is missing and falls back to the defaults on non-positive values
+func newPushRateLimit(perSecond float64, burst int, logger zerolog.Logger) *rateLimit {
+	if perSecond <= 0 {
+		logger.Warn().Float64("perSecond", perSecond).Msgf("invalid push rate limit, falling back to %d per second", defaultPushRatePerSecond)
+		perSecond = defaultPushRatePerSecond
+	}
+	if burst < 0 {
+		logger.Warn().Int("burst", burst).Msgf("invalid push rate limit burst, falling back to %d", defaultPushBurst)
+	}
+	if burst <= 0 {
+		burst = defaultPushBurst
+	}
+	return &rateLimit{perSecond: perSecond, burst: burst}
+}
+
+// applyConnectResponse configures the connection as the application's response to the connection request says.
+// Responses without a JSON body leave the connection as it is.
+func (appConn *appConnection) applyConnectResponse(response *http.Response, logger zerolog.Logger) error {
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxConnectResponseSize))
+	if readErr != nil {
+		return fmt.Errorf("failed to read response body: %w", readErr)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	var parsed connectResponse
+	if unmarshalErr := json.Unmarshal(body, &parsed); unmarshalErr != nil {
+		return fmt.Errorf("failed to parse response body: %w", unmarshalErr)
+	}
+
+	appConn.userId = parsed.UserID
+	appConn.tenantId = parsed.TenantID
+	appConn.options.topics = parsed.Subscriptions
+	if parsed.RateLimit != nil {
+		appConn.options.pushRateLimit = newPushRateLimit(parsed.RateLimit.PerSecond, parsed.RateLimit.Burst, logger)
+	}
+	appConn.options.maxLifetime = time.Duration(parsed.MaxLifetimeSeconds) * time.Second
+	if len(parsed.Metadata) > 0 && string(parsed.Metadata) != "null" {
+		compacted := bytes.Buffer{}
+		if compactErr := json.Compact(&compacted, parsed.Metadata); compactErr != nil {
+			return fmt.Errorf("failed to compact metadata: %w", compactErr)
+		}
+		appConn.metadata = compacted.String()
+	}
+	if len(parsed.Welcome) > 0 && string(parsed.Welcome) != "null" {
+		appConn.welcome = parsed.Welcome
+	}
+	if len(parsed.Subprotocol) > 0 {
+		appConn.subprotocol = parsed.Subprotocol
+	}
+	return nil
+}
+
+// setHeaders sets the headers identifying the connection on requests to the application
+func (appConn *appConnection) setHeaders(request *http.Request) {
+	request.Header.Set(ConnectionIDHeaderKey, string(appConn.id))
+	if len(appConn.userId) > 0 {
+		request.Header.Set(UserIDHeaderKey, appConn.userId)
+	}
+	if len(appConn.tenantId) > 0 {
+		request.Header.Set(TenantIDHeaderKey, appConn.tenantId)
+	}
+	if len(appConn.metadata) > 0 {
+		request.Header.Set(MetadataHeaderKey, appConn.metadata)
+	}
+	if len(appConn.subprotocol) > 0 {
+		request.Header.Set(SubprotocolHeaderKey, appConn.subprotocol)
+	}
 }
 
 // Relays the connection request to the backend's `POST /ws/connect` endpoint and
-func handleClientConnecting(createConnectionId func() ConnectionID, appUrls applicationURLs) func(c *gin.Context) *appConnection {
+// returns the new connection if the backend accepted it.
+// If `clientAuth` isn't `nil`, the client is authenticated locally instead and the backend isn't called.
+func handleClientConnecting(
+	createConnectionId func() ConnectionID,
+	appUrls applicationURLs,
+	clientAuth *clientAuthenticator,
+	forwarding *connectForwarding,
+	subprotocols []string,
+	audit *auditLog,
+	payloadLog *payloadLogger,
+) func(c *gin.Context) *appConnection {
 	return func(g *gin.Context) *appConnection {
 		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", fmt.Sprintf("handleClientConnecting: %s", appUrls.connecting())).Logger()
 
-		request, err := http.NewRequest(http.MethodGet, appUrls.connecting(), nil)
+		ctx, span := startSpan(extractTraceContext(g.Request.Context(), g.Request.Header), "handleClientConnecting", trace.SpanKindServer)
+		defer span.End()
+
+		offered := offeredSubprotocols(g.Request.Header)
+		subprotocol := negotiateSubprotocol(subprotocols, offered)
+
+		if clientAuth != nil {
+			identity, authnErr := clientAuth.authenticate(g.Request)
+			if authnErr != nil {
+				logger.Info().Err(authnErr).Msg("Authentication failed")
+				span.SetAttributes(statusCodeAttribute.Int(http.StatusUnauthorized))
+				audit.authFailed(proxyAuthMethod, g.ClientIP(), g.Request.UserAgent(), http.StatusUnauthorized, authnErr)
+				g.AbortWithStatus(http.StatusUnauthorized)
+				return nil
+			}
+
+			connId := createConnectionId()
+			span.SetAttributes(connectionIdAttribute.String(string(connId)))
+			logger.Debug().Str(ConnectionIDKey, string(connId)).Str("userId", identity.userId).Msg("client authenticated locally")
+
+			return &appConnection{
+				id:          connId,
+				httpClient:  newAppHTTPClient(),
+				userId:      identity.userId,
+				tenantId:    identity.tenantId,
+				subprotocol: subprotocol,
+				notifyApp:   true,
+			}
+		}
+
+		request, err := http.NewRequest(http.MethodGet, forwarding.url(appUrls.connecting(), g.Request), nil)
 		if err != nil {
 			logger.Error().Msgf("failed to create request object: %v", err)
 			g.AbortWithStatus(http.StatusInternalServerError)
 			return nil
 		}
-		request.Header = g.Request.Header
+		request.Header = forwarding.header(g.Request)
+		injectTraceContext(ctx, request.Header)
 
 		connId := createConnectionId()
+		span.SetAttributes(connectionIdAttribute.String(string(connId)))
 
-		request.Header.Add(ConnectionIDHeaderKey, string(connId))
-
-		client := http.Client{
-			Timeout: time.Second * 15,
+		request.Header.Set(ConnectionIDHeaderKey, string(connId))
+		if len(offered) > 0 {
+			request.Header.Set(OfferedSubprotocolsHeaderKey, strings.Join(offered, ", "))
 		}
+		if len(subprotocol) > 0 {
+			request.Header.Set(SubprotocolHeaderKey, subprotocol)
+		}
+
+		client := newAppHTTPClient()
 		response, requestErr := client.Do(request)
 		if requestErr != nil {
+			// the error carries the URL with the client's query parameters
+			requestErr = payloadLog.requestError(requestErr)
 			logger.Error().Msgf("failed to send request: %v", requestErr)
+			recordSpanError(span, requestErr)
 			g.AbortWithStatus(http.StatusInternalServerError)
 			return nil
 		}
 		defer cleanupResponse(response)
+		recordStatusCode(span, response.StatusCode)
 
-		if response.StatusCode == http.StatusUnauthorized {
-			logger.Info().Msg("Authentication failed")
-			g.AbortWithStatus(http.StatusUnauthorized)
+		switch response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			logger.Info().Int("status", response.StatusCode).Msg("Authentication failed")
+			audit.authFailed(appAuthMethod, g.ClientIP(), g.Request.UserAgent(), response.StatusCode, nil)
+		case http.StatusTooManyRequests:
+			audit.throttled(g.ClientIP(), g.Request.UserAgent())
+		}
+
+		if response.StatusCode != 200 && forwarding.passesThrough(response.StatusCode) {
+			logger.Info().Msgf("App rejected the connection with status code %d", response.StatusCode)
+			forwarding.abortWithRejection(g, response)
 			return nil
 		}
 
@@ -101,28 +302,83 @@ func handleClientConnecting(createConnectionId func() ConnectionID, appUrls appl
 
 		logger.Debug().Msgf("app has accepted: %v", connId)
 
-		return &appConnection{connId, client}
+		appConn := &appConnection{id: connId, httpClient: client, subprotocol: subprotocol}
+		if applyErr := appConn.applyConnectResponse(response, logger); applyErr != nil {
+			logger.Error().Err(applyErr).Msg("invalid response to connection request")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return nil
+		}
+		if chosen, offeredByClient := findSubprotocol(offered, appConn.subprotocol); offeredByClient {
+			appConn.subprotocol = chosen
+		} else if len(appConn.subprotocol) > 0 {
+			logger.Error().Str("subprotocol", appConn.subprotocol).Msg("the app chose a subprotocol the client didn't offer")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return nil
+		}
+
+		return appConn
 	}
 }
 
-func handleClientDisconnected(appUrls applicationURLs, appConn *appConnection, logger zerolog.Logger) {
+// handleClientConnected notifies the backend via its `POST /ws/connected` endpoint of a connection it hasn't authenticated itself
+func handleClientConnected(ctx context.Context, appUrls applicationURLs, appConn *appConnection, logger zerolog.Logger) {
+	logger = logger.With().Str("method", "handleClientConnected").Str("appUrl", appUrls.connected()).Str(ConnectionIDKey, string(appConn.id)).Logger()
+
+	ctx, span := startSpan(ctx, "handleClientConnected", trace.SpanKindClient, connectionIdAttribute.String(string(appConn.id)))
+	defer span.End()
+
+	request, err := http.NewRequest(http.MethodPost, appUrls.connected(), nil)
+	if err != nil {
+		logger.Error().Msgf("failed to create request object: %v", err)
+		recordSpanError(span, err)
+		return
+	}
+	appConn.setHeaders(request)
+	injectTraceContext(ctx, request.Header)
+
+	response, requestErr := appConn.httpClient.Do(request)
+	if requestErr != nil {
+		logger.Error().Msgf("failed to send request: %v", requestErr)
+		recordSpanError(span, requestErr)
+		return
+	}
+	defer cleanupResponse(response)
+	recordStatusCode(span, response.StatusCode)
+
+	if response.StatusCode != 200 {
+		logger.Info().Msgf("Received status code %d", response.StatusCode)
+		return
+	}
+}
+
+func handleClientDisconnected(ctx context.Context, appUrls applicationURLs, appConn *appConnection, logger zerolog.Logger) {
 	logger = logger.With().Str("method", "handleClientDisconnected").Str("appUrl", appUrls.disconnected()).Str(ConnectionIDKey, string(appConn.id)).Logger()
 
 	logger.Debug().Msg("BEGIN")
 
+	ctx, span := startSpan(ctx, "handleClientDisconnected", trace.SpanKindClient, connectionIdAttribute.String(string(appConn.id)))
+	defer span.End()
+
 	request, err := http.NewRequest(http.MethodPost, appUrls.disconnected(), nil)
 	if err != nil {
 		logger.Error().Msgf("failed to create request object: %v", err)
+		recordSpanError(span, err)
 		return
 	}
-	request.Header.Add(ConnectionIDHeaderKey, string(appConn.id))
+	appConn.setHeaders(request)
+	if len(appConn.disconnectReason) > 0 {
+		request.Header.Set(DisconnectReasonHeaderKey, appConn.disconnectReason)
+	}
+	injectTraceContext(ctx, request.Header)
 
 	response, requestErr := appConn.httpClient.Do(request)
 	if requestErr != nil {
 		logger.Error().Msgf("failed to send request: %v", requestErr)
+		recordSpanError(span, requestErr)
 		return
 	}
 	defer cleanupResponse(response)
+	recordStatusCode(span, response.StatusCode)
 
 	if response.StatusCode != 200 {
 		logger.Info().Msgf("Received status code %d", response.StatusCode)
@@ -130,37 +386,68 @@ func handleClientDisconnected(appUrls applicationURLs, appConn *appConnection, l
 	}
 }
 
-// Calls the `POST /ws/message-received` endpoint on the backend with "msg" and ConnectionIDKey
-func handleClientMessage(appConn *appConnection, appUrls applicationURLs) func(c context.Context, msg string) error {
-	return func(c context.Context, msg string) error {
+// Delivers "msg" to the application via the notifier and returns the function waiting for the frame to send back to
+// the client: the application's response to messages with a correlation-id and the error envelope in case of failures
+func handleClientMessage(appConn *appConnection, notifier AppNotifier, payloadLog *payloadLogger) onMgsReceivedFunc {
+	return func(c context.Context, msg string) func() string {
 		logger := zerolog.Ctx(c).With().Str(ConnectionIDKey, string(appConn.id)).Str("func", "handleClientMessage").Logger()
-		logger.Debug().Str("msg", msg).Send()
-
-		request, err := http.NewRequest(
-			http.MethodPost,
-			appUrls.message(),
-			bytes.NewReader([]byte(msg)),
-		)
-		if err != nil {
-			logger.Error().Msgf("failed to create request object: %v", err)
-			return err
+		if loggedMsg, logMsg := payloadLog.payload(msg); logMsg {
+			logger.Debug().Str("msg", loggedMsg).Send()
 		}
-		request.Header.Add(ConnectionIDHeaderKey, string(appConn.id))
 
-		response, requestErr := appConn.httpClient.Do(request)
-		if requestErr != nil {
-			logger.Error().Msgf("failed to send request: %v", requestErr)
-			return requestErr
-		}
-		defer cleanupResponse(response)
+		correlationId := correlationIdOf(msg)
 
-		if response.StatusCode != 200 {
-			logger.Info().Msgf("Received status code %d", response.StatusCode)
-			return fmt.Errorf("probelm while sending message to application")
+		ctx, span := startSpan(c, "handleClientMessage", trace.SpanKindClient, connectionIdAttribute.String(string(appConn.id)))
+
+		awaitResult := notifier.message(logger.WithContext(ctx), appConn, correlationId, msg)
+		return func() string {
+			defer span.End()
+			result := awaitResult()
+			if result.errorCode != "" {
+				span.SetStatus(codes.Error, result.errorMessage)
+			} else if result.status != 0 {
+				recordStatusCode(span, result.status)
+			}
+			return result.frame(correlationId)
 		}
+	}
+}
 
-		return nil
+// sendClientMessage calls the `POST /ws/message` endpoint of the application with "msg"
+func sendClientMessage(ctx context.Context, appConn *appConnection, appUrls applicationURLs, correlationId string, msg string, logger zerolog.Logger) appResult {
+	request, err := http.NewRequest(
+		http.MethodPost,
+		appUrls.message(),
+		bytes.NewReader([]byte(msg)),
+	)
+	if err != nil {
+		logger.Error().Msgf("failed to create request object: %v", err)
+		return appResult{errorCode: internalErrorCode, errorMessage: "failed to relay message to application"}
+	}
+	appConn.setHeaders(request)
+	if len(correlationId) > 0 {
+		request.Header.Set(CorrelationIDHeaderKey, correlationId)
+	}
+	injectTraceContext(ctx, request.Header)
+
+	response, requestErr := appConn.httpClient.Do(request)
+	if requestErr != nil {
+		logger.Error().Msgf("failed to send request: %v", requestErr)
+		return appResult{errorCode: appUnreachableErrorCode, errorMessage: "failed to send message to application"}
 	}
+	defer cleanupResponse(response)
+
+	body, readErr := readReplyBody(response)
+	if readErr != nil {
+		logger.Error().Msgf("failed to read response: %v", readErr)
+		return appResult{errorCode: appUnreachableErrorCode, errorMessage: "failed to read application's response"}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		logger.Info().Msgf("Received status code %d", response.StatusCode)
+	}
+
+	return appResult{status: response.StatusCode, body: body}
 }
 
 func sendMessageToClient(ctx context.Context, wsconn *websocket.Conn, obj any) error {
@@ -179,44 +466,114 @@ func sendMessageToClient(ctx context.Context, wsconn *websocket.Conn, obj any) e
 // then notifies the application of the new WS connection
 func connectHandler(
 	appUrls applicationURLs,
+	notifier AppNotifier,
 	ws *wsConnections,
-	loadBalancerAddress string,
+	origins *originPolicy,
 	createConnectionId func() ConnectionID,
 	clusterSupport *ClusterSupport,
+	clientAuth *clientAuthenticator,
+	forwarding *connectForwarding,
+	presence *presenceTracker,
+	payloadLog *payloadLogger,
+	subprotocols []string,
+	limiter *connectionLimiter,
+	audit *auditLog,
 ) gin.HandlerFunc {
 	return func(g *gin.Context) {
-		appConn := handleClientConnecting(createConnectionId, appUrls)(g)
+		if originErr := origins.checkAnyTenant(g.Request); originErr != nil {
+			rejectOrigin(g, originErr)
+			return
+		}
+
+		clientIP := g.ClientIP()
+		if limitErr := limiter.admit(clientIP); limitErr != nil {
+			rejectOverLimit(g, limitErr)
+			return
+		}
+
+		appConn := handleClientConnecting(createConnectionId, appUrls, clientAuth, forwarding, subprotocols, audit, payloadLog)(g)
 
 		if appConn == nil {
+			limiter.release(clientIP, "")
+			connectsCounter.WithLabelValues(connectFailureResult(g.Writer.Status())).Inc()
+			return
+		}
+
+		if originErr := origins.checkTenant(g.Request, appConn.tenantId); originErr != nil {
+			limiter.release(clientIP, "")
+			rejectOrigin(g, originErr)
+			revokeAcceptance(g.Request.Context(), notifier, appConn, OriginNotAllowedReason)
 			return
 		}
 
-		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "authentication handler").Str(ConnectionIDKey, string(appConn.id)).Logger()
+		if limitErr := limiter.admitUser(appConn.userId); limitErr != nil {
+			limiter.release(clientIP, "")
+			rejectOverLimit(g, limitErr)
+			revokeAcceptance(g.Request.Context(), notifier, appConn, ConnectionLimitReason)
+			return
+		}
+
+		// The connection is known from now on: debug logging may be enabled for it (or its user)
+		connectionLogger := logging.ForTargets(
+			*zerolog.Ctx(g.Request.Context()),
+			logging.Target{Kind: logging.ConnectionTarget, ID: string(appConn.id)},
+			logging.Target{Kind: logging.UserTarget, ID: appConn.userId},
+		)
+		g.Request = g.Request.WithContext(connectionLogger.WithContext(g.Request.Context()))
+
+		logger := connectionLogger.With().Str("method", "authentication handler").Str(ConnectionIDKey, string(appConn.id)).Logger()
 
 		// logger = logger.().Str("method", "connectHandler").Str(ConnectionIDKey, string(appConn.id)).Logger()
 
-		wsConn, subsErr := websocket.Accept(g.Writer, g.Request, &websocket.AcceptOptions{
-			OriginPatterns: []string{loadBalancerAddress},
-		})
+		acceptOptions := &websocket.AcceptOptions{
+			// the origin has been checked against the origin policy already
+			InsecureSkipVerify: true,
+		}
+		if len(appConn.subprotocol) > 0 {
+			acceptOptions.Subprotocols = []string{appConn.subprotocol}
+		}
+		wsConn, subsErr := websocket.Accept(g.Writer, g.Request, acceptOptions)
 		if subsErr != nil {
+			limiter.release(clientIP, appConn.userId)
 			logger.Error().Msgf("Failed to accept WS connection request: %v", subsErr)
+			connectsCounter.WithLabelValues("failed").Inc()
 			_ = g.Error(subsErr)
 			g.AbortWithStatus(500)
 			return
 		}
 
+		connectsCounter.WithLabelValues("accepted").Inc()
+		connectedAt := time.Now()
+		client := clientInfo{remoteAddress: clientIP, userAgent: g.Request.UserAgent(), metadata: appConn.metadata, subprotocol: appConn.subprotocol}
+		audit.connected(appConn, client)
+
 		var wsClosedError error
 		defer func() {
-			wsConn.Close(websocket.StatusNormalClosure, "")
+			limiter.release(clientIP, appConn.userId)
+
+			var closedByBackend *closedByBackendError
+			if errors.Is(wsClosedError, errMaxLifetimeReached) {
+				wsConn.Close(websocket.StatusGoingAway, errMaxLifetimeReached.Error())
+			} else if errors.As(wsClosedError, &closedByBackend) {
+				wsConn.Close(closedByBackend.code, closedByBackend.reason)
+				appConn.disconnectReason = ClosedByAppReason
+			} else {
+				wsConn.Close(websocket.StatusNormalClosure, "")
+			}
 
-			handleClientDisconnected(appUrls, appConn, logger)
+			disconnectsCounter.WithLabelValues(disconnectReason(wsClosedError)).Inc()
+			audit.disconnected(appConn, disconnectReason(wsClosedError), connectedAt)
+			notifier.disconnected(logger.WithContext(g.Request.Context()), appConn)
 
 			if clusterSupport != nil {
-				clusterSupport.deregisterConnection(g.Request.Context(), appConn.id)
+				clusterSupport.deregisterConnection(g.Request.Context(), appConn.id, appConn.userId)
+			}
+			if presence != nil && len(appConn.userId) > 0 {
+				presence.disconnected(logger.WithContext(g.Request.Context()), appConn.userId)
 			}
 
 			if wsClosedError != nil {
-				if errors.Is(wsClosedError, context.Canceled) {
+				if errors.Is(wsClosedError, context.Canceled) || errors.Is(wsClosedError, errMaxLifetimeReached) || closedByBackend != nil {
 					return // Done
 				}
 
@@ -230,7 +587,10 @@ func connectHandler(
 		}()
 
 		if clusterSupport != nil {
-			clusterSupport.registerConnection(g.Request.Context(), appConn.id)
+			clusterSupport.registerConnection(g.Request.Context(), appConn.id, appConn.userId)
+		}
+		if presence != nil && len(appConn.userId) > 0 {
+			presence.connected(logger.WithContext(g.Request.Context()), appConn.userId)
 		}
 
 		ackErr := sendMessageToClient(g.Request.Context(), wsConn, map[string]string{ConnectionIDKey: string(appConn.id)})
@@ -240,20 +600,95 @@ func connectHandler(
 			return
 		}
 
+		if appConn.welcome != nil {
+			welcomeErr := wsConn.Write(g.Request.Context(), websocket.MessageText, appConn.welcome)
+			if welcomeErr != nil {
+				logger.Error().Err(welcomeErr).Msg("failed to send welcome message")
+				wsClosedError = welcomeErr
+				return
+			}
+		}
+
+		notifier.connected(logger.WithContext(g.Request.Context()), appConn)
+
 		logger.Debug().Msg("websocket message processing about to start...")
 
-		wsClosedError = ws.processMessages(g.Request.Context(), appConn.id, &wsIOAdapter{wsConn}, handleClientMessage(appConn, appUrls)) // we block here until Error or Done
+		wsClosedError = ws.processMessages(g.Request.Context(), appConn.id, clientIdentity{userId: appConn.userId, tenantId: appConn.tenantId}, client, &wsIOAdapter{wsConn}, handleClientMessage(appConn, notifier, payloadLog), appConn.options) // we block here until Error or Done
 
 		logger.Debug().Msgf("websocket message processing finished with %v", wsClosedError)
 	}
 }
 
-func pushHandler(authenticateBackend func(c *gin.Context) error, ws *wsConnections, clusterSupport *ClusterSupport) gin.HandlerFunc {
+// revokeAcceptance notifies the application, if it accepted the connection request, of the connection being rejected
+// by the proxy nonetheless, as of a disconnection
+func revokeAcceptance(ctx context.Context, notifier AppNotifier, appConn *appConnection, reason string) {
+	if appConn.notifyApp {
+		return // the application hasn't learnt of the connection
+	}
+	appConn.disconnectReason = reason
+	// The client isn't kept waiting for the rejection, which outlives the request
+	go notifier.disconnected(context.WithoutCancel(ctx), appConn)
+}
+
+// rejectOrigin rejects a connection request from an origin the origin policy doesn't allow
+func rejectOrigin(g *gin.Context, originErr error) {
+	logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "rejectOrigin").Logger()
+	logger.Warn().Err(originErr).Str("host", g.Request.Host).Msg("connection request rejected for its origin")
+
+	originRejectionsCounter.Inc()
+	connectsCounter.WithLabelValues("rejected").Inc()
+	g.AbortWithStatus(http.StatusForbidden)
+}
+
+// rejectOverLimit rejects a connection request exceeding a connection limit
+func rejectOverLimit(g *gin.Context, limitErr *connectionLimitError) {
+	logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "rejectOverLimit").Logger()
+	logger.Info().Str("clientIP", g.ClientIP()).Msg(limitErr.Error())
+
+	connectionLimitRejectionsCounter.WithLabelValues(limitErr.limit).Inc()
+	connectsCounter.WithLabelValues("rejected").Inc()
+	g.AbortWithStatus(limitErr.statusCode())
+}
+
+// connectFailureResult tells rejected connection requests from failed ones by the status of the response
+func connectFailureResult(status int) string {
+	if status >= 400 && status < 500 {
+		return "rejected"
+	}
+	return "failed"
+}
+
+// disconnectReason classifies the error the processing of the connection's messages finished with
+func disconnectReason(wsClosedError error) string {
+	var closedByBackend *closedByBackendError
+	switch {
+	case wsClosedError == nil:
+		return clientClosedDisconnectReason
+	case errors.As(wsClosedError, &closedByBackend):
+		return closedByAppDisconnectReason
+	case errors.Is(wsClosedError, errMaxLifetimeReached):
+		return maxLifetimeDisconnectReason
+	case errors.Is(wsClosedError, context.Canceled):
+		return canceledDisconnectReason
+	}
+	switch websocket.CloseStatus(wsClosedError) {
+	case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+		return clientClosedDisconnectReason
+	}
+	return errorDisconnectReason
+}
+
+func pushHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
 	return func(g *gin.Context) {
 		connectionIdStr := g.Param(connIdPathParamName)
 
 		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "pushHandler").Str(ConnectionIDKey, connectionIdStr).Logger()
 
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
 		if connectionIdStr == "" {
 			logger.Info().Msgf("Missing path param: %s", connIdPathParamName)
 			g.AbortWithStatus(http.StatusBadRequest)
@@ -270,15 +705,27 @@ func pushHandler(authenticateBackend func(c *gin.Context) error, ws *wsConnectio
 
 		bodyAsString := string(requestBody)
 
-		errPush := ws.push(g.Request.Context(), bodyAsString, ConnectionID(connectionIdStr))
-		if errPush == errConnectionNotFound {
-			if clusterSupport == nil {
-				logger.Info().Msg("Web-socket connection not found")
-				g.AbortWithStatus(http.StatusNotFound)
-				return
-			}
-			logger.Info().Msgf("Connection '%s' isn't managed here, publishing payload...", connectionIdStr)
-			errPush = clusterSupport.relayMessage(g.Request.Context(), ConnectionID(connectionIdStr), bodyAsString)
+		ctx, span := startSpan(
+			extractTraceContext(backendRequestContext(g), g.Request.Header),
+			"push",
+			trace.SpanKindServer,
+			connectionIdAttribute.String(connectionIdStr),
+		)
+		defer span.End()
+
+		errPush := service.push(ctx, ConnectionID(connectionIdStr), bodyAsString)
+		if errPush != nil && !errors.Is(errPush, errConnectionNotFound) {
+			recordSpanError(span, errPush)
+		}
+		if errors.Is(errPush, errConnectionNotFound) {
+			logger.Info().Msg("Web-socket connection not found")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if errors.Is(errPush, errPushTimedOut) {
+			logger.Info().Err(errPush).Msg("Web-socket connection too slow to take the message in time")
+			g.AbortWithStatus(http.StatusServiceUnavailable)
+			return
 		}
 
 		if errPush != nil {
@@ -291,6 +738,338 @@ func pushHandler(authenticateBackend func(c *gin.Context) error, ws *wsConnectio
 	}
 }
 
+// publishHandler delivers the message in the request body to the subscribers of the topic
+func publishHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		topic := g.Param(topicPathParamName)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "publishHandler").Str("topic", topic).Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		if topic == "" {
+			logger.Info().Msgf("Missing path param: %s", topicPathParamName)
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		requestBody, errReadRequest := io.ReadAll(g.Request.Body)
+		g.Request.Body.Close()
+		if errReadRequest != nil {
+			logger.Error().Msgf("failed to read request body %T: %v", g.Request.Body, errReadRequest)
+			g.JSON(500, nil)
+			return
+		}
+
+		if errPublish := service.publish(g.Request.Context(), topic, string(requestBody)); errPublish != nil {
+			logger.Error().Msgf("Failed to publish to topic %s: %v", topic, errPublish)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// closeConnectionBody is the optional JSON body of the requests to close connections
+type closeConnectionBody struct {
+	// Code is the web-socket close status code. Defaults to 1000 (normal closure).
+	Code   int    `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Message is sent to the client before the connection is closed
+	Message string `json:"message,omitempty"`
+}
+
+func newCloseConnectionBody(request closeRequest) closeConnectionBody {
+	return closeConnectionBody{Code: int(request.code), Reason: request.reason, Message: request.finalMessage}
+}
+
+// bindCloseRequest parses the optional JSON body of the request to close connections
+func bindCloseRequest(g *gin.Context) (closeRequest, error) {
+	body := closeConnectionBody{}
+	if g.Request.ContentLength != 0 {
+		if bindErr := g.ShouldBindJSON(&body); bindErr != nil {
+			return closeRequest{}, fmt.Errorf("invalid body: %w", bindErr)
+		}
+	}
+	return newCloseRequest(body.Code, body.Reason, body.Message)
+}
+
+// newCloseRequest validates the close status (the code defaulting to 1000)
+func newCloseRequest(code int, reason string, finalMessage string) (closeRequest, error) {
+	if code == 0 {
+		code = int(websocket.StatusNormalClosure)
+	}
+	// Codes reserved for reporting failures of the transport itself (1004-1006, 1015) can't be sent
+	validCode := (code >= 1000 && code <= 1003) || (code >= 1007 && code <= 1014) || (code >= 3000 && code <= 4999)
+	if !validCode {
+		return closeRequest{}, fmt.Errorf("invalid close code: %d", code)
+	}
+	if len(reason) > maxCloseReasonSize {
+		return closeRequest{}, fmt.Errorf("close reason longer than %d bytes", maxCloseReasonSize)
+	}
+	return closeRequest{code: websocket.StatusCode(code), reason: reason, finalMessage: finalMessage}, nil
+}
+
+// closeConnectionHandler closes the connection, optionally with the close status and final message in the request body
+func closeConnectionHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		connectionIdStr := g.Param(connIdPathParamName)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "closeConnectionHandler").Str(ConnectionIDKey, connectionIdStr).Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		request, requestErr := bindCloseRequest(g)
+		if requestErr != nil {
+			logger.Info().Err(requestErr).Msg("invalid close request")
+			g.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": requestErr.Error()})
+			return
+		}
+
+		errClose := service.closeConnection(backendRequestContext(g), ConnectionID(connectionIdStr), request)
+		if errors.Is(errClose, errConnectionNotFound) {
+			logger.Info().Msg("Web-socket connection not found")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if errClose != nil {
+			logger.Error().Msgf("Failed to close connection %s: %v", connectionIdStr, errClose)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// closeUserConnectionsHandler closes every connection of the user and responds with their number
+func closeUserConnectionsHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		userId := g.Param(userIdPathParamName)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "closeUserConnectionsHandler").Str("userId", userId).Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		request, requestErr := bindCloseRequest(g)
+		if requestErr != nil {
+			logger.Info().Err(requestErr).Msg("invalid close request")
+			g.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": requestErr.Error()})
+			return
+		}
+
+		closedCount, errClose := service.closeUserConnections(backendRequestContext(g), userId, request)
+		if errClose != nil {
+			logger.Error().Msgf("Failed to close the connections of user %s: %v", userId, errClose)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.JSON(http.StatusOK, gin.H{"closed": closedCount})
+	}
+}
+
+// The maximum number of users whose presence can be queried at once
+const maxPresenceQuerySize = 1000
+
+// presenceHandler responds with the presence of the user
+func presenceHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		userId := g.Param(userIdPathParamName)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "presenceHandler").Str("userId", userId).Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		presences, presenceErr := service.presence(g.Request.Context(), []string{userId})
+		if presenceErr != nil {
+			logger.Error().Msgf("Failed to get the presence of user %s: %v", userId, presenceErr)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.JSON(http.StatusOK, presences[0])
+	}
+}
+
+// bulkPresenceQuery is the body of the requests for the presence of several users
+type bulkPresenceQuery struct {
+	UserIDs []string `json:"userIds"`
+}
+
+// bulkPresenceHandler responds with the presence of the users listed in the request body
+func bulkPresenceHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "bulkPresenceHandler").Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		query := bulkPresenceQuery{}
+		if bindErr := g.ShouldBindJSON(&query); bindErr != nil {
+			logger.Info().Err(bindErr).Msg("invalid presence query")
+			g.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body: %v", bindErr)})
+			return
+		}
+		if len(query.UserIDs) > maxPresenceQuerySize {
+			g.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("more than %d user ids", maxPresenceQuerySize)})
+			return
+		}
+
+		presences, presenceErr := service.presence(g.Request.Context(), query.UserIDs)
+		if presenceErr != nil {
+			logger.Error().Msgf("Failed to get the presence of users: %v", presenceErr)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.JSON(http.StatusOK, gin.H{"presence": presences})
+	}
+}
+
+// getConnectionHandler responds with the details of the connection
+func getConnectionHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		connectionIdStr := g.Param(connIdPathParamName)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "getConnectionHandler").Str(ConnectionIDKey, connectionIdStr).Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		info, infoErr := service.connectionInfo(backendRequestContext(g), ConnectionID(connectionIdStr))
+		if errors.Is(infoErr, errConnectionNotFound) {
+			logger.Info().Msg("Web-socket connection not found")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if infoErr != nil {
+			logger.Error().Msgf("Failed to get connection %s: %v", connectionIdStr, infoErr)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.JSON(http.StatusOK, info)
+	}
+}
+
+// listConnectionsHandler responds with the page of the connections selected by the query parameters
+func listConnectionsHandler(authenticateBackend func(c *gin.Context) error, service *backendService) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "listConnectionsHandler").Logger()
+
+		if authErr := authenticateBackend(g); authErr != nil {
+			abortWithBackendAuthError(g, authErr)
+			return
+		}
+
+		ctx := backendRequestContext(g)
+		filter, page, queryErr := parseConnectionQuery(g.Request.URL.Query(), isRelayed(ctx))
+		if queryErr != nil {
+			logger.Info().Err(queryErr).Msg("invalid connection query")
+			g.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": queryErr.Error()})
+			return
+		}
+
+		list, listErr := service.listConnections(ctx, filter, page)
+		if listErr != nil {
+			logger.Error().Msgf("Failed to list connections: %v", listErr)
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.JSON(http.StatusOK, list)
+	}
+}
+
+const (
+	defaultConnectionPageSize = 100
+	maxConnectionPageSize     = 1000
+)
+
+// parseConnectionQuery parses the filter and the page of the connections to list.
+// The page size of requests relayed by other instances isn't limited.
+func parseConnectionQuery(query url.Values, relayed bool) (connectionFilter, connectionPage, error) {
+	filter := connectionFilter{
+		userId:   query.Get("userId"),
+		tenantId: query.Get("tenantId"),
+		node:     query.Get("node"),
+		topic:    query.Get("topic"),
+	}
+	for param, age := range map[string]*time.Duration{"minAge": &filter.minAge, "maxAge": &filter.maxAge} {
+		if value := query.Get(param); len(value) > 0 {
+			parsed, parseErr := time.ParseDuration(value)
+			if parseErr != nil || parsed < 0 {
+				return connectionFilter{}, connectionPage{}, fmt.Errorf("invalid %s: %q", param, value)
+			}
+			*age = parsed
+		}
+	}
+
+	page := connectionPage{limit: defaultConnectionPageSize}
+	for param, value := range map[string]*int{"limit": &page.limit, "offset": &page.offset} {
+		if raw := query.Get(param); len(raw) > 0 {
+			parsed, parseErr := strconv.Atoi(raw)
+			if parseErr != nil || parsed < 0 {
+				return connectionFilter{}, connectionPage{}, fmt.Errorf("invalid %s: %q", param, raw)
+			}
+			*value = parsed
+		}
+	}
+	if page.limit > maxConnectionPageSize && !relayed {
+		return connectionFilter{}, connectionPage{}, fmt.Errorf("limit exceeds %d", maxConnectionPageSize)
+	}
+	return filter, page, nil
+}
+
+// connectionQuery is the inverse of parseConnectionQuery
+func connectionQuery(filter connectionFilter, page connectionPage) url.Values {
+	query := url.Values{}
+	for param, value := range map[string]string{"userId": filter.userId, "tenantId": filter.tenantId, "node": filter.node, "topic": filter.topic} {
+		if len(value) > 0 {
+			query.Set(param, value)
+		}
+	}
+	if filter.minAge > 0 {
+		query.Set("minAge", filter.minAge.String())
+	}
+	if filter.maxAge > 0 {
+		query.Set("maxAge", filter.maxAge.String())
+	}
+	query.Set("limit", strconv.Itoa(page.limit))
+	if page.offset > 0 {
+		query.Set("offset", strconv.Itoa(page.offset))
+	}
+	return query
+}
+
+// backendRequestContext returns the context of the back-end API request, marked if the request was relayed by another
+// instance (as authenticated by the relay secret)
+func backendRequestContext(g *gin.Context) context.Context {
+	ctx := withBackendIdentity(g.Request.Context(), g.GetString(backendIdentityContextKey))
+	if g.GetBool(relayedRequestContextKey) {
+		return relayedContext(ctx)
+	}
+	return ctx
+}
+
 func cleanupResponse(response *http.Response) {
 	_, _ = io.Copy(io.Discard, response.Body)
 	response.Body.Close()
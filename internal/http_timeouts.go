@@ -0,0 +1,81 @@
+package wsproxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultPushTimeout       = 30 * time.Second
+	defaultRequestTimeout    = 30 * time.Second
+	// relayTimeoutMargin leaves the instance a request is relayed to the time to respond once its deadline is up
+	relayTimeoutMargin = 5 * time.Second
+)
+
+// newHTTPServer returns a server of "handler" with the configured timeouts.
+// No read or write timeout is set on the server: it would apply to the web-socket connections it upgrades and to the
+// requests blocked waiting for slow connections. The routes needing one set their own (see requestDeadline).
+func newHTTPServer(handler http.Handler, conf config.HTTPTimeoutsConfig) *http.Server {
+	readHeaderTimeout := conf.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	idleTimeout := conf.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+func pushTimeout(conf config.HTTPTimeoutsConfig) time.Duration {
+	if conf.PushTimeout == 0 {
+		return defaultPushTimeout
+	}
+	return conf.PushTimeout
+}
+
+func requestTimeout(conf config.HTTPTimeoutsConfig) time.Duration {
+	if conf.RequestTimeout == 0 {
+		return defaultRequestTimeout
+	}
+	return conf.RequestTimeout
+}
+
+// relayTimeout bounds the requests relayed to other instances, which apply the deadlines of the routes relayed to
+func relayTimeout(conf config.HTTPTimeoutsConfig) time.Duration {
+	return max(pushTimeout(conf), requestTimeout(conf)) + relayTimeoutMargin
+}
+
+// requestDeadline bounds the time the requests of a route may take: reading the request, processing it (via the
+// deadline of the request's context) and writing the response
+func requestDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		deadline := time.Now().Add(timeout)
+
+		controller := http.NewResponseController(g.Writer)
+		// not every response writer supports deadlines: the context's deadline applies regardless
+		_ = controller.SetReadDeadline(deadline)
+		_ = controller.SetWriteDeadline(deadline)
+		defer func() {
+			// the connection may be kept alive for other requests
+			_ = controller.SetReadDeadline(time.Time{})
+			_ = controller.SetWriteDeadline(time.Time{})
+		}()
+
+		ctx, cancel := context.WithDeadline(g.Request.Context(), deadline)
+		defer cancel()
+		g.Request = g.Request.WithContext(ctx)
+
+		g.Next()
+	}
+}
@@ -0,0 +1,72 @@
+package wsproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"wsproxy/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+var errNoBearerToken = errors.New("no bearer token")
+
+var supportedSigningAlgs = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+}
+
+type jwtVerifier struct {
+	verifier *oidc.IDTokenVerifier
+}
+
+// newJWTVerifier creates a verifier checking the signature (using the keys published at the JWKS URL),
+// the expiry, the issuer and -- if configured -- the audience of tokens.
+// The keys are cached and refetched when a token signed with an unknown key shows up, so key rotation is supported.
+func newJWTVerifier(ctx context.Context, conf config.JWTConfig) *jwtVerifier {
+	keySet := oidc.NewRemoteKeySet(ctx, conf.JWKSURL)
+	return &jwtVerifier{
+		verifier: oidc.NewVerifier(conf.Issuer, keySet, &oidc.Config{
+			ClientID:             conf.Audience,
+			SkipClientIDCheck:    len(conf.Audience) == 0,
+			SupportedSigningAlgs: supportedSigningAlgs,
+		}),
+	}
+}
+
+// verify returns the claims of the token if it is valid
+func (v *jwtVerifier) verify(ctx context.Context, rawToken string) (map[string]any, error) {
+	token, verifyErr := v.verifier.Verify(ctx, rawToken)
+	if verifyErr != nil {
+		return nil, fmt.Errorf("invalid token: %w", verifyErr)
+	}
+	claims := map[string]any{}
+	if claimsErr := token.Claims(&claims); claimsErr != nil {
+		return nil, fmt.Errorf("failed to parse token claims: %w", claimsErr)
+	}
+	return claims, nil
+}
+
+func bearerToken(header http.Header) (string, error) {
+	scheme, token, found := strings.Cut(header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || len(token) == 0 {
+		return "", errNoBearerToken
+	}
+	return token, nil
+}
+
+// claimAsString returns the value of the claim as string if it is a string or a number
+func claimAsString(claims map[string]any, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
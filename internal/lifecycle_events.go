@@ -0,0 +1,82 @@
+package wsproxy
+
+import (
+	"sync"
+	"time"
+)
+
+// The number of events buffered per subscriber; events to subscribers lagging further behind are dropped
+const lifecycleEventBufferSize = 64
+
+type lifecycleEvent struct {
+	eventType    appEventType
+	connectionId ConnectionID
+	identity     clientIdentity
+	time         time.Time
+}
+
+// lifecycleEventJSON is the form of the lifecycle events the instances of a cluster share
+type lifecycleEventJSON struct {
+	Type         appEventType `json:"type"`
+	ConnectionID ConnectionID `json:"connectionId"`
+	UserID       string       `json:"userId,omitempty"`
+	TenantID     string       `json:"tenantId,omitempty"`
+	Time         time.Time    `json:"time"`
+}
+
+func (event lifecycleEvent) toJSON() lifecycleEventJSON {
+	return lifecycleEventJSON{
+		Type:         event.eventType,
+		ConnectionID: event.connectionId,
+		UserID:       event.identity.userId,
+		TenantID:     event.identity.tenantId,
+		Time:         event.time,
+	}
+}
+
+func (event lifecycleEventJSON) toEvent() lifecycleEvent {
+	return lifecycleEvent{
+		eventType:    event.Type,
+		connectionId: event.ConnectionID,
+		identity:     clientIdentity{userId: event.UserID, tenantId: event.TenantID},
+		time:         event.Time,
+	}
+}
+
+// lifecycleEvents fans out lifecycle events to its subscribers: those of the connections served by this instance or,
+// in a cluster, those shared by all instances (see ClusterSupport.shareLifecycleEvents)
+type lifecycleEvents struct {
+	mux         sync.Mutex
+	subscribers map[chan lifecycleEvent]struct{}
+}
+
+func newLifecycleEvents() *lifecycleEvents {
+	return &lifecycleEvents{subscribers: make(map[chan lifecycleEvent]struct{})}
+}
+
+// subscribe returns the channel of the events and the function to call when no more events are needed
+func (e *lifecycleEvents) subscribe() (<-chan lifecycleEvent, func()) {
+	events := make(chan lifecycleEvent, lifecycleEventBufferSize)
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.subscribers[events] = struct{}{}
+
+	return events, func() {
+		e.mux.Lock()
+		defer e.mux.Unlock()
+		delete(e.subscribers, events)
+	}
+}
+
+// publish never blocks
+func (e *lifecycleEvents) publish(event lifecycleEvent) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	for subscriber := range e.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// TargetKind is the kind of entity debug logging can be enabled for
+type TargetKind = string
+
+const (
+	ConnectionTarget TargetKind = "connection"
+	UserTarget       TargetKind = "user"
+)
+
+// Target is an entity a logger logs about
+type Target struct {
+	Kind TargetKind
+	ID   string
+}
+
+var (
+	// output is where every logger derived from Get writes to
+	output atomic.Pointer[io.Writer]
+	// level is the level of the events logged (unless debug logging is enabled for their target)
+	level atomic.Int32
+
+	debugTargetsMux sync.RWMutex
+	debugTargets    = map[TargetKind]map[string]struct{}{}
+)
+
+// SetOutput redirects every logger derived from Get to "w"
+func SetOutput(w io.Writer) {
+	Get()
+	output.Store(&w)
+}
+
+// Level returns the current log level
+func Level() zerolog.Level {
+	Get()
+	return zerolog.Level(level.Load())
+}
+
+// SetLevel changes the log level of every logger derived from Get
+func SetLevel(newLevel zerolog.Level) {
+	Get()
+	level.Store(int32(newLevel))
+	updateGlobalLevel()
+}
+
+// EnableDebug makes the loggers targeting the entity (see ForTargets) log at debug level regardless of the log level
+func EnableDebug(kind TargetKind, id string) {
+	debugTargetsMux.Lock()
+	if debugTargets[kind] == nil {
+		debugTargets[kind] = map[string]struct{}{}
+	}
+	debugTargets[kind][id] = struct{}{}
+	debugTargetsMux.Unlock()
+	updateGlobalLevel()
+}
+
+// DisableDebug reverts EnableDebug
+func DisableDebug(kind TargetKind, id string) {
+	debugTargetsMux.Lock()
+	delete(debugTargets[kind], id)
+	if len(debugTargets[kind]) == 0 {
+		delete(debugTargets, kind)
+	}
+	debugTargetsMux.Unlock()
+	updateGlobalLevel()
+}
+
+// DebugTargets returns the IDs of the entities of the kind debug logging is enabled for
+func DebugTargets(kind TargetKind) []string {
+	debugTargetsMux.RLock()
+	defer debugTargetsMux.RUnlock()
+
+	ids := make([]string, 0, len(debugTargets[kind]))
+	for id := range debugTargets[kind] {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// ForTargets returns "logger" logging at debug level while debug logging is enabled for any of the targets.
+// Targets with an empty ID are ignored.
+func ForTargets(logger zerolog.Logger, targets ...Target) zerolog.Logger {
+	targets = slices.DeleteFunc(slices.Clone(targets), func(target Target) bool { return len(target.ID) == 0 })
+	if len(targets) == 0 {
+		return logger
+	}
+	return logger.Output(targetedWriter{targets: targets})
+}
+
+func isDebugTarget(targets []Target) bool {
+	debugTargetsMux.RLock()
+	defer debugTargetsMux.RUnlock()
+
+	for _, target := range targets {
+		if _, enabled := debugTargets[target.Kind][target.ID]; enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// updateGlobalLevel lowers zerolog's global level to debug only while debug logging is enabled for some entity, so
+// that disabled debug events stay cheap otherwise
+func updateGlobalLevel() {
+	debugTargetsMux.RLock()
+	anyTarget := len(debugTargets) > 0
+	debugTargetsMux.RUnlock()
+
+	globalLevel := zerolog.Level(level.Load())
+	if anyTarget && globalLevel > zerolog.DebugLevel {
+		globalLevel = zerolog.DebugLevel
+	}
+	zerolog.SetGlobalLevel(globalLevel)
+}
+
+// targetedWriter writes the events at or above the log level, and the debug events of targets debug logging is
+// enabled for
+type targetedWriter struct {
+	targets []Target
+}
+
+func (w targetedWriter) Write(p []byte) (int, error) {
+	return (*output.Load()).Write(p)
+}
+
+func (w targetedWriter) WriteLevel(eventLevel zerolog.Level, p []byte) (int, error) {
+	if eventLevel < zerolog.Level(level.Load()) && (eventLevel < zerolog.DebugLevel || !isDebugTarget(w.targets)) {
+		return len(p), nil
+	}
+	return (*output.Load()).Write(p)
+}
@@ -51,10 +51,11 @@ func Get() zerolog.Logger {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		zerolog.TimeFieldFormat = time.RFC3339Nano
 
-		var output io.Writer = zerolog.ConsoleWriter{
+		var consoleOutput io.Writer = zerolog.ConsoleWriter{
 			Out:        os.Stdout,
 			TimeFormat: time.RFC3339,
 		}
+		output.Store(&consoleOutput)
 
 		isDevelopmentEnv := func() bool {
 			return os.Getenv("APP_ENV") == "development"
@@ -85,11 +86,13 @@ func Get() zerolog.Logger {
 		}
 
 		logLevel := parseLevel()
+		level.Store(int32(logLevel))
+		updateGlobalLevel()
 
 		fmt.Fprintf(os.Stderr, "default log-level: %v\n", logLevel)
 
-		logContext := zerolog.New(output).
-			Level(zerolog.Level(logLevel)).
+		// The level is enforced by the writer (see SetLevel) so that it can be changed at runtime
+		logContext := zerolog.New(targetedWriter{}).
 			With().
 			Timestamp().
 			Str("git_revision", gitRevision).
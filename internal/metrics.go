@@ -0,0 +1,163 @@
+package wsproxy
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const metricsNamespace = "wsproxy"
+
+// Disconnect reasons of the disconnects metric
+const (
+	clientClosedDisconnectReason = "client_closed"
+	closedByAppDisconnectReason  = "closed_by_app"
+	maxLifetimeDisconnectReason  = "max_lifetime"
+	// canceledDisconnectReason is that of the connections whose request was canceled (e.g. upon shutdown)
+	canceledDisconnectReason = "canceled"
+	errorDisconnectReason    = "error"
+)
+
+// metricsRegistry holds the metrics exposed at the admin listener's `/metrics` endpoint.
+// The metrics are shared by all servers of the process.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	activeConnectionsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_connections",
+		Help:      "Number of web-socket connections served.",
+	})
+	connectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "connects_total",
+		Help:      "Connection requests by result (accepted, rejected or failed).",
+	}, []string{"result"})
+	disconnectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "disconnects_total",
+		Help:      "Connections lost by reason.",
+	}, []string{"reason"})
+	messagesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "Messages received from (in) and sent to (out) clients.",
+	}, []string{"direction"})
+	messageBytesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "message_bytes_total",
+		Help:      "Size of the messages received from (in) and sent to (out) clients.",
+	}, []string{"direction"})
+	pushDurationHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "push_duration_seconds",
+		Help:      "Time taken to queue the messages pushed by back-ends (relaying included).",
+		Buckets:   prometheus.DefBuckets,
+	})
+	appCallbackDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "app_callback_duration_seconds",
+		Help:      "Duration of the calls to the application's endpoints.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+	appCallbackResponsesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "app_callback_responses_total",
+		Help:      "Responses of the application's endpoints by status code (\"error\" if the call failed).",
+	}, []string{"endpoint", "status"})
+	queueDepthHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "from_app_queue_depth",
+		Help:      "Number of messages waiting to be sent to the client, observed as messages are queued.",
+		Buckets:   []float64{0, 1, 2, 4, 8, 12, 16},
+	})
+	rateLimitRejectionsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Messages dropped because the connection exceeded its rate limit.",
+	})
+	originRejectionsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "origin_rejections_total",
+		Help:      "Connection requests rejected for their origin.",
+	})
+	connectionLimitRejectionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "connection_limit_rejections_total",
+		Help:      "Connection requests rejected by limit (instance, ip or user).",
+	}, []string{"limit"})
+	slowConnectionsClosedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "slow_connections_closed_total",
+		Help:      "Connections closed for being too slow to keep up with the messages.",
+	})
+	relaysCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relays_total",
+		Help:      "Requests relayed to other instances by response status code (\"error\" if the request failed).",
+	}, []string{"status"})
+	redisErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_errors_total",
+		Help:      "Failed Redis operations.",
+	}, []string{"operation"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		activeConnectionsGauge,
+		connectsCounter,
+		disconnectsCounter,
+		messagesCounter,
+		messageBytesCounter,
+		pushDurationHistogram,
+		appCallbackDurationHistogram,
+		appCallbackResponsesCounter,
+		queueDepthHistogram,
+		rateLimitRejectionsCounter,
+		originRejectionsCounter,
+		connectionLimitRejectionsCounter,
+		slowConnectionsClosedCounter,
+		relaysCounter,
+		redisErrorsCounter,
+	)
+}
+
+// countMessage records a message received from ("in") or sent to ("out") a client
+func countMessage(direction string, msg string) {
+	messagesCounter.WithLabelValues(direction).Inc()
+	messageBytesCounter.WithLabelValues(direction).Add(float64(len(msg)))
+}
+
+// countRedisError records a failed Redis operation
+func countRedisError(operation string) {
+	redisErrorsCounter.WithLabelValues(operation).Inc()
+}
+
+// appCallbackTransport records the duration and the outcome of the calls to the application's endpoints,
+// the endpoint being the last segment of the path (e.g. "message" for `POST /ws/message`)
+type appCallbackTransport struct{}
+
+func (appCallbackTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	endpoint := path.Base(request.URL.Path)
+	start := time.Now()
+	response, err := http.DefaultTransport.RoundTrip(request)
+	appCallbackDurationHistogram.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		appCallbackResponsesCounter.WithLabelValues(endpoint, "error").Inc()
+		return nil, err
+	}
+	appCallbackResponsesCounter.WithLabelValues(endpoint, strconv.Itoa(response.StatusCode)).Inc()
+	return response, nil
+}
+
+// newAppHTTPClient returns the client of the calls to the application's endpoints
+func newAppHTTPClient() http.Client {
+	return http.Client{Timeout: time.Second * 15, Transport: appCallbackTransport{}}
+}
@@ -0,0 +1,105 @@
+package wsproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"wsproxy/internal/config"
+)
+
+// originPolicy decides which web origins (`Origin` header) clients may connect from.
+// Requests without an origin (i.e. not from browsers) and from the proxy's own host are always allowed.
+// Patterns without a port match the origins of any port.
+type originPolicy struct {
+	insecureSkipVerify bool
+	patterns           []string
+	tenantPatterns     map[string][]string
+	// anyTenantPatterns are the patterns of all tenants, checked before the tenant of the client is known
+	anyTenantPatterns []string
+}
+
+// newOriginPolicy expects the patterns to have been validated by validateOriginPolicy
+func newOriginPolicy(conf config.OriginPolicyConfig) *originPolicy {
+	policy := &originPolicy{
+		insecureSkipVerify: conf.InsecureSkipVerify,
+		patterns:           lowerOriginPatterns(conf.AllowedOrigins),
+		tenantPatterns:     map[string][]string{},
+	}
+	for tenantId, patterns := range conf.TenantAllowedOrigins {
+		policy.tenantPatterns[tenantId] = lowerOriginPatterns(patterns)
+		policy.anyTenantPatterns = append(policy.anyTenantPatterns, policy.tenantPatterns[tenantId]...)
+	}
+	return policy
+}
+
+// validateOriginPolicy fails on the first malformed pattern
+func validateOriginPolicy(conf config.OriginPolicyConfig) error {
+	patterns := slices.Clone(conf.AllowedOrigins)
+	for _, tenantPatterns := range conf.TenantAllowedOrigins {
+		patterns = append(patterns, tenantPatterns...)
+	}
+	for _, pattern := range patterns {
+		if _, matchErr := filepath.Match(pattern, ""); matchErr != nil {
+			return fmt.Errorf("invalid origin pattern %q: %w", pattern, matchErr)
+		}
+	}
+	return nil
+}
+
+func lowerOriginPatterns(patterns []string) []string {
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		lowered = append(lowered, strings.ToLower(pattern))
+	}
+	return lowered
+}
+
+// checkAnyTenant fails if the origin of "request" isn't allowed for any tenant
+func (p *originPolicy) checkAnyTenant(request *http.Request) error {
+	return p.check(request, p.anyTenantPatterns)
+}
+
+// checkTenant fails if the origin of "request" isn't allowed for "tenantId"
+func (p *originPolicy) checkTenant(request *http.Request, tenantId string) error {
+	return p.check(request, p.tenantPatterns[tenantId])
+}
+
+func (p *originPolicy) check(request *http.Request, tenantPatterns []string) error {
+	if p.insecureSkipVerify {
+		return nil
+	}
+
+	origin := request.Header.Get("Origin")
+	if len(origin) == 0 {
+		return nil
+	}
+	originUrl, parseErr := url.Parse(origin)
+	if parseErr != nil {
+		return fmt.Errorf("failed to parse origin %q: %w", origin, parseErr)
+	}
+	if strings.EqualFold(request.Host, originUrl.Host) {
+		return nil
+	}
+
+	// The host is matched with and without its port
+	hosts := []string{strings.ToLower(originUrl.Host)}
+	if len(originUrl.Port()) > 0 {
+		hosts = append(hosts, strings.ToLower(originUrl.Hostname()))
+	}
+	scheme := strings.ToLower(originUrl.Scheme)
+	for _, pattern := range slices.Concat(p.patterns, tenantPatterns) {
+		for _, host := range hosts {
+			subject := host
+			if strings.Contains(pattern, "://") {
+				subject = scheme + "://" + host
+			}
+			if matched, _ := filepath.Match(pattern, subject); matched {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
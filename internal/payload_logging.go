@@ -0,0 +1,193 @@
+package wsproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"wsproxy/internal/config"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+
+	defaultPayloadLogMaxLength = 256
+)
+
+// payloadLogger controls what of the payloads and URLs is logged
+type payloadLogger struct {
+	// enabled tells whether payloads are logged at all
+	enabled     bool
+	mode        config.PayloadLogMode
+	maxLength   int
+	jsonPaths   [][]string
+	patterns    []*regexp.Regexp
+	queryParams map[string]struct{}
+}
+
+// validatePayloadLogging fails on an unknown payload logging mode or the first invalid redaction pattern
+func validatePayloadLogging(conf config.Config) error {
+	if conf.PayloadLogging != nil {
+		switch conf.PayloadLogging.Mode {
+		case "", config.TruncatePayloads, config.HashPayloads:
+		default:
+			return fmt.Errorf("invalid payload logging mode %q", conf.PayloadLogging.Mode)
+		}
+	}
+	for _, pattern := range conf.Redaction.Patterns {
+		if _, compileErr := regexp.Compile(pattern); compileErr != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", pattern, compileErr)
+		}
+	}
+	return nil
+}
+
+// newPayloadLogger leaves out the invalid redaction patterns, which validatePayloadLogging rejects at startup
+func newPayloadLogger(conf config.Config) *payloadLogger {
+	logger := &payloadLogger{
+		mode:        config.TruncatePayloads,
+		maxLength:   defaultPayloadLogMaxLength,
+		queryParams: map[string]struct{}{},
+	}
+
+	if conf.PayloadLogging != nil {
+		logger.enabled = true
+		if len(conf.PayloadLogging.Mode) > 0 {
+			logger.mode = conf.PayloadLogging.Mode
+		}
+		if conf.PayloadLogging.MaxLength > 0 {
+			logger.maxLength = conf.PayloadLogging.MaxLength
+		}
+	}
+
+	for _, path := range conf.Redaction.JSONPaths {
+		logger.jsonPaths = append(logger.jsonPaths, strings.Split(path, "."))
+	}
+	for _, pattern := range conf.Redaction.Patterns {
+		if compiled, compileErr := regexp.Compile(pattern); compileErr == nil {
+			logger.patterns = append(logger.patterns, compiled)
+		}
+	}
+
+	queryParams := conf.Redaction.QueryParams
+	if queryParams == nil {
+		queryParams = config.DefaultRedactedQueryParams
+	}
+	if conf.ClientJWT != nil && len(conf.ClientJWT.TokenQueryParam) > 0 {
+		queryParams = append(queryParams, conf.ClientJWT.TokenQueryParam)
+	}
+	for _, name := range queryParams {
+		logger.queryParams[strings.ToLower(name)] = struct{}{}
+	}
+
+	return logger
+}
+
+// payload returns what is to be logged of "payload" and whether it is to be logged at all
+func (p *payloadLogger) payload(payload string) (string, bool) {
+	if !p.enabled {
+		return "", false
+	}
+
+	if p.mode == config.HashPayloads {
+		hash := sha256.Sum256([]byte(payload))
+		return "sha256:" + hex.EncodeToString(hash[:]), true
+	}
+
+	redacted := p.redactPatterns(p.redactJSON(payload))
+	if len(redacted) <= p.maxLength {
+		return redacted, true
+	}
+	cut := p.maxLength
+	for cut > 0 && !utf8.RuneStart(redacted[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d bytes)", redacted[:cut], len(redacted)), true
+}
+
+// url returns the path and query of "u" with the values of sensitive query parameters masked
+func (p *payloadLogger) url(u *url.URL) string {
+	if len(u.RawQuery) == 0 {
+		return p.redactPatterns(u.RequestURI())
+	}
+
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		unescapedName, unescapeErr := url.QueryUnescape(name)
+		if unescapeErr != nil {
+			unescapedName = name
+		}
+		if _, sensitive := p.queryParams[strings.ToLower(unescapedName)]; sensitive {
+			params[i] = name + "=" + redactedValue
+		}
+	}
+	return p.redactPatterns(u.EscapedPath() + "?" + strings.Join(params, "&"))
+}
+
+// requestError returns "err" of sending a request with the URL it carries redacted as by url
+func (p *payloadLogger) requestError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return urlErr.Err
+	}
+	return fmt.Errorf("%s %q: %w", urlErr.Op, u.Host+p.url(u), urlErr.Err)
+}
+
+func (p *payloadLogger) redactPatterns(value string) string {
+	for _, pattern := range p.patterns {
+		value = pattern.ReplaceAllString(value, redactedValue)
+	}
+	return value
+}
+
+// redactJSON masks the values at the configured JSON paths if "payload" is JSON
+func (p *payloadLogger) redactJSON(payload string) string {
+	if len(p.jsonPaths) == 0 {
+		return payload
+	}
+	var document any
+	if unmarshalErr := json.Unmarshal([]byte(payload), &document); unmarshalErr != nil {
+		return payload
+	}
+	for _, path := range p.jsonPaths {
+		document = redactJSONPath(document, path)
+	}
+	redacted, marshalErr := json.Marshal(document)
+	if marshalErr != nil {
+		return payload
+	}
+	return string(redacted)
+}
+
+func redactJSONPath(node any, path []string) any {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	switch value := node.(type) {
+	case map[string]any:
+		for key, child := range value {
+			if path[0] == "*" || path[0] == key {
+				value[key] = redactJSONPath(child, path[1:])
+			}
+		}
+	case []any:
+		for i, element := range value {
+			if path[0] == "*" {
+				value[i] = redactJSONPath(element, path[1:])
+			} else {
+				value[i] = redactJSONPath(element, path)
+			}
+		}
+	}
+	return node
+}
@@ -0,0 +1,150 @@
+package wsproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultPresenceDebounce = 5 * time.Second
+
+// userPresence is whether a user is connected, as returned by the presence API
+type userPresence struct {
+	UserID string `json:"userId"`
+	Online bool   `json:"online"`
+	// Connections is the number of the user's connections across all instances
+	Connections int `json:"connections"`
+}
+
+// presenceStore keeps track of the presence of users as reported to the application
+type presenceStore interface {
+	// connected records the new connection of the user and returns whether the user has just come online
+	connected(ctx context.Context, userId string) (bool, error)
+	// disconnected records the loss of a connection of the user
+	disconnected(ctx context.Context, userId string) error
+	// wentOffline returns whether the user, having no connections left, has just gone offline
+	wentOffline(ctx context.Context, userId string) (bool, error)
+}
+
+// presenceTracker notifies the application of users coming online and going offline.
+// Users are reported offline only after having had no connections for the debounce period.
+type presenceTracker struct {
+	store    presenceStore
+	notifier AppNotifier
+	debounce time.Duration
+}
+
+func newPresenceTracker(conf *config.PresenceEventsConfig, clusterSupport *ClusterSupport, notifier AppNotifier) *presenceTracker {
+	if conf == nil {
+		return nil
+	}
+	debounce := conf.Debounce
+	if debounce <= 0 {
+		debounce = defaultPresenceDebounce
+	}
+	var store presenceStore = &localPresenceStore{connections: make(map[string]int), online: make(map[string]struct{})}
+	if clusterSupport != nil {
+		// The registry holds the connections of users across all instances
+		store = &clusterPresenceStore{cluster: clusterSupport}
+	}
+	return &presenceTracker{store: store, notifier: notifier, debounce: debounce}
+}
+
+// connected is to be called once the connection of the user is registered
+func (t *presenceTracker) connected(ctx context.Context, userId string) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "presenceTracker").Str("userId", userId).Logger()
+
+	cameOnline, storeErr := t.store.connected(ctx, userId)
+	if storeErr != nil {
+		logger.Error().Err(storeErr).Msg("failed to record the presence of user")
+		return
+	}
+	if cameOnline {
+		logger.Debug().Msg("user came online")
+		// The connection isn't held up by the application, which may learn of the user once the connection is gone
+		go t.notifier.presenceChanged(context.WithoutCancel(ctx), userId, true)
+	}
+}
+
+// disconnected is to be called once the connection of the user is deregistered
+func (t *presenceTracker) disconnected(ctx context.Context, userId string) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "presenceTracker").Str("userId", userId).Logger()
+
+	if storeErr := t.store.disconnected(ctx, userId); storeErr != nil {
+		logger.Error().Err(storeErr).Msg("failed to record the disconnection of user")
+		return
+	}
+	// The connection's context is done by the time the user is checked
+	ctx = context.WithoutCancel(ctx)
+	time.AfterFunc(t.debounce, func() {
+		wentOffline, storeErr := t.store.wentOffline(ctx, userId)
+		if storeErr != nil {
+			logger.Error().Err(storeErr).Msg("failed to record the absence of user")
+			return
+		}
+		if wentOffline {
+			logger.Debug().Msg("user went offline")
+			t.notifier.presenceChanged(ctx, userId, false)
+		}
+	})
+}
+
+// localPresenceStore keeps track of the presence of the users connected to this (only) instance
+type localPresenceStore struct {
+	mux         sync.Mutex
+	connections map[string]int
+	online      map[string]struct{}
+}
+
+func (s *localPresenceStore) connected(_ context.Context, userId string) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.connections[userId]++
+	if _, ok := s.online[userId]; ok {
+		return false, nil
+	}
+	s.online[userId] = struct{}{}
+	return true, nil
+}
+
+func (s *localPresenceStore) disconnected(_ context.Context, userId string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.connections[userId]--
+	if s.connections[userId] <= 0 {
+		delete(s.connections, userId)
+	}
+	return nil
+}
+
+func (s *localPresenceStore) wentOffline(_ context.Context, userId string) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.online[userId]; !ok || s.connections[userId] > 0 {
+		return false, nil
+	}
+	delete(s.online, userId)
+	return true, nil
+}
+
+// clusterPresenceStore keeps track of the presence of users in the registry, so that the changes are reported by
+// exactly one instance
+type clusterPresenceStore struct {
+	cluster *ClusterSupport
+}
+
+func (s *clusterPresenceStore) connected(ctx context.Context, userId string) (bool, error) {
+	return s.cluster.markUserOnline(ctx, userId)
+}
+
+// disconnected is a no-op: deregistering the connection removes it from the user's connections
+func (s *clusterPresenceStore) disconnected(context.Context, string) error {
+	return nil
+}
+
+func (s *clusterPresenceStore) wentOffline(ctx context.Context, userId string) (bool, error) {
+	return s.cluster.markUserOfflineIfDisconnected(ctx, userId)
+}
@@ -2,6 +2,8 @@ package wsproxy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,21 +15,48 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
 type EndpointPath string
 
 const (
 	ConnectPath     EndpointPath = "/connect"
+	ConnectedPath   EndpointPath = "/connected"
 	DisonnectedPath EndpointPath = "/disconnected"
 	MessagePath     EndpointPath = "/message"
+	MessagesPath    EndpointPath = "/messages"
+	PresencePath    EndpointPath = "/presence"
+	TopicPath       EndpointPath = "/topic"
+	ConnectionsPath EndpointPath = "/connections"
+	UsersPath       EndpointPath = "/users"
+	// RelayPath prefixes the endpoints serving the requests relayed by the other instances of the cluster
+	RelayPath EndpointPath = "/relay"
 )
 
 type Server struct {
-	Addr               string
+	Addr string
+	// PlainAddr is the address of the plain HTTP listener served alongside the TLS one (if any)
+	PlainAddr string
+	// GRPCAddr is the address of the gRPC listener (if any)
+	GRPCAddr string
+	// AdminAddr is the address of the admin listener (if any)
+	AdminAddr          string
+	grpcServer         *grpc.Server
+	adminServer        *http.Server
+	adminHandler       http.Handler
+	plainServer        *http.Server
+	tlsConfig          *tls.Config
+	adminTLSConfig     *tls.Config
+	grpcTLSConfig      *tls.Config
 	createConnectionId func() ConnectionID
 	clusterSupport     *ClusterSupport
-	server             http.Server
+	health             *healthChecker
+	limiter            *connectionLimiter
+	audit              *auditLog
+	notifier           AppNotifier
+	shutdownTracing    func(context.Context) error
+	server             *http.Server
 	configuration      config.Config
 	ctx                context.Context
 }
@@ -37,10 +66,15 @@ func NewServer(
 	configuration config.Config,
 	createConnectionId func() ConnectionID,
 ) *Server {
+	clusterSupport := NewClusterSupport(configuration)
+	limiter := newConnectionLimiter(configuration.ConnectionLimits)
 	return &Server{
 		configuration:      configuration,
 		createConnectionId: createConnectionId,
-		clusterSupport:     NewClusterSupport(configuration),
+		clusterSupport:     clusterSupport,
+		health:             newHealthChecker(configuration, clusterSupport, limiter),
+		limiter:            limiter,
+		audit:              newAuditLog(configuration.Audit),
 		ctx:                ctx,
 	}
 }
@@ -57,6 +91,26 @@ func (s *Server) start(r http.Handler, ready func(port int, stop func())) error
 	s.Addr = listener.Addr().String()
 	logger.Info().Msgf("wsproxy instance is listening at %s", s.Addr)
 
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+		logger.Info().Msg("serving TLS")
+
+		if s.configuration.PlainHTTP != nil {
+			plainListener, plainListenErr := net.Listen("tcp", fmt.Sprintf("%s:%d", s.configuration.ServerHost, s.configuration.PlainHTTP.Port))
+			if plainListenErr != nil {
+				panic(fmt.Sprintf("Error while starting the plain HTTP listener: %v", plainListenErr))
+			}
+			s.PlainAddr = plainListener.Addr().String()
+			s.plainServer = newHTTPServer(r, s.configuration.HTTPTimeouts)
+			logger.Info().Msgf("wsproxy instance is listening for plain HTTP at %s", s.PlainAddr)
+			go func() {
+				if serveErr := s.plainServer.Serve(plainListener); !errors.Is(serveErr, http.ErrServerClosed) {
+					logger.Error().Err(serveErr).Msg("plain HTTP server stopped")
+				}
+			}()
+		}
+	}
+
 	_, port, err := net.SplitHostPort(listener.Addr().String())
 	if err != nil {
 		panic(fmt.Sprintf("Error while parsing the server address: %v", err))
@@ -64,6 +118,38 @@ func (s *Server) start(r http.Handler, ready func(port int, stop func())) error
 
 	logger.Info().Msgf("Listening on port: %v", port)
 
+	if s.grpcServer != nil {
+		grpcListener, grpcListenErr := net.Listen("tcp", fmt.Sprintf("%s:%d", s.configuration.ServerHost, s.configuration.GRPC.Port))
+		if grpcListenErr != nil {
+			panic(fmt.Sprintf("Error while starting to listen for gRPC calls: %v", grpcListenErr))
+		}
+		s.GRPCAddr = grpcListener.Addr().String()
+		logger.Info().Msgf("wsproxy instance is listening for gRPC calls at %s", s.GRPCAddr)
+		go func() {
+			if serveErr := s.grpcServer.Serve(grpcListener); serveErr != nil {
+				logger.Error().Err(serveErr).Msg("gRPC server stopped")
+			}
+		}()
+	}
+
+	if s.configuration.Admin != nil {
+		adminListener, adminListenErr := net.Listen("tcp", fmt.Sprintf("%s:%d", s.configuration.ServerHost, s.configuration.Admin.Port))
+		if adminListenErr != nil {
+			panic(fmt.Sprintf("Error while starting the admin listener: %v", adminListenErr))
+		}
+		s.AdminAddr = adminListener.Addr().String()
+		if s.adminTLSConfig != nil {
+			adminListener = tls.NewListener(adminListener, s.adminTLSConfig)
+		}
+		s.adminServer = newHTTPServer(s.adminHandler, s.configuration.HTTPTimeouts)
+		logger.Info().Msgf("wsproxy instance is listening for admin requests at %s", s.AdminAddr)
+		go func() {
+			if serveErr := s.adminServer.Serve(adminListener); !errors.Is(serveErr, http.ErrServerClosed) {
+				logger.Error().Err(serveErr).Msg("admin server stopped")
+			}
+		}()
+	}
+
 	if ready != nil {
 		portAsInt, err := strconv.Atoi(port)
 		if err != nil {
@@ -72,73 +158,247 @@ func (s *Server) start(r http.Handler, ready func(port int, stop func())) error
 		ready(portAsInt, s.Stop)
 	}
 
-	server := &http.Server{
-		Handler:      r,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-	}
+	s.server = newHTTPServer(r, s.configuration.HTTPTimeouts)
 
-	return server.Serve(listener)
+	return s.server.Serve(listener)
 }
 
 // SetupAndStart sets up and starts server.
 func (s *Server) SetupAndStart(ready func(port int, stop func())) error {
-	r := createWsproxyRequestHandler(s.configuration, s.createConnectionId, s.clusterSupport)
-	return s.start(r, ready)
-}
-
-// For now, we assume that the backend authentication is managed ex-machina by the environment (AWS role or K8S NetworkPolicy
-// or by a service-mesh provider)
-// In the unlikely case of ex-machina control isn't available, OAuth2 client credentials flow could be easily supported.
-// (Use https://pkg.go.dev/github.com/golang-jwt/jwt/v4#example-package-GetTokenViaHTTP to verify the token.)
-func authenticateBackend(c *gin.Context) error {
-	return nil
+	if s.clusterSupport != nil && len(s.configuration.RelaySecret) == 0 {
+		return errors.New("a relay secret is required when clustered")
+	}
+	if s.configuration.Admin != nil && !hasBackendAuthMethod(s.configuration.Admin.Authentication) {
+		return errors.New("the admin listener requires an authentication method")
+	}
+	if originErr := validateOriginPolicy(s.configuration.OriginPolicy); originErr != nil {
+		return originErr
+	}
+	if forwardingErr := validateConnectForwarding(s.configuration.ConnectForwarding); forwardingErr != nil {
+		return forwardingErr
+	}
+	if payloadLoggingErr := validatePayloadLogging(s.configuration); payloadLoggingErr != nil {
+		return payloadLoggingErr
+	}
+	if s.configuration.Tracing != nil {
+		shutdownTracing, tracingErr := setupTracing(s.ctx, s.configuration.Tracing)
+		if tracingErr != nil {
+			return tracingErr
+		}
+		s.shutdownTracing = shutdownTracing
+	}
+	if s.configuration.TLS != nil {
+		tlsConfig, tlsErr := newTLSConfig(s.ctx, s.configuration.TLS)
+		if tlsErr != nil {
+			return tlsErr
+		}
+		s.tlsConfig = tlsConfig
+	}
+	if s.configuration.Admin != nil && s.configuration.Admin.TLS != nil {
+		adminTLSConfig, tlsErr := newTLSConfig(s.ctx, s.configuration.Admin.TLS)
+		if tlsErr != nil {
+			return tlsErr
+		}
+		s.adminTLSConfig = adminTLSConfig
+	}
+	if s.configuration.GRPC != nil && s.configuration.GRPC.TLS != nil {
+		grpcTLSConfig, tlsErr := newTLSConfig(s.ctx, s.configuration.GRPC.TLS)
+		if tlsErr != nil {
+			return tlsErr
+		}
+		s.grpcTLSConfig = grpcTLSConfig
+	}
+	handlers := createWsproxyRequestHandler(s.ctx, s.configuration, s.createConnectionId, s.clusterSupport, s.health, s.limiter, s.audit, s.grpcTLSConfig)
+	s.grpcServer = handlers.grpc
+	s.notifier = handlers.notifier
+	if handlers.admin != nil {
+		s.adminHandler = handlers.admin
+	}
+	return s.start(handlers.public, ready)
 }
 
 // Stop kills the listener
 func (s *Server) Stop() {
 	logger := zerolog.Ctx(s.ctx).With().Str("method", "stop").Logger()
+	s.health.startDraining()
+	if drainDelay := s.configuration.Readiness.DrainDelay; drainDelay > 0 {
+		logger.Info().Msgf("Draining for %v before shutting down...", drainDelay)
+		time.Sleep(drainDelay)
+	}
 	logger.Info().Msgf("Shutting down server...")
-	error := s.server.Shutdown(s.ctx)
-	if error != nil {
-		logger.Error().Msgf("Error while shutting down server: %v", error)
-	} else {
-		logger.Info().Msg("Server shutdown successfully")
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.adminServer != nil {
+		_ = s.adminServer.Shutdown(s.ctx)
+	}
+	if s.plainServer != nil {
+		_ = s.plainServer.Shutdown(s.ctx)
+	}
+	if s.shutdownTracing != nil {
+		if tracingErr := s.shutdownTracing(s.ctx); tracingErr != nil {
+			logger.Error().Err(tracingErr).Msg("Error while flushing traces")
+		}
+	}
+	if auditErr := s.audit.close(); auditErr != nil {
+		logger.Error().Err(auditErr).Msg("Error while closing the audit log")
+	}
+	if s.server != nil {
+		error := s.server.Shutdown(s.ctx)
+		if error != nil {
+			logger.Error().Msgf("Error while shutting down server: %v", error)
+		} else {
+			logger.Info().Msg("Server shutdown successfully")
+		}
+	}
+	if s.notifier != nil {
+		if notifierErr := s.notifier.close(); notifierErr != nil {
+			logger.Error().Err(notifierErr).Msg("Error while closing the application notifier")
+		}
 	}
 }
 
-func createWsproxyRequestHandler(options config.Config, createConnectionId func() ConnectionID, clusterSupport *ClusterSupport) *gin.Engine {
-	rootEngine := gin.Default()
-
-	rootEngine.Use(RequestLogger("websocketGatewayServer"))
+// wsproxyHandlers are the handlers of the proxy's listeners
+type wsproxyHandlers struct {
+	public *gin.Engine
+	// admin is nil unless the admin listener is configured
+	admin *gin.Engine
+	// grpc is nil unless the gRPC listener is configured
+	grpc *grpc.Server
+	// notifier is closed on shutdown
+	notifier AppNotifier
+}
 
-	wsConns := newWsConnections()
+// createWsproxyRequestHandler returns the HTTP handler and, if configured, the admin handler and the gRPC server of
+// the proxy (serving TLS if "grpcTLSConfig" is set)
+func createWsproxyRequestHandler(
+	ctx context.Context,
+	options config.Config,
+	createConnectionId func() ConnectionID,
+	clusterSupport *ClusterSupport,
+	health *healthChecker,
+	limiter *connectionLimiter,
+	audit *auditLog,
+	grpcTLSConfig *tls.Config,
+) wsproxyHandlers {
+	// gin's own access log is left out: it would log the query strings (which may carry tokens) as is
+	rootEngine := gin.New()
+	trustProxies(rootEngine, options.ConnectForwarding.TrustedProxies)
+	rootEngine.Use(gin.Recovery())
+
+	payloadLog := newPayloadLogger(options)
+	rootEngine.Use(requestLogger("websocketGatewayServer", payloadLog))
+
+	wsConns := newWsConnections(options.ClientMessageDispatch)
+
+	// Without any back-end authentication method configured, we assume that the back-end authentication is managed
+	// ex-machina by the environment (AWS role or K8S NetworkPolicy or by a service-mesh provider)
+	backendAuth := newBackendAuthenticator(ctx, options.BackendAuthentication, options.RelaySecret)
+	service := newBackendService(wsConns, clusterSupport, audit)
 
 	appUrls := appURLs{
 		baseUrl: options.AppBaseUrl,
 	}
+	notifier := newAppNotifier(ctx, options, &appUrls)
+
+	rootEngine.GET(HealthzPath, healthzHandler())
+	rootEngine.GET(ReadyzPath, readyzHandler(health))
 
 	rootEngine.GET(
 		string(ConnectPath),
 		connectHandler(
 			&appUrls,
+			notifier,
 			wsConns,
-			options.LoadBalancerAddress,
+			newOriginPolicy(options.OriginPolicy),
 			createConnectionId,
 			clusterSupport,
+			newClientAuthenticator(ctx, options.ClientJWT),
+			newConnectForwarding(options.ConnectForwarding),
+			newPresenceTracker(options.PresenceEvents, clusterSupport, notifier),
+			payloadLog,
+			options.Subprotocols,
+			limiter,
+			audit,
 		),
 	)
 
 	rootEngine.POST(
 		fmt.Sprintf("/message/:%s", connIdPathParamName),
+		requestDeadline(pushTimeout(options.HTTPTimeouts)),
 		pushHandler(
-			authenticateBackend,
-			wsConns,
-			clusterSupport,
+			backendAuth.forEndpoint(PushEndpoint),
+			service,
+		),
+	)
+
+	rootEngine.GET(
+		fmt.Sprintf("%s/:%s", PresencePath, userIdPathParamName),
+		presenceHandler(
+			backendAuth.forEndpoint(PresenceEndpoint),
+			service,
 		),
 	)
 
-	return rootEngine
+	rootEngine.POST(
+		string(PresencePath),
+		requestDeadline(requestTimeout(options.HTTPTimeouts)),
+		bulkPresenceHandler(
+			backendAuth.forEndpoint(PresenceEndpoint),
+			service,
+		),
+	)
+
+	rootEngine.POST(
+		fmt.Sprintf("%s/:%s", TopicPath, topicPathParamName),
+		requestDeadline(requestTimeout(options.HTTPTimeouts)),
+		publishHandler(
+			backendAuth.forEndpoint(PublishEndpoint),
+			service,
+		),
+	)
+
+	// The requests relayed by the other instances of the cluster are authenticated by the relay secret only
+	rootEngine.POST(
+		fmt.Sprintf("%s%s/:%s", RelayPath, MessagePath, connIdPathParamName),
+		requestDeadline(pushTimeout(options.HTTPTimeouts)),
+		pushHandler(backendAuth.forPeers(), service),
+	)
+	rootEngine.GET(
+		string(RelayPath+ConnectionsPath),
+		listConnectionsHandler(backendAuth.forPeers(), service),
+	)
+	rootEngine.GET(
+		fmt.Sprintf("%s%s/:%s", RelayPath, ConnectionsPath, connIdPathParamName),
+		getConnectionHandler(backendAuth.forPeers(), service),
+	)
+	rootEngine.DELETE(
+		fmt.Sprintf("%s%s/:%s", RelayPath, ConnectionsPath, connIdPathParamName),
+		requestDeadline(requestTimeout(options.HTTPTimeouts)),
+		closeConnectionHandler(backendAuth.forPeers(), service),
+	)
+
+	if clusterSupport != nil {
+		clusterSupport.subscribeToTopics(ctx, func(ctx context.Context, topic string, message string) {
+			wsConns.publish(ctx, topic, message)
+		})
+		service.lifecycleEvents = clusterSupport.shareLifecycleEvents(ctx, wsConns.events)
+	}
+
+	var adminAuth *backendAuthenticator
+	if options.Admin != nil {
+		adminAuth = newBackendAuthenticator(ctx, options.Admin.Authentication, "")
+	}
+
+	handlers := wsproxyHandlers{public: rootEngine, notifier: notifier}
+	if options.GRPC != nil {
+		handlers.grpc = newGRPCServer(backendAuth, adminAuth, service, grpcTLSConfig, options.HTTPTimeouts)
+	}
+	if options.Admin != nil {
+		handlers.admin = newAdminHandler(adminAuth, service, health, payloadLog, requestTimeout(options.HTTPTimeouts), options.ConnectForwarding.TrustedProxies)
+	}
+
+	return handlers
 }
 
 type appURLs struct {
@@ -149,6 +409,10 @@ func (u *appURLs) connecting() string {
 	return fmt.Sprintf("%s/ws%s", u.baseUrl, ConnectPath)
 }
 
+func (u *appURLs) connected() string {
+	return fmt.Sprintf("%s/ws%s", u.baseUrl, ConnectedPath)
+}
+
 func (u *appURLs) disconnected() string {
 	return fmt.Sprintf("%s/ws%s", u.baseUrl, DisonnectedPath)
 }
@@ -157,7 +421,21 @@ func (u *appURLs) message() string {
 	return fmt.Sprintf("%s/ws%s", u.baseUrl, MessagePath)
 }
 
+func (u *appURLs) messages() string {
+	return fmt.Sprintf("%s/ws%s", u.baseUrl, MessagesPath)
+}
+
+func (u *appURLs) presence() string {
+	return fmt.Sprintf("%s/ws%s", u.baseUrl, PresencePath)
+}
+
+// RequestLogger attaches a contextual logger to the requests and logs their outcome, masking the values of the
+// query parameters in config.DefaultRedactedQueryParams
 func RequestLogger(unitName string) func(g *gin.Context) {
+	return requestLogger(unitName, newPayloadLogger(config.Config{}))
+}
+
+func requestLogger(unitName string, payloadLog *payloadLogger) func(g *gin.Context) {
 	return func(g *gin.Context) {
 		start := time.Now()
 
@@ -165,8 +443,13 @@ func RequestLogger(unitName string) func(g *gin.Context) {
 		l := logging.Get().With().
 			Str("req_xid", xid.New().String()).
 			Str("req_method", g.Request.Method).
-			Str("req_url", g.Request.URL.RequestURI()).
+			Str("req_url", payloadLog.url(g.Request.URL)).
 			Logger()
+		l = logging.ForTargets(
+			l,
+			logging.Target{Kind: logging.ConnectionTarget, ID: g.Param(connIdPathParamName)},
+			logging.Target{Kind: logging.UserTarget, ID: g.Param(userIdPathParamName)},
+		)
 		l.Debug().Str("unit", unitName).
 			Str("user_agent", g.Request.UserAgent()).
 			Msg("incoming request starting")
@@ -0,0 +1,50 @@
+package wsproxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// SubprotocolHeaderKey carries the subprotocol of the connection on the requests to the application. On
+	// `GET /ws/connect`, it is the subprotocol the proxy picks unless the application chooses another one.
+	SubprotocolHeaderKey = "X-WSGW-SUBPROTOCOL"
+	// OfferedSubprotocolsHeaderKey carries the subprotocols offered by the client on `GET /ws/connect`
+	OfferedSubprotocolsHeaderKey = "X-WSGW-OFFERED-SUBPROTOCOLS"
+
+	subprotocolsRequestHeader = "Sec-WebSocket-Protocol"
+)
+
+// offeredSubprotocols returns the subprotocols offered by the client in its connection request
+func offeredSubprotocols(header http.Header) []string {
+	var offered []string
+	for _, value := range header.Values(subprotocolsRequestHeader) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); len(token) > 0 {
+				offered = append(offered, token)
+			}
+		}
+	}
+	return offered
+}
+
+// negotiateSubprotocol returns the first of the "supported" subprotocols the client offered (as spelled by the
+// client), or "" if none
+func negotiateSubprotocol(supported []string, offered []string) string {
+	for _, candidate := range supported {
+		if chosen, ok := findSubprotocol(offered, candidate); ok {
+			return chosen
+		}
+	}
+	return ""
+}
+
+// findSubprotocol returns the subprotocol of "offered" matching "name" case-insensitively
+func findSubprotocol(offered []string, name string) (string, bool) {
+	for _, subprotocol := range offered {
+		if strings.EqualFold(subprotocol, name) {
+			return subprotocol, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,157 @@
+package wsproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"wsproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultCertificateReloadInterval = time.Minute
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns the TLS configuration of a listener as configured by "conf"
+func newTLSConfig(ctx context.Context, conf *config.TLSConfig) (*tls.Config, error) {
+	reloadInterval := conf.ReloadInterval
+	if reloadInterval == 0 {
+		reloadInterval = defaultCertificateReloadInterval
+	}
+	certificates, loadErr := newCertificateReloader(ctx, conf.CertFile, conf.KeyFile, reloadInterval)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: certificates.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if len(conf.MinVersion) > 0 {
+		version, known := tlsVersions[conf.MinVersion]
+		if !known {
+			return nil, fmt.Errorf("unknown TLS version: %s", conf.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(conf.CipherSuites) > 0 {
+		suiteIds := map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			suiteIds[suite.Name] = suite.ID
+		}
+		for _, name := range conf.CipherSuites {
+			id, known := suiteIds[name]
+			if !known {
+				return nil, fmt.Errorf("unknown or insecure cipher suite: %s", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	if len(conf.ClientCAFile) > 0 {
+		caPEM, readErr := os.ReadFile(conf.ClientCAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read the client CA file: %w", readErr)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in the client CA file %s", conf.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if conf.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if conf.RequireClientCert {
+		return nil, fmt.Errorf("client certificates can't be required without a client CA file")
+	}
+
+	return tlsConfig, nil
+}
+
+// certificateReloader serves the certificate of a listener, reloading it when its files change.
+// The files are checked upon TLS handshakes, at most once per reload interval.
+type certificateReloader struct {
+	certFile       string
+	keyFile        string
+	reloadInterval time.Duration
+	logger         zerolog.Logger
+
+	mux         sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+	lastChecked time.Time
+}
+
+func newCertificateReloader(ctx context.Context, certFile string, keyFile string, reloadInterval time.Duration) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		certFile:       certFile,
+		keyFile:        keyFile,
+		reloadInterval: reloadInterval,
+		logger:         zerolog.Ctx(ctx).With().Str("unit", "certificateReloader").Str("certFile", certFile).Logger(),
+	}
+	modTimes, statErr := reloader.modTimesOfFiles()
+	if statErr != nil {
+		return nil, statErr
+	}
+	if loadErr := reloader.load(modTimes); loadErr != nil {
+		return nil, loadErr
+	}
+	return reloader, nil
+}
+
+func (r *certificateReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if time.Since(r.lastChecked) >= r.reloadInterval {
+		r.lastChecked = time.Now()
+		modTimes, statErr := r.modTimesOfFiles()
+		if statErr != nil {
+			r.logger.Error().Err(statErr).Msg("failed to check the certificate files, keeping the current certificate")
+		} else if modTimes != r.modTimes {
+			if loadErr := r.load(modTimes); loadErr != nil {
+				r.logger.Error().Err(loadErr).Msg("failed to reload the certificate, keeping the current one")
+			} else {
+				r.logger.Info().Msg("certificate reloaded")
+			}
+		}
+	}
+
+	return r.certificate, nil
+}
+
+// load loads the certificate from the files modified at "modTimes"
+func (r *certificateReloader) load(modTimes [2]time.Time) error {
+	certificate, loadErr := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if loadErr != nil {
+		return fmt.Errorf("failed to load the certificate: %w", loadErr)
+	}
+	r.certificate = &certificate
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *certificateReloader) modTimesOfFiles() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, statErr := os.Stat(file)
+		if statErr != nil {
+			return modTimes, fmt.Errorf("failed to check the certificate file: %w", statErr)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,117 @@
+package wsproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"wsproxy/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "wsproxy"
+	defaultServiceName = "wsproxy"
+
+	connectionIdAttribute = attribute.Key("wsproxy.connection_id")
+	statusCodeAttribute   = attribute.Key("http.response.status_code")
+)
+
+// setupTracing installs the tracer provider and the W3C trace context propagator described by "conf".
+// The returned function flushes and shuts down the provider.
+func setupTracing(ctx context.Context, conf *config.TracingConfig) (func(context.Context) error, error) {
+	var providerOption sdktrace.TracerProviderOption
+	switch conf.Exporter {
+	case config.StdoutTracingExporter:
+		options := []stdouttrace.Option{}
+		if conf.StdoutWriter != nil {
+			options = append(options, stdouttrace.WithWriter(conf.StdoutWriter))
+		}
+		exporter, err := stdouttrace.New(options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the stdout trace exporter: %w", err)
+		}
+		// Spans are written as they end: the stdout exporter is meant for local testing
+		providerOption = sdktrace.WithSyncer(exporter)
+	case "", config.OTLPTracingExporter:
+		options := []otlptracehttp.Option{}
+		if conf.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(conf.OTLPEndpoint))
+		}
+		if conf.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the OTLP trace exporter: %w", err)
+		}
+		providerOption = sdktrace.WithBatcher(exporter)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %q", conf.Exporter)
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	sampleRatio := conf.SampleRatio
+	if sampleRatio == 0 {
+		sampleRatio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		providerOption,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span with the globally installed tracer provider (a no-op without tracing configured)
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// startLinkedSpan starts a span as startSpan does, linked to the spans of "linked" (if any)
+func startLinkedSpan(ctx context.Context, name string, kind trace.SpanKind, linked []context.Context) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(linked))
+	for _, linkedCtx := range linked {
+		links = append(links, trace.LinkFromContext(linkedCtx))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithLinks(links...))
+}
+
+// recordSpanError flags "span" as failed with "err"
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// recordStatusCode records the status code of an HTTP exchange on "span", flagging server errors
+func recordStatusCode(span trace.Span, statusCode int) {
+	span.SetAttributes(statusCodeAttribute.Int(statusCode))
+	if statusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
+
+// extractTraceContext continues the trace context carried by "header" (if any)
+func extractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// injectTraceContext adds the trace context of "ctx" (if any) to "header"
+func injectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -2,57 +2,226 @@ package wsproxy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"wsproxy/internal/config"
 	"wsproxy/internal/logging"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 	"nhooyr.io/websocket"
 )
 
+// messageFromApp is a message queued for the client along with the trace (if any) of the request that sent it
+type messageFromApp struct {
+	text        string
+	spanContext trace.SpanContext
+}
+
 type connection struct {
 	fromClient chan string
-	fromApp    chan string
+	fromApp    chan messageFromApp
+	// replies holds the replies to the client's messages
+	replies    chan string
 	connClosed chan websocket.CloseError
-	closeSlow  func()
-	id         ConnectionID
+	// readFailed receives the error reading from the client other than the close of the connection
+	readFailed chan error
+	// closeRequests holds the request to close the connection on behalf of a back-end (if any)
+	closeRequests chan closeRequest
+	closeSlow     func()
+	id            ConnectionID
+	identity      clientIdentity
+	client        clientInfo
+	topics        []string
+	connectedAt   time.Time
+	// messagesFromClient and messagesToClient count the messages received from and sent to the client
+	messagesFromClient atomic.Int64
+	messagesToClient   atomic.Int64
 	// publishLimiter controls the rate limit applied to the publish endpoint.
 	//
 	// Defaults to one publish every 100ms with a burst of 8.
 	publishLimiter *rate.Limiter
 }
 
-func newConnection(connId ConnectionID, wsIo wsIO, messageBufferSize int) *connection {
+type rateLimit struct {
+	perSecond float64
+	burst     int
+}
+
+// connectionOptions holds the per-connection settings (typically decided by the application upon connecting)
+type connectionOptions struct {
+	// topics the connection is subscribed to
+	topics []string
+	// pushRateLimit overrides the default rate limit of pushing messages to the connection
+	pushRateLimit *rateLimit
+	// maxLifetime, if not zero, is the duration after which the connection is closed
+	maxLifetime time.Duration
+}
+
+var errMaxLifetimeReached = errors.New("maximum connection lifetime reached")
+
+// closeRequest asks for the connection to be closed with the given web-socket close status
+type closeRequest struct {
+	code   websocket.StatusCode
+	reason string
+	// finalMessage, if not empty, is sent to the client before the connection is closed
+	finalMessage string
+}
+
+// closedByBackendError is returned by processMessages when a back-end has closed the connection
+type closedByBackendError struct {
+	closeRequest
+}
+
+func (e *closedByBackendError) Error() string {
+	return fmt.Sprintf("connection closed by back-end with status %d: %s", e.code, e.reason)
+}
+
+// clientInfo describes the client of a connection for the introspection API
+type clientInfo struct {
+	remoteAddress string
+	userAgent     string
+	// metadata is the application's custom data (JSON) attached to the connection
+	metadata string
+	// subprotocol is the web-socket subprotocol negotiated with the client (if any)
+	subprotocol string
+}
+
+// connectionInfo is what is known of a connection, as returned by the introspection API
+type connectionInfo struct {
+	ID ConnectionID `json:"id"`
+	// Node is the address of the instance serving the connection (if known)
+	Node          string          `json:"node,omitempty"`
+	UserID        string          `json:"userId,omitempty"`
+	TenantID      string          `json:"tenantId,omitempty"`
+	Topics        []string        `json:"topics,omitempty"`
+	ConnectedAt   time.Time       `json:"connectedAt"`
+	RemoteAddress string          `json:"remoteAddress,omitempty"`
+	UserAgent     string          `json:"userAgent,omitempty"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+	Subprotocol   string          `json:"subprotocol,omitempty"`
+	// QueueDepth is the number of messages waiting to be sent to the client
+	QueueDepth         int   `json:"queueDepth"`
+	MessagesFromClient int64 `json:"messagesFromClient"`
+	MessagesToClient   int64 `json:"messagesToClient"`
+}
+
+// connectionFilter selects connections by their properties; the zero value of a criterion matches every connection
+type connectionFilter struct {
+	userId   string
+	tenantId string
+	node     string
+	topic    string
+	// minAge and maxAge bound the time elapsed since the connections were established
+	minAge time.Duration
+	maxAge time.Duration
+}
+
+func (f connectionFilter) matches(info *connectionInfo, now time.Time) bool {
+	if len(f.userId) > 0 && info.UserID != f.userId {
+		return false
+	}
+	if len(f.tenantId) > 0 && info.TenantID != f.tenantId {
+		return false
+	}
+	if len(f.node) > 0 && info.Node != f.node {
+		return false
+	}
+	if len(f.topic) > 0 && !slices.Contains(info.Topics, f.topic) {
+		return false
+	}
+	age := now.Sub(info.ConnectedAt)
+	if f.minAge > 0 && age < f.minAge {
+		return false
+	}
+	if f.maxAge > 0 && age > f.maxAge {
+		return false
+	}
+	return true
+}
+
+// sortConnectionInfos orders the connections oldest first
+func sortConnectionInfos(infos []*connectionInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ConnectedAt.Equal(infos[j].ConnectedAt) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+}
+
+func newConnection(connId ConnectionID, identity clientIdentity, client clientInfo, wsIo wsIO, messageBufferSize int, options connectionOptions) *connection {
+	publishLimiter := rate.NewLimiter(rate.Limit(defaultPushRatePerSecond), defaultPushBurst)
+	if options.pushRateLimit != nil {
+		publishLimiter = rate.NewLimiter(rate.Limit(options.pushRateLimit.perSecond), options.pushRateLimit.burst)
+	}
 	return &connection{
-		id:         connId,
-		fromClient: make(chan string),
-		fromApp:    make(chan string, messageBufferSize),
-		connClosed: make(chan websocket.CloseError),
+		id:            connId,
+		identity:      identity,
+		client:        client,
+		topics:        options.topics,
+		connectedAt:   time.Now(),
+		fromClient:    make(chan string),
+		fromApp:       make(chan messageFromApp, messageBufferSize),
+		replies:       make(chan string, messageBufferSize),
+		connClosed:    make(chan websocket.CloseError),
+		readFailed:    make(chan error),
+		closeRequests: make(chan closeRequest, 1),
 		closeSlow: func() {
 			wsIo.Close()
 		},
-		publishLimiter: rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
+		publishLimiter: publishLimiter,
 	}
 }
 
 type wsConnections struct {
 	connectionMessageBuffer int
+	// dispatchConcurrency is the number of messages per connection relayed to the application at the same time
+	dispatchConcurrency int
 
 	wsMapMux sync.Mutex
 	wsMap    map[ConnectionID]*connection
+	// topicMap holds the subscribers of topics; it is guarded by wsMapMux too
+	topicMap map[string]map[ConnectionID]*connection
+	// userMap holds the connections of users; it is guarded by wsMapMux too
+	userMap map[string]map[ConnectionID]*connection
+
+	// events receives the connections being added and deleted
+	events *lifecycleEvents
 
 	logger zerolog.Logger
 }
 
 var errConnectionNotFound = errors.New("connection not found")
 
-func newWsConnections() *wsConnections {
+// errPushTimedOut is the failure of a push waiting too long for the connection to have room for the message
+var errPushTimedOut = errors.New("push timed out")
+
+const defaultDispatchConcurrency = 8
+
+func newWsConnections(dispatch config.ClientMessageDispatchConfig) *wsConnections {
+	dispatchConcurrency := 1
+	if dispatch.Ordering == config.UnorderedOrdering {
+		dispatchConcurrency = dispatch.Concurrency
+		if dispatchConcurrency <= 0 {
+			dispatchConcurrency = defaultDispatchConcurrency
+		}
+	}
+
 	ns := &wsConnections{
 		connectionMessageBuffer: 16,
+		dispatchConcurrency:     dispatchConcurrency,
 		wsMap:                   make(map[ConnectionID]*connection),
+		topicMap:                make(map[string]map[ConnectionID]*connection),
+		userMap:                 make(map[string]map[ConnectionID]*connection),
+		events:                  newLifecycleEvents(),
 		logger:                  logging.Get().With().Str("unit", "notification-server").Logger(),
 	}
 
@@ -65,16 +234,28 @@ type wsIO interface {
 	Read(ctx context.Context) (string, error)
 }
 
-type onMgsReceivedFunc func(c context.Context, msg string) error
+// onMgsReceivedFunc processes a message from the client and returns the function waiting for the message to reply
+// with (if any)
+type onMgsReceivedFunc func(c context.Context, msg string) func() string
 
 func (wsconn *wsConnections) processMessages(
 	ctx context.Context,
 	connId ConnectionID,
+	identity clientIdentity,
+	client clientInfo,
 	wsIo wsIO,
 	onMessageFromClient onMgsReceivedFunc,
+	options connectionOptions,
 ) error {
 	logger := zerolog.Ctx(ctx).With().Str("method", "processMessages").Str(ConnectionIDKey, string(connId)).Logger()
-	conn := newConnection(connId, wsIo, wsconn.connectionMessageBuffer)
+	conn := newConnection(connId, identity, client, wsIo, wsconn.connectionMessageBuffer, options)
+
+	var lifetimeExpired <-chan time.Time
+	if options.maxLifetime > 0 {
+		lifetimeTimer := time.NewTimer(options.maxLifetime)
+		defer lifetimeTimer.Stop()
+		lifetimeExpired = lifetimeTimer.C
+	}
 
 	wsconn.addConnection(conn)
 	logger.Debug().Msg("connection added")
@@ -83,6 +264,14 @@ func (wsconn *wsConnections) processMessages(
 		logger.Debug().Msg("connection removed")
 	}()
 
+	// done signals the goroutines serving the connection that processing is over
+	done := make(chan struct{})
+	// Messages being relayed to the application are let finish, so that the application learns of them
+	// before it learns of the connection being closed
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	defer close(done)
+
 	go func() {
 		for {
 			msgRead, errRead := wsIo.Read(ctx)
@@ -91,37 +280,100 @@ func (wsconn *wsConnections) processMessages(
 				var closeError websocket.CloseError
 				if errors.As(errRead, &closeError) {
 					logger.Debug().Err(errRead).Msg("WS connection closing...")
-					conn.connClosed <- closeError
+					select {
+					case conn.connClosed <- closeError:
+					case <-done:
+					}
 					return
 				}
 				logger.Error().Err(errRead).Msg("WS connection not closing")
 				select {
-				case conn.fromClient <- "asdfasdf":
-				default:
-					go wsIo.Close()
+				case conn.readFailed <- errRead:
+				case <-done:
 				}
 				return
 			}
-			conn.fromClient <- msgRead
+			conn.messagesFromClient.Add(1)
+			countMessage("in", msgRead)
+			select {
+			case conn.fromClient <- msgRead:
+			case <-done:
+				return
+			}
 		}
 	}()
 
+	replyWith := func(awaitReply func() string) {
+		reply := awaitReply()
+		if len(reply) == 0 {
+			return
+		}
+		select {
+		case conn.replies <- reply:
+		case <-done:
+		}
+	}
+
+	// Messages from the client are relayed to the application by workers, so that messages from the application
+	// don't have to wait for the application to process the messages from the client.
+	// A single worker keeps the messages in order: it hands the replies over to be awaited in order too, so that the
+	// next message may be relayed before the application has replied to the previous one (e.g. in the same batch).
+	var orderedReplies chan func() string
+	if wsconn.dispatchConcurrency == 1 {
+		orderedReplies = make(chan func() string, wsconn.connectionMessageBuffer)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for awaitReply := range orderedReplies {
+				replyWith(awaitReply)
+			}
+		}()
+	}
+	for worker := 0; worker < wsconn.dispatchConcurrency; worker++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if orderedReplies != nil {
+				defer close(orderedReplies)
+			}
+			for {
+				select {
+				case msg := <-conn.fromClient:
+					logger.Debug().Int("worker", worker).Msg("dispatch: msg from client")
+					awaitReply := onMessageFromClient(ctx, msg)
+					if orderedReplies != nil {
+						orderedReplies <- awaitReply
+						continue
+					}
+					replyWith(awaitReply)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
 	for {
 		logger.Debug().Msg("about to enter select...")
 		select {
 		case msg := <-conn.fromApp:
 			logger.Debug().Msg("select: msg from backend")
-			err := writeTimeout(ctx, time.Second*5, wsIo, msg)
+			err := writeMessageFromApp(ctx, wsIo, conn.id, msg)
 			if err != nil {
 				logger.Error().Err(err).Msg("select: failed to relay message from app to client")
 				return err
 			}
-		case msg := <-conn.fromClient:
-			logger.Debug().Msg("select: msg from client")
-			sendToAppErr := onMessageFromClient(ctx, msg)
-			if sendToAppErr != nil {
-				conn.fromApp <- sendToAppErr.Error()
+			conn.messagesToClient.Add(1)
+			countMessage("out", msg.text)
+		case reply := <-conn.replies:
+			logger.Debug().Msg("select: reply to client")
+			err := writeTimeout(ctx, time.Second*5, wsIo, reply)
+			if err != nil {
+				logger.Error().Err(err).Msg("select: failed to send reply to client")
+				return err
 			}
+			conn.messagesToClient.Add(1)
+			countMessage("out", reply)
 		case closeError := <-conn.connClosed:
 			logger.Debug().Err(closeError).Msg("select: ws connection closing...")
 			if closeError.Code == websocket.StatusNormalClosure {
@@ -129,6 +381,20 @@ func (wsconn *wsConnections) processMessages(
 			}
 			logger.Error().Err(closeError).Msg("select: socket closed abnormaly")
 			return fmt.Errorf("select: socket closed abnormaly: %w", closeError)
+		case readErr := <-conn.readFailed:
+			logger.Debug().Err(readErr).Msg("select: failed to read from client")
+			return fmt.Errorf("select: failed to read from client: %w", readErr)
+		case request := <-conn.closeRequests:
+			logger.Debug().Int("code", int(request.code)).Msg("select: connection closed by back-end")
+			if len(request.finalMessage) > 0 {
+				if err := writeTimeout(ctx, time.Second*5, wsIo, request.finalMessage); err != nil {
+					logger.Info().Err(err).Msg("select: failed to send final message to client")
+				}
+			}
+			return &closedByBackendError{request}
+		case <-lifetimeExpired:
+			logger.Debug().Msg("select: maximum lifetime reached")
+			return errMaxLifetimeReached
 		case <-ctx.Done():
 			logger.Debug().Msg("select: context is done")
 			return ctx.Err()
@@ -142,6 +408,22 @@ func (wsconn *wsConnections) addConnection(conn *connection) {
 	wsconn.wsMapMux.Lock()
 	defer wsconn.wsMapMux.Unlock()
 	wsconn.wsMap[conn.id] = conn
+	for _, topic := range conn.topics {
+		subscribers, ok := wsconn.topicMap[topic]
+		if !ok {
+			subscribers = make(map[ConnectionID]*connection)
+			wsconn.topicMap[topic] = subscribers
+		}
+		subscribers[conn.id] = conn
+	}
+	if userId := conn.identity.userId; len(userId) > 0 {
+		if _, ok := wsconn.userMap[userId]; !ok {
+			wsconn.userMap[userId] = make(map[ConnectionID]*connection)
+		}
+		wsconn.userMap[userId][conn.id] = conn
+	}
+	activeConnectionsGauge.Inc()
+	wsconn.events.publish(lifecycleEvent{eventType: connectedEvent, connectionId: conn.id, identity: conn.identity, time: conn.connectedAt})
 }
 
 // deleteConnection deletes the given subscriber.
@@ -149,22 +431,145 @@ func (wsconn *wsConnections) deleteConnection(conn *connection) {
 	wsconn.wsMapMux.Lock()
 	defer wsconn.wsMapMux.Unlock()
 	defer delete(wsconn.wsMap, conn.id)
+	for _, topic := range conn.topics {
+		delete(wsconn.topicMap[topic], conn.id)
+		if len(wsconn.topicMap[topic]) == 0 {
+			delete(wsconn.topicMap, topic)
+		}
+	}
+	if userId := conn.identity.userId; len(userId) > 0 {
+		delete(wsconn.userMap[userId], conn.id)
+		if len(wsconn.userMap[userId]) == 0 {
+			delete(wsconn.userMap, userId)
+		}
+	}
+	activeConnectionsGauge.Dec()
+	wsconn.events.publish(lifecycleEvent{eventType: disconnectedEvent, connectionId: conn.id, identity: conn.identity, time: time.Now()})
 }
 
-// It never blocks and so messages to slow subscribers
-// are dropped.
+// push queues the message to the connection, waiting for its rate limit and for room in its queue until "ctx" is done
 func (wsconn *wsConnections) push(ctx context.Context, msg string, connId ConnectionID) error {
 	conn, connNotFoundErr := wsconn.getConnection(connId)
 	if connNotFoundErr != nil {
 		return connNotFoundErr
 	}
 
-	conn.publishLimiter.Wait(ctx)
-	conn.fromApp <- string(msg)
+	if waitErr := conn.publishLimiter.Wait(ctx); waitErr != nil {
+		return fmt.Errorf("%w: %v", errPushTimedOut, waitErr)
+	}
+	select {
+	case conn.fromApp <- messageFromApp{text: msg, spanContext: trace.SpanContextFromContext(ctx)}:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", errPushTimedOut, ctx.Err())
+	}
+	queueDepthHistogram.Observe(float64(len(conn.fromApp)))
 
 	return nil
 }
 
+// publish delivers the message to the local subscribers of the topic and returns their number.
+// Unlike push, it never blocks: messages exceeding a subscriber's rate limit are dropped and
+// subscribers too slow to keep up with the messages are disconnected.
+func (wsconn *wsConnections) publish(ctx context.Context, topic string, msg string) int {
+	logger := zerolog.Ctx(ctx).With().Str("method", "publish").Str("topic", topic).Logger()
+
+	wsconn.wsMapMux.Lock()
+	defer wsconn.wsMapMux.Unlock()
+
+	message := messageFromApp{text: msg, spanContext: trace.SpanContextFromContext(ctx)}
+	subscribers := wsconn.topicMap[topic]
+	for _, conn := range subscribers {
+		if !conn.publishLimiter.Allow() {
+			logger.Info().Str(ConnectionIDKey, string(conn.id)).Msg("rate limit exceeded, message dropped")
+			rateLimitRejectionsCounter.Inc()
+			continue
+		}
+		select {
+		case conn.fromApp <- message:
+			queueDepthHistogram.Observe(float64(len(conn.fromApp)))
+		default:
+			logger.Info().Str(ConnectionIDKey, string(conn.id)).Msg("connection too slow, closing...")
+			slowConnectionsClosedCounter.Inc()
+			go conn.closeSlow()
+		}
+	}
+	return len(subscribers)
+}
+
+// close asks the connection to be closed as requested.
+// Closing a connection already being closed is a no-op.
+func (wsconn *wsConnections) close(connId ConnectionID, request closeRequest) error {
+	conn, connNotFoundErr := wsconn.getConnection(connId)
+	if connNotFoundErr != nil {
+		return connNotFoundErr
+	}
+	select {
+	case conn.closeRequests <- request:
+	default:
+	}
+	return nil
+}
+
+// connectionsOfUser returns the ids of the connections of the user served by this instance
+func (wsconn *wsConnections) connectionsOfUser(userId string) []ConnectionID {
+	wsconn.wsMapMux.Lock()
+	defer wsconn.wsMapMux.Unlock()
+	connIds := make([]ConnectionID, 0, len(wsconn.userMap[userId]))
+	for connId := range wsconn.userMap[userId] {
+		connIds = append(connIds, connId)
+	}
+	return connIds
+}
+
+func (wsconn *wsConnections) info(connId ConnectionID) (*connectionInfo, error) {
+	conn, connNotFoundErr := wsconn.getConnection(connId)
+	if connNotFoundErr != nil {
+		return nil, connNotFoundErr
+	}
+	return conn.info(), nil
+}
+
+// list returns the connections served by this instance matching the filter, oldest first
+func (wsconn *wsConnections) list(filter connectionFilter) []*connectionInfo {
+	wsconn.wsMapMux.Lock()
+	infos := make([]*connectionInfo, 0, len(wsconn.wsMap))
+	for _, conn := range wsconn.wsMap {
+		infos = append(infos, conn.info())
+	}
+	wsconn.wsMapMux.Unlock()
+
+	now := time.Now()
+	matching := infos[:0]
+	for _, info := range infos {
+		if filter.matches(info, now) {
+			matching = append(matching, info)
+		}
+	}
+	sortConnectionInfos(matching)
+	return matching
+}
+
+func (conn *connection) info() *connectionInfo {
+	info := &connectionInfo{
+		ID:                 conn.id,
+		Node:               myNodeAddress(),
+		UserID:             conn.identity.userId,
+		TenantID:           conn.identity.tenantId,
+		Topics:             conn.topics,
+		ConnectedAt:        conn.connectedAt,
+		RemoteAddress:      conn.client.remoteAddress,
+		UserAgent:          conn.client.userAgent,
+		Subprotocol:        conn.client.subprotocol,
+		QueueDepth:         len(conn.fromApp) + len(conn.replies),
+		MessagesFromClient: conn.messagesFromClient.Load(),
+		MessagesToClient:   conn.messagesToClient.Load(),
+	}
+	if len(conn.client.metadata) > 0 {
+		info.Metadata = json.RawMessage(conn.client.metadata)
+	}
+	return info
+}
+
 func (wsconn *wsConnections) getConnection(connId ConnectionID) (*connection, error) {
 	wsconn.wsMapMux.Lock()
 	defer wsconn.wsMapMux.Unlock()
@@ -181,3 +586,24 @@ func writeTimeout(ctx context.Context, timeout time.Duration, sIo wsIO, msg stri
 
 	return sIo.Write(ctx, msg)
 }
+
+// writeMessageFromApp writes "msg" to the client, continuing the trace of the request that sent it (if any)
+func writeMessageFromApp(ctx context.Context, sIo wsIO, connId ConnectionID, msg messageFromApp) error {
+	if !msg.spanContext.IsValid() {
+		return writeTimeout(ctx, time.Second*5, sIo, msg.text)
+	}
+
+	spanCtx, span := startSpan(
+		trace.ContextWithSpanContext(ctx, msg.spanContext),
+		"ws.write",
+		trace.SpanKindInternal,
+		connectionIdAttribute.String(string(connId)),
+	)
+	defer span.End()
+
+	err := writeTimeout(spanCtx, time.Second*5, sIo, msg.text)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	opsAPIKey        = "ops-key"
+	monitoringAPIKey = "monitoring-key"
+)
+
+type adminTestSuite struct {
+	*baseTestSuite
+}
+
+func TestAdminTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestAdminTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Admin = &config.AdminConfig{
+			Authentication: config.BackendAuthConfig{
+				APIKeys: map[string]string{opsAPIKey: "ops", monitoringAPIKey: "monitoring"},
+				Permissions: map[string][]string{
+					"ops":        {"*"},
+					"monitoring": {string(wsproxy.MetricsEndpoint)},
+				},
+			},
+		}
+	}
+
+	suite.Run(
+		t,
+		&adminTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+// sendToAdmin calls the admin listener with the API key (if any) and returns the response with its body
+func (s *adminTestSuite) sendToAdmin(ctx context.Context, method string, path string, apiKey string) (*http.Response, string) {
+	request, createReqErr := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s", s.wsGateway.AdminAddr, path), nil)
+	s.Require().NoError(createReqErr)
+	if len(apiKey) > 0 {
+		request.Header.Set(wsproxy.APIKeyHeaderKey, apiKey)
+	}
+	response, requestErr := http.DefaultClient.Do(request)
+	s.Require().NoError(requestErr)
+	defer response.Body.Close()
+	body, readErr := io.ReadAll(response.Body)
+	s.Require().NoError(readErr)
+	return response, string(body)
+}
+
+func (s *adminTestSuite) TestAdminEndpointsRequireAuthentication() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, _ := s.sendToAdmin(ctx, http.MethodGet, wsproxy.MetricsPath, "")
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	response, _ = s.sendToAdmin(ctx, http.MethodGet, wsproxy.MetricsPath, "unknown-key")
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	response, body := s.sendToAdmin(ctx, http.MethodGet, wsproxy.MetricsPath, monitoringAPIKey)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Contains(body, "wsproxy_active_connections")
+
+	response, _ = s.sendToAdmin(ctx, http.MethodGet, wsproxy.ProfilingPath+"/goroutine?debug=1", monitoringAPIKey)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+
+	response, _ = s.sendToAdmin(ctx, http.MethodGet, string(wsproxy.ConnectionsPath), monitoringAPIKey)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+}
+
+func (s *adminTestSuite) TestProfiling() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, body := s.sendToAdmin(ctx, http.MethodGet, wsproxy.ProfilingPath+"/goroutine?debug=1", opsAPIKey)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Contains(body, "goroutine profile")
+
+	response, _ = s.sendToAdmin(ctx, http.MethodGet, wsproxy.ProfilingPath+"/", opsAPIKey)
+	s.Equal(http.StatusOK, response.StatusCode)
+}
+
+func (s *adminTestSuite) TestConnectionsManagedViaAdminListener() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	response, body := s.sendToAdmin(ctx, http.MethodGet, string(wsproxy.ConnectionsPath), opsAPIKey)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var list struct {
+		Connections []struct{ ID string }
+		Total       int
+	}
+	s.NoError(json.Unmarshal([]byte(body), &list))
+	s.Equal(1, list.Total)
+	s.Equal(string(connId), list.Connections[0].ID)
+
+	// the main listener doesn't serve the connections
+	response, _, err = s.getFromProxy(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId))
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	response, _ = s.sendToAdmin(ctx, http.MethodDelete, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId), opsAPIKey)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	<-s.mockApp.OnDisconnect(connId)
+	s.Equal(wsproxy.ClosedByAppReason, s.mockApp.GetDisconnectReason(connId))
+}
+
+func (s *adminTestSuite) TestAdminListenerRequiresAuthentication() {
+	server := wsproxy.NewServer(s.ctx, config.Config{ServerHost: "localhost", Admin: &config.AdminConfig{}}, func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(s.ctx)
+	})
+	s.Error(server.SetupAndStart(nil))
+}
+
+func (s *adminTestSuite) TestDrainTrigger() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, _ := s.sendToAdmin(ctx, http.MethodPost, wsproxy.DrainPath, monitoringAPIKey)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+
+	readyResponse, _, readyErr := s.getFromProxy(ctx, wsproxy.ReadyzPath)
+	s.NoError(readyErr)
+	s.Equal(http.StatusOK, readyResponse.StatusCode)
+
+	response, _ = s.sendToAdmin(ctx, http.MethodPost, wsproxy.DrainPath, opsAPIKey)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	readyResponse, body, readyErr := s.getFromProxy(ctx, wsproxy.ReadyzPath)
+	s.NoError(readyErr)
+	s.Equal(http.StatusServiceUnavailable, readyResponse.StatusCode)
+	s.Contains(body, "draining")
+}
+
+type logLevelSettings struct {
+	Level            string
+	DebugConnections []string
+	DebugUsers       []string
+}
+
+// sendLogLevelRequest calls a `/log-level` endpoint of the admin listener with the ops API key
+func (s *adminTestSuite) sendLogLevelRequest(ctx context.Context, method string, path string, body string) (int, logLevelSettings) {
+	request, createReqErr := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s%s", s.wsGateway.AdminAddr, wsproxy.LogLevelPath, path), strings.NewReader(body))
+	s.Require().NoError(createReqErr)
+	request.Header.Set(wsproxy.APIKeyHeaderKey, opsAPIKey)
+	request.Header.Set("Content-Type", "application/json")
+	response, requestErr := http.DefaultClient.Do(request)
+	s.Require().NoError(requestErr)
+	defer response.Body.Close()
+
+	var settings logLevelSettings
+	if response.StatusCode == http.StatusOK {
+		s.NoError(json.NewDecoder(response.Body).Decode(&settings))
+	}
+	return response.StatusCode, settings
+}
+
+func (s *adminTestSuite) TestChangeLogLevelAtRuntime() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	statusCode, initial := s.sendLogLevelRequest(ctx, http.MethodGet, "", "")
+	s.Equal(http.StatusOK, statusCode)
+	defer s.sendLogLevelRequest(ctx, http.MethodPut, "", fmt.Sprintf(`{"level":%q}`, initial.Level))
+
+	statusCode, settings := s.sendLogLevelRequest(ctx, http.MethodPut, "", `{"level":"warn"}`)
+	s.Equal(http.StatusOK, statusCode)
+	s.Equal("warn", settings.Level)
+
+	statusCode, _ = s.sendLogLevelRequest(ctx, http.MethodPut, "", `{"level":"verbose"}`)
+	s.Equal(http.StatusBadRequest, statusCode)
+
+	_, settings = s.sendLogLevelRequest(ctx, http.MethodGet, "", "")
+	s.Equal("warn", settings.Level)
+
+	response, _ := s.sendToAdmin(ctx, http.MethodGet, wsproxy.LogLevelPath, monitoringAPIKey)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+}
+
+func (s *adminTestSuite) TestDebugLoggingForConnectionsAndUsers() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	statusCode, settings := s.sendLogLevelRequest(ctx, http.MethodPut, "/connections/conn-1", "")
+	s.Equal(http.StatusOK, statusCode)
+	s.Equal([]string{"conn-1"}, settings.DebugConnections)
+
+	_, settings = s.sendLogLevelRequest(ctx, http.MethodPut, "/users/user-1", "")
+	s.Equal([]string{"user-1"}, settings.DebugUsers)
+
+	_, settings = s.sendLogLevelRequest(ctx, http.MethodDelete, "/connections/conn-1", "")
+	s.Empty(settings.DebugConnections)
+	s.Equal([]string{"user-1"}, settings.DebugUsers)
+
+	_, settings = s.sendLogLevelRequest(ctx, http.MethodDelete, "/users/user-1", "")
+	s.Empty(settings.DebugUsers)
+}
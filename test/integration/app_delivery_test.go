@@ -0,0 +1,145 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const testEventStream = "wsproxy-test:events"
+
+type redisStreamsDeliveryTestSuite struct {
+	*baseTestSuite
+	redis *miniredis.Miniredis
+}
+
+func TestRedisStreamsDeliveryTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestRedisStreamsDeliveryTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	redis := miniredis.NewMiniRedis()
+	if startErr := redis.Start(); startErr != nil {
+		t.Fatal(startErr)
+	}
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.RedisStreamsDelivery = &config.RedisStreamsDeliveryConfig{
+			Address: redis.Addr(),
+			Stream:  testEventStream,
+		}
+	}
+
+	suite.Run(
+		t,
+		&redisStreamsDeliveryTestSuite{
+			baseTestSuite: base,
+			redis:         redis,
+		},
+	)
+}
+
+func (s *redisStreamsDeliveryTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.redis.Close()
+}
+
+// eventsOf returns the values of the events on the stream concerning the connection
+func (s *redisStreamsDeliveryTestSuite) eventsOf(connId wsproxy.ConnectionID) []map[string]string {
+	entries, streamErr := s.redis.Stream(testEventStream)
+	if streamErr != nil {
+		return nil
+	}
+	events := []map[string]string{}
+	for _, entry := range entries {
+		values := map[string]string{}
+		for index := 0; index+1 < len(entry.Values); index += 2 {
+			values[entry.Values[index]] = entry.Values[index+1]
+		}
+		if values["connectionId"] == string(connId) {
+			events = append(events, values)
+		}
+	}
+	return events
+}
+
+func (s *redisStreamsDeliveryTestSuite) TestLifecycleAndMessagesPublishedToStream() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	connId := client.connectionId
+
+	message := mockapp.MessageJSON{"message": "hi", "correlationId": "request-1"}
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+
+	s.JSONEq(`{"type":"reply","correlationId":"request-1","status":202}`, <-msgFromAppChan)
+
+	_ = client.disconnect(ctx)
+
+	s.Eventually(func() bool { return len(s.eventsOf(connId)) == 3 }, time.Second*5, time.Millisecond*10)
+	events := s.eventsOf(connId)
+
+	s.Equal("connected", events[0]["type"])
+
+	s.Equal("message", events[1]["type"])
+	s.Equal("request-1", events[1]["correlationId"])
+	var relayed mockapp.MessageJSON
+	s.NoError(json.Unmarshal([]byte(events[1]["message"]), &relayed))
+	s.Equal(message, relayed)
+
+	s.Equal("disconnected", events[2]["type"])
+
+	// The application is still asked to authenticate the connection, but is notified of nothing else via HTTP
+	s.Len(s.mockApp.GetCalls(connId), 0)
+}
+
+func (s *redisStreamsDeliveryTestSuite) TestRedisClientClosedOnShutdown() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	redis := miniredis.NewMiniRedis()
+	s.Require().NoError(redis.Start())
+	defer redis.Close()
+
+	conf := config.Config{
+		ServerHost: "localhost",
+		AppBaseUrl: "http://" + s.mockApp.GetAppAddress(),
+		RedisStreamsDelivery: &config.RedisStreamsDeliveryConfig{
+			Address: redis.Addr(),
+			Stream:  testEventStream,
+		},
+	}
+	server := wsproxy.NewServer(ctx, conf, func() wsproxy.ConnectionID { return wsproxy.CreateID(ctx) })
+	ready := make(chan string)
+	go func() {
+		_ = server.SetupAndStart(func(port int, _ func()) { ready <- fmt.Sprintf("localhost:%d", port) })
+	}()
+
+	client := NewClient(<-ready, nil)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+	_ = client.disconnect(ctx)
+	s.Eventually(func() bool { return len(redis.Keys()) == 1 && redis.CurrentConnectionCount() > 0 }, time.Second*5, time.Millisecond*10)
+
+	server.Stop()
+	s.Eventually(func() bool { return redis.CurrentConnectionCount() == 0 }, time.Second*5, time.Millisecond*10)
+}
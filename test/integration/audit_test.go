@@ -0,0 +1,177 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const auditTestUserAgent = "audit-test-client/1.0"
+
+type auditTestSuite struct {
+	*baseTestSuite
+	auditFile string
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestAuditTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Audit = &config.AuditConfig{File: auditFile}
+		conf.Admin = &config.AdminConfig{
+			Authentication: config.BackendAuthConfig{
+				APIKeys: map[string]string{opsAPIKey: "ops"},
+			},
+		}
+	}
+
+	suite.Run(t, &auditTestSuite{baseTestSuite: base, auditFile: auditFile})
+}
+
+// auditRecords returns the records of the audit file of "event" for connection "connId" (if not empty)
+func (s *auditTestSuite) auditRecords(event string, connId wsproxy.ConnectionID) []map[string]any {
+	file, openErr := os.Open(s.auditFile)
+	if os.IsNotExist(openErr) {
+		return nil
+	}
+	s.Require().NoError(openErr)
+	defer file.Close()
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]any
+		s.Require().NoError(json.Unmarshal(scanner.Bytes(), &record))
+		if record["event"] != event {
+			continue
+		}
+		if len(connId) > 0 && record["connectionId"] != string(connId) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func (s *auditTestSuite) TestConnectAndDisconnectAudited() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"some credentials"},
+			"User-Agent":    []string{auditTestUserAgent},
+		},
+	})
+	s.Require().NoError(err)
+
+	connects := s.auditRecords("connect", connId)
+	s.Require().Len(connects, 1)
+	s.Equal("app", connects[0]["authMethod"])
+	s.Equal("127.0.0.1", connects[0]["remoteAddress"])
+	s.Equal(auditTestUserAgent, connects[0]["userAgent"])
+	s.NotEmpty(connects[0]["time"])
+
+	s.NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+
+	s.Eventually(func() bool { return len(s.auditRecords("disconnect", connId)) == 1 }, time.Second*5, time.Millisecond*10)
+	s.Equal("client_closed", s.auditRecords("disconnect", connId)[0]["reason"])
+}
+
+func (s *auditTestSuite) TestBackendCloseAudited() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s%s/%s", s.wsGateway.AdminAddr, wsproxy.ConnectionsPath, connId), nil)
+	s.Require().NoError(createReqErr)
+	request.Header.Set(wsproxy.APIKeyHeaderKey, opsAPIKey)
+	response, requestErr := http.DefaultClient.Do(request)
+	s.Require().NoError(requestErr)
+	response.Body.Close()
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	<-s.mockApp.OnDisconnect(connId)
+
+	closes := s.auditRecords("backend_close", connId)
+	s.Require().Len(closes, 1)
+	s.Equal("ops", closes[0]["backend"])
+
+	s.Eventually(func() bool { return len(s.auditRecords("disconnect", connId)) == 1 }, time.Second*5, time.Millisecond*10)
+	s.Equal("closed_by_app", s.auditRecords("disconnect", connId)[0]["reason"])
+}
+
+func (s *auditTestSuite) TestAuthFailureAudited() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.SetConnectRejection(connId, http.StatusUnauthorized, nil, nil)
+
+	failuresBefore := len(s.auditRecords("auth_failure", ""))
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, wsConnectErr := client.connect(ctx)
+	s.Error(wsConnectErr)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	failures := s.auditRecords("auth_failure", "")
+	s.Require().Len(failures, failuresBefore+1)
+	s.Equal("app", failures[failuresBefore]["authMethod"])
+	s.Equal(float64(http.StatusUnauthorized), failures[failuresBefore]["status"])
+	s.Empty(s.auditRecords("connect", connId))
+}
+
+func (s *auditTestSuite) TestThrottlingAuditedApartFromAuthFailures() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.SetConnectRejection(connId, http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}}, nil)
+
+	failuresBefore := len(s.auditRecords("auth_failure", ""))
+	throttledBefore := len(s.auditRecords("throttled", ""))
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, wsConnectErr := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"some credentials"}, "User-Agent": []string{auditTestUserAgent}},
+	})
+	s.Error(wsConnectErr)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+
+	throttled := s.auditRecords("throttled", "")
+	s.Require().Len(throttled, throttledBefore+1)
+	s.Equal(auditTestUserAgent, throttled[throttledBefore]["userAgent"])
+	s.Len(s.auditRecords("auth_failure", ""), failuresBefore)
+}
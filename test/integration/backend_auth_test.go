@@ -0,0 +1,144 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const backendAudience = "wsproxy"
+
+type backendAuthTestSuite struct {
+	*baseTestSuite
+	issuer *tokenIssuer
+}
+
+func TestBackendAuthTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestBackendAuthTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	issuer := newTokenIssuer()
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.BackendAuthentication = config.BackendAuthConfig{
+			APIKeys: map[string]string{
+				"pusher-key": "pusher",
+				"reader-key": "reader",
+			},
+			JWT: &config.JWTConfig{
+				Issuer:   testTokenIssuer,
+				JWKSURL:  issuer.jwksURL(),
+				Audience: backendAudience,
+			},
+			Permissions: map[string][]string{
+				"pusher":      {string(wsproxy.PushEndpoint)},
+				"reader":      {},
+				"jwt-backend": {"*"},
+			},
+		}
+	}
+
+	suite.Run(
+		t,
+		&backendAuthTestSuite{
+			baseTestSuite: base,
+			issuer:        issuer,
+		},
+	)
+}
+
+func (s *backendAuthTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.issuer.close()
+}
+
+func (s *backendAuthTestSuite) TestPushWithoutCredentials() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, err := s.pushToClient(ctx, wsproxy.CreateID(ctx), "hi", nil)
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *backendAuthTestSuite) TestPushWithUnknownAPIKey() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, err := s.pushToClient(ctx, wsproxy.CreateID(ctx), "hi", http.Header{
+		wsproxy.APIKeyHeaderKey: []string{"unknown-key"},
+	})
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *backendAuthTestSuite) TestPushWithoutPermission() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, err := s.pushToClient(ctx, wsproxy.CreateID(ctx), "hi", http.Header{
+		wsproxy.APIKeyHeaderKey: []string{"reader-key"},
+	})
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+}
+
+func (s *backendAuthTestSuite) TestPushWithTokenForOtherAudience() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	token := s.issuer.issue("jwt-backend", "some-other-service", nil)
+	response, err := s.pushToClient(ctx, wsproxy.CreateID(ctx), "hi", http.Header{
+		"Authorization": []string{"Bearer " + token},
+	})
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *backendAuthTestSuite) TestPushWithAPIKey() {
+	s.testPushAuthenticated(http.Header{
+		wsproxy.APIKeyHeaderKey: []string{"pusher-key"},
+	})
+}
+
+func (s *backendAuthTestSuite) TestPushWithJWT() {
+	token := s.issuer.issue("jwt-backend", backendAudience, nil)
+	s.testPushAuthenticated(http.Header{
+		"Authorization": []string{"Bearer " + token},
+	})
+}
+
+func (s *backendAuthTestSuite) testPushAuthenticated(header http.Header) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	msgToReceive := "message_" + xid.New().String()
+	response, err := s.pushToClient(ctx, connId, msgToReceive, header)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal(msgToReceive, <-msgFromAppChan)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
@@ -3,6 +3,9 @@ package integration
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"sync"
 	"wsproxy/internal/config"
 	"wsproxy/test/mockapp"
@@ -14,6 +17,13 @@ import (
 	wsproxy "wsproxy/internal"
 )
 
+// adminAPIKey authenticates the calls of the tests to the admin listener configured with adminAuthentication
+const adminAPIKey = "admin-key"
+
+var adminAuthentication = config.BackendAuthConfig{
+	APIKeys: map[string]string{adminAPIKey: "admin"},
+}
+
 type baseTestSuite struct {
 	suite.Suite
 	wsproxyServer   string
@@ -24,6 +34,8 @@ type baseTestSuite struct {
 	// Fall-back connection-id in case no generator is specified to be used in strictly sequential test cases
 	// testing in isolation the connection setup itself
 	nextConnId wsproxy.ConnectionID
+	// configure, if set, customizes the configuration of the wsproxy server under test
+	configure func(conf *config.Config)
 }
 
 func NewBaseTestSuite(ctx context.Context) *baseTestSuite {
@@ -48,14 +60,18 @@ func (s *baseTestSuite) SetupSuite() {
 
 	s.startMockApp()
 
+	conf := config.Config{
+		ServerHost: "localhost",
+		ServerPort: 0,
+		AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.GetAppAddress()),
+	}
+	if s.configure != nil {
+		s.configure(&conf)
+	}
+
 	server := wsproxy.NewServer(
 		s.ctx,
-		config.Config{
-			ServerHost:          "localhost",
-			ServerPort:          0,
-			AppBaseUrl:          fmt.Sprintf("http://%s", s.mockApp.GetAppAddress()),
-			LoadBalancerAddress: "",
-		},
+		conf,
 		func() wsproxy.ConnectionID {
 			if s.connIdGenerator == nil {
 				return s.nextConnId
@@ -97,6 +113,101 @@ func (s *baseTestSuite) assertArguments(call *mock.Call, objects ...interface{})
 	call.Arguments.Assert(s.T(), objects...)
 }
 
+// pushToClient calls the proxy's push endpoint with the given headers set on the request
+func (s *baseTestSuite) pushToClient(ctx context.Context, connId wsproxy.ConnectionID, message string, header http.Header) (*http.Response, error) {
+	return s.postToProxy(ctx, fmt.Sprintf("%s/%s", wsproxy.MessagePath, connId), message, header)
+}
+
+// publishToTopic calls the proxy's topic publishing endpoint with the given headers set on the request
+func (s *baseTestSuite) publishToTopic(ctx context.Context, topic string, message string, header http.Header) (*http.Response, error) {
+	return s.postToProxy(ctx, fmt.Sprintf("%s/%s", wsproxy.TopicPath, topic), message, header)
+}
+
+func (s *baseTestSuite) postToProxy(ctx context.Context, path string, message string, header http.Header) (*http.Response, error) {
+	url := fmt.Sprintf("http://%s%s", s.wsproxyServer, path)
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(message))
+	if createReqErr != nil {
+		return nil, createReqErr
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	response, requestErr := http.DefaultClient.Do(request)
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	response.Body.Close()
+	return response, nil
+}
+
+// postJSONToProxy calls a POST endpoint of the proxy expecting JSON and returns the response along with its body
+func (s *baseTestSuite) postJSONToProxy(ctx context.Context, path string, body string) (*http.Response, string, error) {
+	return s.sendJSONToProxy(ctx, http.MethodPost, path, body)
+}
+
+func (s *baseTestSuite) sendJSONToProxy(ctx context.Context, method string, path string, body string) (*http.Response, string, error) {
+	return s.sendJSON(ctx, s.wsproxyServer, method, path, body, nil)
+}
+
+// getFromAdmin calls a GET endpoint of the admin listener (configured with adminAuthentication) and returns the
+// response along with its body
+func (s *baseTestSuite) getFromAdmin(ctx context.Context, path string) (*http.Response, string, error) {
+	return s.sendJSONToAdmin(ctx, http.MethodGet, path, "")
+}
+
+// deleteOnAdmin calls a DELETE endpoint of the admin listener (configured with adminAuthentication) and returns the
+// response along with its body
+func (s *baseTestSuite) deleteOnAdmin(ctx context.Context, path string, body string) (*http.Response, string, error) {
+	return s.sendJSONToAdmin(ctx, http.MethodDelete, path, body)
+}
+
+func (s *baseTestSuite) sendJSONToAdmin(ctx context.Context, method string, path string, body string) (*http.Response, string, error) {
+	return s.sendJSON(ctx, s.wsGateway.AdminAddr, method, path, body, http.Header{wsproxy.APIKeyHeaderKey: []string{adminAPIKey}})
+}
+
+func (s *baseTestSuite) sendJSON(ctx context.Context, address string, method string, path string, body string, header http.Header) (*http.Response, string, error) {
+	url := fmt.Sprintf("http://%s%s", address, path)
+	request, createReqErr := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if createReqErr != nil {
+		return nil, "", createReqErr
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, requestErr := http.DefaultClient.Do(request)
+	if requestErr != nil {
+		return nil, "", requestErr
+	}
+	defer response.Body.Close()
+	responseBody, readErr := io.ReadAll(response.Body)
+	if readErr != nil {
+		return nil, "", readErr
+	}
+	return response, string(responseBody), nil
+}
+
+// getFromProxy calls a GET endpoint of the proxy and returns the response along with its body
+func (s *baseTestSuite) getFromProxy(ctx context.Context, path string) (*http.Response, string, error) {
+	url := fmt.Sprintf("http://%s%s", s.wsproxyServer, path)
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if createReqErr != nil {
+		return nil, "", createReqErr
+	}
+	response, requestErr := http.DefaultClient.Do(request)
+	if requestErr != nil {
+		return nil, "", requestErr
+	}
+	defer response.Body.Close()
+	responseBody, readErr := io.ReadAll(response.Body)
+	if readErr != nil {
+		return nil, "", readErr
+	}
+	return response, string(responseBody), nil
+}
+
 func toWsMessage(content string) mockapp.MessageJSON {
 	return mockapp.MessageJSON{"message": content}
 }
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	wsproxy "wsproxy/internal"
 	"wsproxy/test/mockapp"
 
@@ -25,12 +26,17 @@ type Client struct {
 	connectionId   wsproxy.ConnectionID
 	proxyUrl       string
 	msgFromAppChan chan string
+	// connectQuery, if set, is sent as the query string of the connect request
+	connectQuery url.Values
+	// closed receives the close status of the connection if the proxy closes it
+	closed chan websocket.CloseError
 }
 
 func NewClient(proxyUrl string, msgFromAppChan chan string) *Client {
 	return &Client{
 		proxyUrl:       proxyUrl,
 		msgFromAppChan: msgFromAppChan,
+		closed:         make(chan websocket.CloseError, 1),
 	}
 }
 
@@ -63,7 +69,7 @@ func (c *Client) readConnId(ctx context.Context) (wsproxy.ConnectionID, error) {
 }
 
 func (c *Client) connect(ctx context.Context, connectOptions ...*websocket.DialOptions) (*http.Response, error) {
-	conn, httpResponse, err := connectToWsproxy(ctx, c.proxyUrl, connectOptions...)
+	conn, httpResponse, err := connectToWsproxy(ctx, c.proxyUrl, c.connectQuery, connectOptions...)
 	if err != nil {
 		return httpResponse, err
 	}
@@ -81,6 +87,12 @@ func (c *Client) connect(ctx context.Context, connectOptions ...*websocket.DialO
 			msgType, msgFromApp, readErr := conn.Read(ctx)
 			if readErr != nil {
 				var closeError websocket.CloseError
+				if errors.As(readErr, &closeError) {
+					select {
+					case c.closed <- closeError:
+					default:
+					}
+				}
 				if errors.As(readErr, &closeError) && closeError.Code == websocket.StatusNormalClosure {
 					readFromAppLogger.Debug().Msg("Client closed the connection normally")
 					return
@@ -107,10 +119,14 @@ func (c *Client) writeMessage(ctx context.Context, message mockapp.MessageJSON)
 	return wsjson.Write(ctx, c.wsConn, message)
 }
 
-func connectToWsproxy(ctx context.Context, proxyUrl string, connectOptions ...*websocket.DialOptions) (*websocket.Conn, *http.Response, error) {
+func connectToWsproxy(ctx context.Context, proxyUrl string, query url.Values, connectOptions ...*websocket.DialOptions) (*websocket.Conn, *http.Response, error) {
 	options := defaultConnectOptions
 	if connectOptions != nil {
 		options = connectOptions[0]
 	}
-	return websocket.Dial(ctx, fmt.Sprintf("ws://%s%s", proxyUrl, wsproxy.ConnectPath), options)
+	connectUrl := fmt.Sprintf("ws://%s%s", proxyUrl, wsproxy.ConnectPath)
+	if len(query) > 0 {
+		connectUrl = fmt.Sprintf("%s?%s", connectUrl, query.Encode())
+	}
+	return websocket.Dial(ctx, connectUrl, options)
 }
@@ -0,0 +1,124 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const (
+	clientAudience        = "wsproxy-clients"
+	clientTokenQueryParam = "access_token"
+)
+
+type clientAuthTestSuite struct {
+	*baseTestSuite
+	issuer *tokenIssuer
+}
+
+func TestClientAuthTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestClientAuthTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	issuer := newTokenIssuer()
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ClientJWT = &config.ClientJWTConfig{
+			JWTConfig: config.JWTConfig{
+				Issuer:   testTokenIssuer,
+				JWKSURL:  issuer.jwksURL(),
+				Audience: clientAudience,
+			},
+			TenantClaim:     "tenant",
+			TokenQueryParam: clientTokenQueryParam,
+		}
+	}
+
+	suite.Run(
+		t,
+		&clientAuthTestSuite{
+			baseTestSuite: base,
+			issuer:        issuer,
+		},
+	)
+}
+
+func (s *clientAuthTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.issuer.close()
+}
+
+func (s *clientAuthTestSuite) TestConnectWithTokenInHeader() {
+	token := s.issuer.issue("user-1", clientAudience, map[string]any{"tenant": "tenant-1"})
+
+	s.testConnectAuthenticatedLocally(NewClient(s.wsproxyServer, nil), &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+}
+
+func (s *clientAuthTestSuite) TestConnectWithTokenInQueryParam() {
+	token := s.issuer.issue("user-1", clientAudience, map[string]any{"tenant": "tenant-1"})
+
+	client := NewClient(s.wsproxyServer, nil)
+	client.connectQuery = url.Values{clientTokenQueryParam: []string{token}}
+	s.testConnectAuthenticatedLocally(client, &websocket.DialOptions{})
+}
+
+func (s *clientAuthTestSuite) TestConnectWithInvalidToken() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	token := s.issuer.issue("user-1", "some-other-audience", nil)
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, wsConnectErr := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+	s.Error(wsConnectErr)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	s.Len(s.mockApp.GetCalls(connId), 0)
+}
+
+func (s *clientAuthTestSuite) testConnectAuthenticatedLocally(client *Client, options *websocket.DialOptions) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	s.mockApp.On(mockapp.MockMethodConnected, connId, "user-1", "tenant-1")
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	_, err := client.connect(ctx, options)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	s.Equal(connId, client.connectionId)
+
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 1 }, time.Second*5, time.Millisecond*10)
+	call := s.getCall(connId, 0)
+	s.Equal(mockapp.MockMethodConnected, call.Method)
+	s.assertArguments(&call, "user-1", "tenant-1")
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	s.Len(s.mockApp.GetCalls(connId), 2)
+	call = s.getCall(connId, 1)
+	s.Equal(mockapp.MockMethodDisconnected, call.Method)
+}
@@ -0,0 +1,149 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+type closeConnectionTestSuite struct {
+	*baseTestSuite
+}
+
+func TestCloseConnectionTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestCloseConnectionTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+	}
+
+	suite.Run(
+		t,
+		&closeConnectionTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+// connectAs connects a client of the user
+func (s *closeConnectionTestSuite) connectAs(ctx context.Context, userId string, msgFromAppChan chan string) *Client {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"userId": userId})
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	return client
+}
+
+func (s *closeConnectionTestSuite) TestCloseConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 1)
+	client := s.connectAs(ctx, "user-1", msgFromAppChan)
+
+	response, _, err := s.deleteOnAdmin(
+		ctx,
+		fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, client.connectionId),
+		`{"code":4001,"reason":"banned","message":"goodbye"}`,
+	)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	s.Equal("goodbye", <-msgFromAppChan)
+	closeStatus := <-client.closed
+	s.Equal(websocket.StatusCode(4001), closeStatus.Code)
+	s.Equal("banned", closeStatus.Reason)
+
+	<-s.mockApp.OnDisconnect(client.connectionId)
+	s.Equal(wsproxy.ClosedByAppReason, s.mockApp.GetDisconnectReason(client.connectionId))
+}
+
+func (s *closeConnectionTestSuite) TestCloseConnectionWithoutBody() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := s.connectAs(ctx, "user-1", nil)
+
+	response, _, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, client.connectionId), "")
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	s.Equal(websocket.StatusNormalClosure, (<-client.closed).Code)
+	<-s.mockApp.OnDisconnect(client.connectionId)
+}
+
+func (s *closeConnectionTestSuite) TestCloseUnknownConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	response, _, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, "unknown"), "")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
+
+func (s *closeConnectionTestSuite) TestCloseWithInvalidCode() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := s.connectAs(ctx, "user-1", nil)
+
+	response, _, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, client.connectionId), `{"code":1006}`)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(client.connectionId)
+	s.Empty(s.mockApp.GetDisconnectReason(client.connectionId))
+}
+
+func (s *closeConnectionTestSuite) TestCloseUserConnections() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	bannedClients := []*Client{s.connectAs(ctx, "banned-user", nil), s.connectAs(ctx, "banned-user", nil)}
+	otherMsgChan := make(chan string, 1)
+	otherClient := s.connectAs(ctx, "other-user", otherMsgChan)
+
+	response, body, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s%s", wsproxy.UsersPath, "banned-user", wsproxy.ConnectionsPath), `{"reason":"banned"}`)
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.JSONEq(`{"closed":2}`, body)
+
+	// The mock app serves the disconnections one at a time, so they are to be waited for at the same time
+	var disconnections sync.WaitGroup
+	for _, client := range bannedClients {
+		s.Equal("banned", (<-client.closed).Reason)
+		disconnections.Add(1)
+		go func() {
+			defer disconnections.Done()
+			<-s.mockApp.OnDisconnect(client.connectionId)
+		}()
+	}
+	disconnections.Wait()
+	for _, client := range bannedClients {
+		s.Equal(wsproxy.ClosedByAppReason, s.mockApp.GetDisconnectReason(client.connectionId))
+	}
+
+	pushResponse, pushErr := s.pushToClient(ctx, otherClient.connectionId, "still here", nil)
+	s.NoError(pushErr)
+	s.Equal(http.StatusNoContent, pushResponse.StatusCode)
+	s.Equal("still here", <-otherMsgChan)
+
+	_ = otherClient.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(otherClient.connectionId)
+}
@@ -0,0 +1,157 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+type connectionLimitsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestConnectionLimitsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestConnectionLimitsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ConnectionLimits = config.ConnectionLimitsConfig{
+			MaxConnections:        3,
+			MaxConnectionsPerIP:   1,
+			MaxConnectionsPerUser: 1,
+		}
+		// the test clients, connecting from the loopback, pose as proxies to pick their IP by "X-Forwarded-For"
+		conf.ConnectForwarding = config.ConnectForwardingConfig{TrustedProxies: []string{"127.0.0.0/8", "::1"}}
+	}
+
+	suite.Run(t, &connectionLimitsTestSuite{baseTestSuite: base})
+}
+
+type untrustedProxyLimitsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestUntrustedProxyLimitsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestUntrustedProxyLimitsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ConnectionLimits = config.ConnectionLimitsConfig{MaxConnectionsPerIP: 1}
+	}
+
+	suite.Run(t, &untrustedProxyLimitsTestSuite{baseTestSuite: base})
+}
+
+// connectFrom connects a client of the user (if not empty) claiming by "X-Forwarded-For" to be connecting from "ip"
+func (s *baseTestSuite) connectFrom(ctx context.Context, ip string, userId string) (*Client, wsproxy.ConnectionID, *http.Response, error) {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	if len(userId) > 0 {
+		s.mockApp.SetConnectResponse(connId, map[string]any{"userId": userId})
+	}
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":   []string{"some credentials"},
+			"X-Forwarded-For": []string{ip},
+		},
+	})
+	return client, connId, response, err
+}
+
+func (s *baseTestSuite) disconnect(ctx context.Context, client *Client, connId wsproxy.ConnectionID) {
+	s.NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *connectionLimitsTestSuite) TestConnectionsLimitedByIP() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId, _, err := s.connectFrom(ctx, "10.0.0.1", "")
+	s.Require().NoError(err)
+
+	_, rejectedConnId, response, rejectedErr := s.connectFrom(ctx, "10.0.0.1", "")
+	s.Error(rejectedErr)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+	s.Empty(s.mockApp.GetCalls(rejectedConnId))
+
+	s.disconnect(ctx, client, connId)
+
+	client, connId, _, err = s.connectFrom(ctx, "10.0.0.1", "")
+	s.Require().NoError(err)
+	s.disconnect(ctx, client, connId)
+}
+
+func (s *connectionLimitsTestSuite) TestConnectionsLimitedByUser() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId, _, err := s.connectFrom(ctx, "10.0.1.1", "user-1")
+	s.Require().NoError(err)
+	defer s.disconnect(ctx, client, connId)
+
+	_, rejectedConnId, response, rejectedErr := s.connectFrom(ctx, "10.0.1.2", "user-1")
+	s.Error(rejectedErr)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+
+	// the application, having accepted the connection, learns of its rejection
+	<-s.mockApp.OnDisconnect(rejectedConnId)
+	calls := s.mockApp.GetCalls(rejectedConnId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodConnect, calls[0].Method)
+	s.Equal(mockapp.MockMethodDisconnected, calls[1].Method)
+	s.Equal(wsproxy.ConnectionLimitReason, s.mockApp.GetDisconnectReason(rejectedConnId))
+
+	otherClient, otherConnId, _, otherErr := s.connectFrom(ctx, "10.0.1.3", "user-2")
+	s.Require().NoError(otherErr)
+	s.disconnect(ctx, otherClient, otherConnId)
+}
+
+func (s *connectionLimitsTestSuite) TestConnectionsLimitedInTotal() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	for _, ip := range []string{"10.0.2.1", "10.0.2.2", "10.0.2.3"} {
+		client, connId, _, err := s.connectFrom(ctx, ip, "")
+		s.Require().NoError(err)
+		defer s.disconnect(ctx, client, connId)
+	}
+
+	_, _, response, rejectedErr := s.connectFrom(ctx, "10.0.2.4", "")
+	s.Error(rejectedErr)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+
+	readyResponse, body, readyErr := s.getFromProxy(ctx, wsproxy.ReadyzPath)
+	s.NoError(readyErr)
+	s.Equal(http.StatusServiceUnavailable, readyResponse.StatusCode)
+	s.Contains(body, `"connections":{"status":"failed"`)
+}
+
+func (s *untrustedProxyLimitsTestSuite) TestSpoofedForwardedForIgnored() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId, _, err := s.connectFrom(ctx, "10.0.3.1", "")
+	s.Require().NoError(err)
+	defer s.disconnect(ctx, client, connId)
+
+	// both clients connect from the loopback, whatever "X-Forwarded-For" they claim
+	_, rejectedConnId, response, rejectedErr := s.connectFrom(ctx, "10.0.3.2", "")
+	s.Error(rejectedErr)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+	s.Empty(s.mockApp.GetCalls(rejectedConnId))
+}
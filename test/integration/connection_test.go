@@ -2,10 +2,15 @@ package integration
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
 	"wsproxy/internal/logging"
 	"wsproxy/test/mockapp"
 
@@ -21,14 +26,77 @@ type connectingTestSuite struct {
 func TestConnectingTestSuite(t *testing.T) {
 	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestConnectingTestSuite").Logger()
 	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ConnectForwarding = config.ConnectForwardingConfig{
+			AllowedHeaders: append([]string{"X-Device-Id"}, config.DefaultConnectHeaders...),
+			HeaderRenames:  map[string]string{"X-Device-Id": "X-Client-Device-Id"},
+		}
+	}
 	suite.Run(
 		t,
 		&connectingTestSuite{
-			baseTestSuite: NewBaseTestSuite(ctx),
+			baseTestSuite: base,
 		},
 	)
 }
 
+type trustedProxyTestSuite struct {
+	*baseTestSuite
+}
+
+func TestTrustedProxyTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestTrustedProxyTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ConnectForwarding = config.ConnectForwardingConfig{TrustedProxies: []string{"10.1.0.1", "127.0.0.0/8"}}
+	}
+	suite.Run(t, &trustedProxyTestSuite{baseTestSuite: base})
+}
+
+func (s *trustedProxyTestSuite) TestForwardingHeadersOfTrustedProxyExtended() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":     []string{"some credentials"},
+			"X-Forwarded-For":   []string{"10.0.0.1"},
+			"X-Forwarded-Proto": []string{"https"},
+			"X-Forwarded-Host":  []string{"app.example.com"},
+			"Forwarded":         []string{"for=10.0.0.1"},
+		},
+	})
+	s.Require().NoError(err)
+	defer func() {
+		client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	connectRequest := s.mockApp.GetConnectRequest(connId)
+	s.Require().NotNil(connectRequest)
+	s.Equal("10.0.0.1, 127.0.0.1", connectRequest.Header.Get("X-Forwarded-For"))
+	s.Equal("https", connectRequest.Header.Get("X-Forwarded-Proto"))
+	s.Equal("app.example.com", connectRequest.Header.Get("X-Forwarded-Host"))
+	s.Equal(`for=10.0.0.1, for=127.0.0.1;host="app.example.com";proto=https`, connectRequest.Header.Get("Forwarded"))
+}
+
+func (s *trustedProxyTestSuite) TestInvalidTrustedProxyRejectedAtStartup() {
+	conf := config.Config{
+		ServerHost:        "localhost",
+		AppBaseUrl:        "http://" + s.mockApp.GetAppAddress(),
+		ConnectForwarding: config.ConnectForwardingConfig{TrustedProxies: []string{"10.0.0.0/33"}},
+	}
+	server := wsproxy.NewServer(s.ctx, conf, func() wsproxy.ConnectionID { return wsproxy.CreateID(s.ctx) })
+	s.Error(server.SetupAndStart(nil))
+}
+
 func (s *connectingTestSuite) TestConnectionID() {
 	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
 	defer cancel()
@@ -122,3 +190,198 @@ func (s *connectingTestSuite) TestDisconnection() {
 	s.Equal(mockapp.MockMethodDisconnected, call.Method)
 	zerolog.Ctx(s.ctx).Debug().Msg("TestDisconnection: test finished")
 }
+
+func (s *connectingTestSuite) TestConnectRequestForwarding() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	client := NewClient(s.wsproxyServer, nil)
+	client.connectQuery = url.Values{"device": []string{"phone"}}
+
+	s.mockApp.ExpectConnDisconn(connId)
+
+	_, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":   []string{"some credentials"},
+			"Cookie":          []string{"session=abc"},
+			"X-Device-Id":     []string{"device-1"},
+			"X-Not-Forwarded": []string{"secret"},
+			// not from a trusted proxy, the forwarding headers of the client are replaced
+			"X-Forwarded-For":   []string{"10.0.0.1"},
+			"X-Forwarded-Proto": []string{"https"},
+			"X-Forwarded-Host":  []string{"evil.test"},
+			"Forwarded":         []string{"for=10.0.0.1"},
+		},
+	})
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer func() {
+		client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	connectRequest := s.mockApp.GetConnectRequest(connId)
+	s.NotNil(connectRequest)
+	if connectRequest == nil {
+		return
+	}
+
+	s.Equal("some credentials", connectRequest.Header.Get("Authorization"))
+	s.Equal("session=abc", connectRequest.Header.Get("Cookie"))
+	s.Equal("device-1", connectRequest.Header.Get("X-Client-Device-Id"))
+	s.Empty(connectRequest.Header.Get("X-Device-Id"))
+	s.Empty(connectRequest.Header.Get("X-Not-Forwarded"))
+	s.Empty(connectRequest.Header.Get("Sec-WebSocket-Key"))
+	s.Empty(connectRequest.Header.Get("Upgrade"))
+
+	s.Equal("127.0.0.1", connectRequest.Header.Get("X-Forwarded-For"))
+	s.Equal("http", connectRequest.Header.Get("X-Forwarded-Proto"))
+	s.Equal(s.wsproxyServer, connectRequest.Header.Get("X-Forwarded-Host"))
+	s.Equal(fmt.Sprintf("for=127.0.0.1;host=%q;proto=http", s.wsproxyServer), connectRequest.Header.Get("Forwarded"))
+
+	s.Equal("phone", connectRequest.Query.Get("device"))
+}
+
+func (s *connectingTestSuite) TestReadErrorClosesConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, make(chan string, 1))
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+
+	// a message over the read limit fails the read without closing the connection
+	s.NoError(client.writeMessage(ctx, toWsMessage(strings.Repeat("x", 64<<10))))
+	s.Equal(websocket.StatusMessageTooBig, (<-client.closed).Code)
+	<-s.mockApp.OnDisconnect(connId)
+
+	// nothing was relayed to the application in between
+	calls := s.mockApp.GetCalls(connId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodConnect, calls[0].Method)
+	s.Equal(mockapp.MockMethodDisconnected, calls[1].Method)
+}
+
+func (s *connectingTestSuite) TestConnectResponseShapesConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	msgFromAppChan := make(chan string, 2)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+
+	message := toWsMessage("hi")
+
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.mockApp.SetConnectResponse(connId, map[string]any{
+		"userId":        "user-1",
+		"tenantId":      "tenant-1",
+		"subscriptions": []string{"news"},
+		"metadata":      map[string]string{"plan": "pro"},
+		"welcome":       map[string]string{"hello": "world"},
+	})
+
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer func() {
+		client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.JSONEq(`{"hello":"world"}`, <-msgFromAppChan)
+
+	response, publishErr := s.publishToTopic(ctx, "news", "breaking", nil)
+	s.NoError(publishErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("breaking", <-msgFromAppChan)
+
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+
+	messageHeader := s.mockApp.GetLastMessageHeader(connId)
+	s.Equal("user-1", messageHeader.Get(wsproxy.UserIDHeaderKey))
+	s.Equal("tenant-1", messageHeader.Get(wsproxy.TenantIDHeaderKey))
+	s.JSONEq(`{"plan":"pro"}`, messageHeader.Get(wsproxy.MetadataHeaderKey))
+}
+
+func (s *connectingTestSuite) TestMaxConnectionLifetime() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	client := NewClient(s.wsproxyServer, nil)
+
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"maxLifetimeSeconds": 1})
+
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+
+	select {
+	case <-s.mockApp.OnDisconnect(connId):
+	case <-time.After(time.Second * 5):
+		s.Fail("connection not closed after its maximum lifetime")
+	}
+}
+
+func (s *connectingTestSuite) TestConnectRejectionPassedThrough() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	s.mockApp.SetConnectRejection(
+		connId,
+		http.StatusTooManyRequests,
+		http.Header{"Retry-After": []string{"30"}},
+		map[string]string{"error": "too many devices"},
+	)
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, wsConnectErr := client.connect(ctx)
+	s.Error(wsConnectErr)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+	s.Equal("30", response.Header.Get("Retry-After"))
+	s.Equal("application/json", response.Header.Get("Content-Type"))
+
+	body, readErr := io.ReadAll(response.Body)
+	s.NoError(readErr)
+	s.JSONEq(`{"error":"too many devices"}`, string(body))
+}
+
+func (s *connectingTestSuite) TestConnectRejectionNotPassedThrough() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+
+	s.mockApp.SetConnectRejection(connId, http.StatusTeapot, nil, map[string]string{"error": "internal detail"})
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, wsConnectErr := client.connect(ctx)
+	s.Error(wsConnectErr)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+}
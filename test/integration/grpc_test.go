@@ -0,0 +1,256 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/grpcapi"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+const grpcBackendAPIKey = "grpc-backend-key"
+
+type grpcTestSuite struct {
+	*baseTestSuite
+	clientConn  *grpc.ClientConn
+	client      grpcapi.WsproxyServiceClient
+	adminClient grpcapi.WsproxyAdminServiceClient
+}
+
+func TestGRPCTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestGRPCTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.GRPC = &config.GRPCConfig{}
+		conf.HTTPTimeouts = config.HTTPTimeoutsConfig{PushTimeout: 200 * time.Millisecond}
+		conf.Subprotocols = []string{"mqtt"}
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+		conf.BackendAuthentication = config.BackendAuthConfig{
+			APIKeys: map[string]string{grpcBackendAPIKey: "grpc-backend"},
+		}
+	}
+
+	suite.Run(
+		t,
+		&grpcTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+func (s *grpcTestSuite) SetupSuite() {
+	s.baseTestSuite.SetupSuite()
+
+	clientConn, dialErr := grpc.NewClient(s.wsGateway.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if dialErr != nil {
+		panic(dialErr)
+	}
+	s.clientConn = clientConn
+	s.client = grpcapi.NewWsproxyServiceClient(clientConn)
+	s.adminClient = grpcapi.NewWsproxyAdminServiceClient(clientConn)
+}
+
+func (s *grpcTestSuite) TearDownSuite() {
+	s.clientConn.Close()
+	s.baseTestSuite.TearDownSuite()
+}
+
+// authenticated returns the context of calls carrying the back-end's credentials
+func (s *grpcTestSuite) authenticated(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-wsgw-api-key", grpcBackendAPIKey)
+}
+
+// authenticatedAsAdmin returns the context of calls carrying the admin's credentials
+func (s *grpcTestSuite) authenticatedAsAdmin(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-wsgw-api-key", adminAPIKey)
+}
+
+func (s *grpcTestSuite) TestPush() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	_, pushErr := s.client.Push(s.authenticated(ctx), &grpcapi.PushRequest{ConnectionId: string(connId), Message: "hello"})
+	s.NoError(pushErr)
+	s.Equal("hello", <-msgFromAppChan)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *grpcTestSuite) TestPushToUnknownConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, pushErr := s.client.Push(s.authenticated(ctx), &grpcapi.PushRequest{ConnectionId: "unknown", Message: "hello"})
+	s.Equal(codes.NotFound, status.Code(pushErr))
+}
+
+func (s *grpcTestSuite) TestPushToSlowConnectionTimesOut() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 2)
+	client, connId := s.connectRateLimited(ctx, time.Minute, msgFromAppChan)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	_, pushErr := s.client.Push(s.authenticated(ctx), &grpcapi.PushRequest{ConnectionId: string(connId), Message: "first"})
+	s.Require().NoError(pushErr)
+	s.Equal("first", <-msgFromAppChan)
+
+	// without a deadline of the caller, the push timeout applies as to HTTP pushes
+	start := time.Now()
+	_, pushErr = s.client.Push(s.authenticated(s.ctx), &grpcapi.PushRequest{ConnectionId: string(connId), Message: "second"})
+	s.Equal(codes.Unavailable, status.Code(pushErr))
+	s.Less(time.Since(start), 5*time.Second)
+}
+
+func (s *grpcTestSuite) TestUnauthenticatedCallRejected() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, pushErr := s.client.Push(ctx, &grpcapi.PushRequest{ConnectionId: "some-connection", Message: "hello"})
+	s.Equal(codes.Unauthenticated, status.Code(pushErr))
+
+	_, broadcastErr := s.client.Broadcast(
+		metadata.AppendToOutgoingContext(ctx, "x-wsgw-api-key", "wrong-key"),
+		&grpcapi.BroadcastRequest{Topic: "news", Message: "hello"},
+	)
+	s.Equal(codes.Unauthenticated, status.Code(broadcastErr))
+}
+
+func (s *grpcTestSuite) TestAdminServiceRequiresAdminCredentials() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, getErr := s.adminClient.GetConnection(s.authenticated(ctx), &grpcapi.GetConnectionRequest{ConnectionId: "some-connection"})
+	s.Equal(codes.Unauthenticated, status.Code(getErr))
+
+	_, closeErr := s.adminClient.CloseUserConnections(s.authenticated(ctx), &grpcapi.CloseUserConnectionsRequest{UserId: "user-1"})
+	s.Equal(codes.Unauthenticated, status.Code(closeErr))
+
+	// the connection methods aren't part of the back-end service anymore
+	invokeErr := s.clientConn.Invoke(
+		s.authenticated(ctx),
+		"/wsproxy.v1.WsproxyService/GetConnection",
+		&grpcapi.GetConnectionRequest{ConnectionId: "some-connection"},
+		&grpcapi.Connection{},
+	)
+	s.Equal(codes.Unimplemented, status.Code(invokeErr))
+
+	_, getErr = s.adminClient.GetConnection(s.authenticatedAsAdmin(ctx), &grpcapi.GetConnectionRequest{ConnectionId: "some-connection"})
+	s.Equal(codes.NotFound, status.Code(getErr))
+}
+
+func (s *grpcTestSuite) TestBroadcastAndGetConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{
+		"userId":        "user-1",
+		"tenantId":      "tenant-1",
+		"subscriptions": []string{"news"},
+	})
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader:   http.Header{"Authorization": []string{"some credentials"}},
+		Subprotocols: []string{"mqtt"},
+	})
+	s.NoError(err)
+
+	connection, getErr := s.adminClient.GetConnection(s.authenticatedAsAdmin(ctx), &grpcapi.GetConnectionRequest{ConnectionId: string(connId)})
+	s.NoError(getErr)
+	s.Equal(string(connId), connection.Id)
+	s.Equal("user-1", connection.UserId)
+	s.Equal("tenant-1", connection.TenantId)
+	s.Equal([]string{"news"}, connection.Topics)
+	s.Equal("mqtt", connection.Subprotocol)
+	s.NotNil(connection.ConnectedAt)
+
+	list, listErr := s.adminClient.ListConnections(s.authenticatedAsAdmin(ctx), &grpcapi.ListConnectionsRequest{UserId: "user-1", Topic: "news"})
+	s.NoError(listErr)
+	s.Equal(int32(1), list.Total)
+	s.Equal(string(connId), list.Connections[0].Id)
+
+	_, broadcastErr := s.client.Broadcast(s.authenticated(ctx), &grpcapi.BroadcastRequest{Topic: "news", Message: "breaking"})
+	s.NoError(broadcastErr)
+	s.Equal("breaking", <-msgFromAppChan)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	_, getErr = s.adminClient.GetConnection(s.authenticatedAsAdmin(ctx), &grpcapi.GetConnectionRequest{ConnectionId: string(connId)})
+	s.Equal(codes.NotFound, status.Code(getErr))
+}
+
+func (s *grpcTestSuite) TestCloseConnectionAndLifecycleEvents() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	events, subscribeErr := s.client.SubscribeConnectionEvents(s.authenticated(ctx), &grpcapi.SubscribeConnectionEventsRequest{})
+	s.NoError(subscribeErr)
+	// The headers are sent once the subscription is set up
+	_, headerErr := events.Header()
+	s.NoError(headerErr)
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"userId": "user-1"})
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	connected, recvErr := events.Recv()
+	s.NoError(recvErr)
+	s.Equal(grpcapi.ConnectionEvent_TYPE_CONNECTED, connected.Type)
+	s.Equal(string(connId), connected.ConnectionId)
+	s.Equal("user-1", connected.UserId)
+
+	_, closeErr := s.adminClient.CloseConnection(
+		s.authenticatedAsAdmin(ctx),
+		&grpcapi.CloseConnectionRequest{ConnectionId: string(connId), Code: int32(websocket.StatusPolicyViolation), Reason: "banned"},
+	)
+	s.NoError(closeErr)
+
+	closeStatus := <-client.closed
+	s.Equal(websocket.StatusPolicyViolation, closeStatus.Code)
+	s.Equal("banned", closeStatus.Reason)
+	<-s.mockApp.OnDisconnect(connId)
+
+	disconnected, recvErr := events.Recv()
+	s.NoError(recvErr)
+	s.Equal(grpcapi.ConnectionEvent_TYPE_DISCONNECTED, disconnected.Type)
+	s.Equal(string(connId), disconnected.ConnectionId)
+}
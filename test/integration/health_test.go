@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type healthReport struct {
+	Status string
+	Checks map[string]struct {
+		Status string
+		Error  string
+	}
+}
+
+type healthTestSuite struct {
+	*baseTestSuite
+	redis *miniredis.Miniredis
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestHealthTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	redis := miniredis.NewMiniRedis()
+	if startErr := redis.Start(); startErr != nil {
+		t.Fatal(startErr)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.RedisHost = redis.Host()
+		conf.RedisPort = redisPort
+		conf.RelaySecret = "relay-secret"
+		conf.Readiness = config.ReadinessConfig{CheckApp: true, CheckTimeout: time.Second}
+	}
+
+	suite.Run(
+		t,
+		&healthTestSuite{
+			baseTestSuite: base,
+			redis:         redis,
+		},
+	)
+}
+
+func (s *healthTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.redis.Close()
+}
+
+func (s *healthTestSuite) getHealthReport(ctx context.Context, path string) (int, healthReport) {
+	response, body, err := s.getFromProxy(ctx, path)
+	s.NoError(err)
+	var report healthReport
+	s.NoError(json.Unmarshal([]byte(body), &report))
+	return response.StatusCode, report
+}
+
+func (s *healthTestSuite) TestAlive() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	statusCode, report := s.getHealthReport(ctx, wsproxy.HealthzPath)
+	s.Equal(http.StatusOK, statusCode)
+	s.Equal("ok", report.Status)
+}
+
+func (s *healthTestSuite) TestReadyWithDependenciesUp() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	statusCode, report := s.getHealthReport(ctx, wsproxy.ReadyzPath)
+	s.Equal(http.StatusOK, statusCode)
+	s.Equal("ok", report.Status)
+	s.Len(report.Checks, 3)
+	for name, check := range report.Checks {
+		s.Equal("ok", check.Status, name)
+	}
+}
+
+func (s *healthTestSuite) TestNotReadyWithRedisDown() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.redis.Close()
+	defer func() {
+		s.NoError(s.redis.Restart())
+	}()
+
+	statusCode, report := s.getHealthReport(ctx, wsproxy.ReadyzPath)
+	s.Equal(http.StatusServiceUnavailable, statusCode)
+	s.Equal("failed", report.Status)
+	s.Equal("failed", report.Checks["redis"].Status)
+	s.NotEmpty(report.Checks["redis"].Error)
+	s.Equal("ok", report.Checks["app"].Status)
+	s.Equal("ok", report.Checks["draining"].Status)
+
+	aliveStatusCode, _ := s.getHealthReport(ctx, wsproxy.HealthzPath)
+	s.Equal(http.StatusOK, aliveStatusCode)
+}
@@ -0,0 +1,188 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+// oldServerTimeout is the read and write timeout the HTTP server used to have
+const oldServerTimeout = 10 * time.Second
+
+// longLivedConnectionTestSuite checks that the default timeouts leave web-socket connections and pushes alone
+type longLivedConnectionTestSuite struct {
+	*baseTestSuite
+}
+
+func TestLongLivedConnectionTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestLongLivedConnectionTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	suite.Run(t, &longLivedConnectionTestSuite{baseTestSuite: NewBaseTestSuite(ctx)})
+}
+
+type httpTimeoutsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestHTTPTimeoutsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestHTTPTimeoutsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.HTTPTimeouts = config.HTTPTimeoutsConfig{
+			ReadHeaderTimeout: 200 * time.Millisecond,
+			PushTimeout:       200 * time.Millisecond,
+			RequestTimeout:    200 * time.Millisecond,
+		}
+	}
+
+	suite.Run(t, &httpTimeoutsTestSuite{baseTestSuite: base})
+}
+
+// connectRateLimited connects a client whose pushes are limited to one per "interval"
+func (s *baseTestSuite) connectRateLimited(ctx context.Context, interval time.Duration, msgFromAppChan chan string) (*Client, wsproxy.ConnectionID) {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{
+		"rateLimit": map[string]any{"perSecond": 1 / interval.Seconds(), "burst": 1},
+	})
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+	return client, connId
+}
+
+func (s *longLivedConnectionTestSuite) TestConnectionAndPushOutliveOldTimeouts() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 2)
+	client, connId := s.connectRateLimited(ctx, oldServerTimeout+time.Second, msgFromAppChan)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	response, pushErr := s.pushToClient(ctx, connId, "first", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("first", <-msgFromAppChan)
+
+	// the second push waits for the rate limit past the old timeouts, the connection stays idle meanwhile
+	start := time.Now()
+	response, pushErr = s.pushToClient(ctx, connId, "second", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("second", <-msgFromAppChan)
+	s.Greater(time.Since(start), oldServerTimeout)
+
+	message := mockapp.MessageJSON{"message": "still here"}
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.NoError(client.writeMessage(ctx, message))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+}
+
+func (s *httpTimeoutsTestSuite) TestPushTimesOut() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 2)
+	client, connId := s.connectRateLimited(ctx, time.Minute, msgFromAppChan)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	response, pushErr := s.pushToClient(ctx, connId, "first", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("first", <-msgFromAppChan)
+
+	response, pushErr = s.pushToClient(ctx, connId, "second", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+
+	// the connection is kept, and so are the connections of the back-end
+	response, pushErr = s.pushToClient(ctx, connId, "third", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func (s *httpTimeoutsTestSuite) TestRateLimitWithoutBurstHasDefaultBurst() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{
+		"rateLimit": map[string]any{"perSecond": 1},
+	})
+
+	msgFromAppChan := make(chan string, 3)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	// the pushes fit in the burst, within the push timeout
+	for _, message := range []string{"first", "second", "third"} {
+		response, pushErr := s.pushToClient(ctx, connId, message, nil)
+		s.Require().NoError(pushErr)
+		s.Equal(http.StatusNoContent, response.StatusCode)
+		s.Equal(message, <-msgFromAppChan)
+	}
+}
+
+func (s *httpTimeoutsTestSuite) TestSlowRequestHeadersTimeOut() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, dialErr := dialer.DialContext(ctx, "tcp", s.wsproxyServer)
+	s.Require().NoError(dialErr)
+	defer conn.Close()
+
+	_, writeErr := conn.Write([]byte("GET " + string(wsproxy.ConnectPath) + " HTTP/1.1\r\nHost: localhost\r\n"))
+	s.Require().NoError(writeErr)
+
+	// the server gives up on the request (and closes the connection) without the rest of the headers
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, readErr := io.ReadAll(conn)
+	s.NoError(readErr)
+}
+
+func (s *httpTimeoutsTestSuite) TestSlowRequestBodyTimesOut() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, dialErr := dialer.DialContext(ctx, "tcp", s.wsproxyServer)
+	s.Require().NoError(dialErr)
+	defer conn.Close()
+
+	_, writeErr := conn.Write([]byte("POST " + string(wsproxy.TopicPath) + "/news HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nnew"))
+	s.Require().NoError(writeErr)
+
+	// the server gives up on the request (and closes the connection) without the rest of the body
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, readErr := io.ReadAll(conn)
+	s.NoError(readErr)
+}
@@ -0,0 +1,189 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+// connectionDetails is the representation of connections in the responses of the introspection API
+type connectionDetails struct {
+	ID                 string          `json:"id"`
+	UserID             string          `json:"userId"`
+	TenantID           string          `json:"tenantId"`
+	Topics             []string        `json:"topics"`
+	ConnectedAt        time.Time       `json:"connectedAt"`
+	RemoteAddress      string          `json:"remoteAddress"`
+	UserAgent          string          `json:"userAgent"`
+	Metadata           json.RawMessage `json:"metadata"`
+	QueueDepth         int             `json:"queueDepth"`
+	MessagesFromClient int64           `json:"messagesFromClient"`
+	MessagesToClient   int64           `json:"messagesToClient"`
+}
+
+type connectionListResponse struct {
+	Connections []connectionDetails `json:"connections"`
+	Total       int                 `json:"total"`
+}
+
+type introspectionTestSuite struct {
+	*baseTestSuite
+}
+
+func TestIntrospectionTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestIntrospectionTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+	}
+
+	suite.Run(
+		t,
+		&introspectionTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+// connectWith connects a client the application configures with the given response to the connection request
+func (s *introspectionTestSuite) connectWith(ctx context.Context, connectResponse map[string]any, msgFromAppChan chan string) *Client {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, connectResponse)
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"some credentials"},
+			"User-Agent":    []string{"introspection-test"},
+		},
+	})
+	s.NoError(err)
+	return client
+}
+
+func (s *introspectionTestSuite) getConnection(ctx context.Context, connId wsproxy.ConnectionID) connectionDetails {
+	response, body, err := s.getFromAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId))
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	details := connectionDetails{}
+	s.NoError(json.Unmarshal([]byte(body), &details))
+	return details
+}
+
+func (s *introspectionTestSuite) listConnections(ctx context.Context, query string) connectionListResponse {
+	response, body, err := s.getFromAdmin(ctx, fmt.Sprintf("%s?%s", wsproxy.ConnectionsPath, query))
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	list := connectionListResponse{}
+	s.NoError(json.Unmarshal([]byte(body), &list))
+	return list
+}
+
+func (s *introspectionTestSuite) TestGetConnection() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 1)
+	client := s.connectWith(ctx, map[string]any{
+		"userId":        "user-1",
+		"tenantId":      "tenant-1",
+		"subscriptions": []string{"news"},
+		"metadata":      map[string]string{"plan": "pro"},
+	}, msgFromAppChan)
+	connId := client.connectionId
+
+	pushResponse, pushErr := s.pushToClient(ctx, connId, "hello", nil)
+	s.NoError(pushErr)
+	s.Equal(http.StatusNoContent, pushResponse.StatusCode)
+	s.Equal("hello", <-msgFromAppChan)
+
+	message := toWsMessage("hi")
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.NoError(client.writeMessage(ctx, message))
+
+	s.Eventually(func() bool {
+		return s.getConnection(ctx, connId).MessagesFromClient == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	details := s.getConnection(ctx, connId)
+	s.Equal(string(connId), details.ID)
+	s.Equal("user-1", details.UserID)
+	s.Equal("tenant-1", details.TenantID)
+	s.Equal([]string{"news"}, details.Topics)
+	s.JSONEq(`{"plan":"pro"}`, string(details.Metadata))
+	s.Equal("introspection-test", details.UserAgent)
+	s.NotEmpty(details.RemoteAddress)
+	s.WithinDuration(time.Now(), details.ConnectedAt, time.Minute)
+	s.Equal(0, details.QueueDepth)
+	s.Equal(int64(1), details.MessagesToClient)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	response, _, err := s.getFromAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId))
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
+
+func (s *introspectionTestSuite) TestListConnections() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	clients := []*Client{
+		s.connectWith(ctx, map[string]any{"userId": "lister-1", "tenantId": "tenant-a", "subscriptions": []string{"alerts"}}, nil),
+		s.connectWith(ctx, map[string]any{"userId": "lister-1", "tenantId": "tenant-a"}, nil),
+		s.connectWith(ctx, map[string]any{"userId": "lister-2", "tenantId": "tenant-b"}, nil),
+	}
+	defer func() {
+		for _, client := range clients {
+			_ = client.disconnect(ctx)
+			<-s.mockApp.OnDisconnect(client.connectionId)
+		}
+	}()
+
+	byUser := s.listConnections(ctx, "userId=lister-1")
+	s.Equal(2, byUser.Total)
+	s.Len(byUser.Connections, 2)
+	// Oldest first
+	s.Equal(string(clients[0].connectionId), byUser.Connections[0].ID)
+	s.Equal(string(clients[1].connectionId), byUser.Connections[1].ID)
+
+	byTenant := s.listConnections(ctx, "tenantId=tenant-b")
+	s.Equal(1, byTenant.Total)
+	s.Equal(string(clients[2].connectionId), byTenant.Connections[0].ID)
+
+	byTopic := s.listConnections(ctx, "topic=alerts&userId=lister-1")
+	s.Equal(1, byTopic.Total)
+	s.Equal(string(clients[0].connectionId), byTopic.Connections[0].ID)
+
+	secondPage := s.listConnections(ctx, "userId=lister-1&limit=1&offset=1")
+	s.Equal(2, secondPage.Total)
+	s.Len(secondPage.Connections, 1)
+	s.Equal(string(clients[1].connectionId), secondPage.Connections[0].ID)
+
+	tooYoung := s.listConnections(ctx, "userId=lister-1&minAge=1h")
+	s.Equal(0, tooYoung.Total)
+	s.Empty(tooYoung.Connections)
+
+	response, _, err := s.getFromAdmin(ctx, fmt.Sprintf("%s?maxAge=%s", wsproxy.ConnectionsPath, "soon"))
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+
+	response, _, err = s.getFromAdmin(ctx, fmt.Sprintf("%s?limit=%d", wsproxy.ConnectionsPath, 5000))
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+}
@@ -3,10 +3,12 @@ package integration
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"testing"
 	"time"
 	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
 	"wsproxy/internal/logging"
 	"wsproxy/test/mockapp"
 
@@ -30,6 +32,174 @@ func TestSendMessageTestSuite(t *testing.T) {
 	)
 }
 
+func TestSendMessageUnorderedTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestSendMessageUnorderedTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ClientMessageDispatch = config.ClientMessageDispatchConfig{
+			Ordering:    config.UnorderedOrdering,
+			Concurrency: 4,
+		}
+	}
+	suite.Run(
+		t,
+		&sendMessageTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+type batchedMessageTestSuite struct {
+	*sendMessageTestSuite
+}
+
+func TestSendMessageBatchedTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestSendMessageBatchedTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.MessageBatching = &config.MessageBatchingConfig{
+			MaxSize:  10,
+			MaxDelay: time.Millisecond * 100,
+		}
+	}
+	suite.Run(
+		t,
+		&batchedMessageTestSuite{
+			sendMessageTestSuite: &sendMessageTestSuite{baseTestSuite: base},
+		},
+	)
+}
+
+func (s *batchedMessageTestSuite) TestMessagesOfClientsBatched() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	nrBatchedClients := 5
+	clients := make([]*Client, nrBatchedClients)
+	messages := make([]mockapp.MessageJSON, nrBatchedClients)
+	for index := range clients {
+		clients[index] = NewClient(s.wsproxyServer, nil)
+		_, err := clients[index].connect(ctx)
+		s.NoError(err)
+		messages[index] = toWsMessage("message_" + xid.New().String())
+		s.mockApp.On(mockapp.MockMethodMessageReceived, clients[index].connectionId, messages[index])
+		s.mockApp.On(mockapp.MockMethodDisconnected, clients[index].connectionId)
+	}
+
+	batchCountBefore := s.mockApp.GetMessageBatchCount()
+	for index, client := range clients {
+		s.NoError(client.writeMessage(ctx, messages[index]))
+	}
+
+	for _, client := range clients {
+		connId := client.connectionId
+		s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 1 }, time.Second*5, time.Millisecond*10)
+		call := s.getCall(connId, 0)
+		s.Equal(mockapp.MockMethodMessageReceived, call.Method)
+	}
+	s.Less(s.mockApp.GetMessageBatchCount()-batchCountBefore, nrBatchedClients)
+
+	for _, client := range clients {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(client.connectionId)
+	}
+}
+
+func (s *batchedMessageTestSuite) TestMessagesOfClientBatchedInOrder() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	connId := client.connectionId
+
+	nrMessages := 5
+	messages := make([]mockapp.MessageJSON, nrMessages)
+	for index := range messages {
+		messages[index] = toWsMessage(fmt.Sprintf("message_%d", index))
+		s.mockApp.On(mockapp.MockMethodMessageReceived, connId, messages[index])
+	}
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	batchCountBefore := s.mockApp.GetMessageBatchCount()
+	for _, message := range messages {
+		s.NoError(client.writeMessage(ctx, message))
+	}
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == nrMessages }, time.Second*5, time.Millisecond*10)
+	// the messages of the client share batches, the default sequential dispatch notwithstanding
+	s.Less(s.mockApp.GetMessageBatchCount()-batchCountBefore, nrMessages)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	for index, message := range messages {
+		call := s.getCall(connId, index)
+		s.Equal(mockapp.MockMethodMessageReceived, call.Method)
+		s.assertArguments(&call, message)
+	}
+}
+
+func (s *batchedMessageTestSuite) TestSlowBatchHoldsUpOwnClientOnly() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	slowClient := NewClient(s.wsproxyServer, nil)
+	_, err := slowClient.connect(ctx)
+	s.NoError(err)
+	slowConnId := slowClient.connectionId
+	s.mockApp.SetMessageDelay(slowConnId, 3*time.Second)
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err = client.connect(ctx)
+	s.NoError(err)
+	connId := client.connectionId
+
+	slowMessages := []mockapp.MessageJSON{toWsMessage("slow_0"), toWsMessage("slow_1")}
+	for _, message := range slowMessages {
+		s.mockApp.On(mockapp.MockMethodMessageReceived, slowConnId, message)
+	}
+	s.mockApp.On(mockapp.MockMethodDisconnected, slowConnId)
+	message := toWsMessage("fast")
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	s.NoError(slowClient.writeMessage(ctx, slowMessages[0]))
+	// lets the batch of the slow client be sent
+	time.Sleep(500 * time.Millisecond)
+	s.NoError(slowClient.writeMessage(ctx, slowMessages[1]))
+	s.NoError(client.writeMessage(ctx, message))
+
+	// the batch of the other client is sent while the application processes that of the slow one
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 1 }, time.Second*2, time.Millisecond*10)
+	s.Empty(s.mockApp.GetCalls(slowConnId))
+
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(slowConnId)) == 2 }, time.Second*10, time.Millisecond*10)
+	for index, slowMessage := range slowMessages {
+		call := s.getCall(slowConnId, index)
+		s.assertArguments(&call, slowMessage)
+	}
+
+	for _, c := range []*Client{slowClient, client} {
+		_ = c.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(c.connectionId)
+	}
+}
+
 func (s *sendMessageTestSuite) TestSendAMessageToApp() {
 	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
 	defer cancel()
@@ -240,3 +410,104 @@ func generateMessages(nr int) map[string]struct{} {
 	}
 	return messages
 }
+
+func (s *sendMessageTestSuite) TestReplyToMessageWithCorrelationId() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	connId := client.connectionId
+	message := mockapp.MessageJSON{"message": "hi", "correlationId": "request-1"}
+
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.mockApp.SetMessageResponse(connId, http.StatusOK, map[string]string{"echo": "hi"})
+
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+
+	s.JSONEq(`{"type":"reply","correlationId":"request-1","status":200,"body":{"echo":"hi"}}`, <-msgFromAppChan)
+	s.Equal("request-1", s.mockApp.GetLastMessageHeader(connId).Get(wsproxy.CorrelationIDHeaderKey))
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *sendMessageTestSuite) TestAppErrorReportedToClient() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	connId := client.connectionId
+	message := toWsMessage("message_" + xid.New().String())
+
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.mockApp.SetMessageResponse(connId, http.StatusConflict, map[string]string{"reason": "duplicate"})
+
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+
+	s.JSONEq(
+		`{"type":"error","status":409,"body":{"reason":"duplicate"},"error":{"code":"app_error","message":"application failed to process message"}}`,
+		<-msgFromAppChan,
+	)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *sendMessageTestSuite) TestPushNotBlockedByMessageInFlight() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsproxy.ConnectionID {
+		return wsproxy.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	connId := client.connectionId
+	message := toWsMessage("message_" + xid.New().String())
+
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.mockApp.SetMessageDelay(connId, time.Second*2)
+
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+
+	msgToReceive := "message_" + xid.New().String()
+	pushStart := time.Now()
+	err = s.mockApp.SendToClient(connId, toWsMessage(msgToReceive))
+	s.NoError(err)
+	s.Equal(msgToReceive, <-msgFromAppChan)
+	s.Less(time.Since(pushStart), time.Second)
+
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 1 }, time.Second*5, time.Millisecond*10)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
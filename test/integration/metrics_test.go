@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type metricsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestMetricsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+	}
+
+	suite.Run(
+		t,
+		&metricsTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+// scrapeMetrics returns the metrics exposed on the admin listener
+func (s *metricsTestSuite) scrapeMetrics(ctx context.Context) string {
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.wsGateway.AdminAddr, wsproxy.MetricsPath), nil)
+	s.NoError(createReqErr)
+	request.Header.Set(wsproxy.APIKeyHeaderKey, adminAPIKey)
+	response, requestErr := http.DefaultClient.Do(request)
+	s.NoError(requestErr)
+	defer response.Body.Close()
+	s.Equal(http.StatusOK, response.StatusCode)
+	body, readErr := io.ReadAll(response.Body)
+	s.NoError(readErr)
+	return string(body)
+}
+
+func (s *metricsTestSuite) TestMetricsExposedOnAdminListener() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	msgFromAppChan := make(chan string, 1)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+
+	pushResponse, pushErr := s.pushToClient(ctx, connId, "hello", nil)
+	s.NoError(pushErr)
+	s.Equal(http.StatusNoContent, pushResponse.StatusCode)
+	s.Equal("hello", <-msgFromAppChan)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	metrics := s.scrapeMetrics(ctx)
+	s.Contains(metrics, "wsproxy_active_connections")
+	s.Contains(metrics, `wsproxy_connects_total{result="accepted"}`)
+	s.Contains(metrics, `wsproxy_disconnects_total{reason="client_closed"}`)
+	s.Contains(metrics, `wsproxy_messages_total{direction="out"}`)
+	s.Contains(metrics, `wsproxy_message_bytes_total{direction="out"}`)
+	s.Contains(metrics, "wsproxy_push_duration_seconds_count")
+	s.Contains(metrics, "wsproxy_from_app_queue_depth_count")
+	s.Contains(metrics, `wsproxy_app_callback_responses_total{endpoint="connect",status="200"}`)
+	s.Contains(metrics, `wsproxy_app_callback_duration_seconds_count{endpoint="connect"}`)
+
+	// Not exposed to clients
+	response, _, getErr := s.getFromProxy(ctx, wsproxy.MetricsPath)
+	s.NoError(getErr)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
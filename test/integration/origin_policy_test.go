@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+type originPolicyTestSuite struct {
+	*baseTestSuite
+}
+
+func TestOriginPolicyTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestOriginPolicyTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.OriginPolicy = config.OriginPolicyConfig{
+			AllowedOrigins: []string{"*.example.com", "https://secure.example.org"},
+			TenantAllowedOrigins: map[string][]string{
+				"tenant-1": {"tenant1.test"},
+			},
+		}
+	}
+
+	suite.Run(t, &originPolicyTestSuite{baseTestSuite: base})
+}
+
+type insecureOriginPolicyTestSuite struct {
+	*baseTestSuite
+}
+
+func TestInsecureOriginPolicyTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestInsecureOriginPolicyTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.OriginPolicy = config.OriginPolicyConfig{InsecureSkipVerify: true}
+	}
+
+	suite.Run(t, &insecureOriginPolicyTestSuite{baseTestSuite: base})
+}
+
+// connectFromOrigin connects a client of the tenant (if not empty) from "origin" (if not empty).
+// The client is disconnected if the connection is accepted.
+func (s *baseTestSuite) connectFromOrigin(ctx context.Context, origin string, tenantId string) (wsproxy.ConnectionID, *http.Response, error) {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	if len(tenantId) > 0 {
+		s.mockApp.SetConnectResponse(connId, map[string]any{"userId": "user-1", "tenantId": tenantId})
+	}
+
+	header := http.Header{"Authorization": []string{"some credentials"}}
+	if len(origin) > 0 {
+		header.Set("Origin", origin)
+	}
+	client := NewClient(s.wsproxyServer, nil)
+	response, err := client.connect(ctx, &websocket.DialOptions{HTTPHeader: header})
+	if err == nil {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}
+	return connId, response, err
+}
+
+func (s *originPolicyTestSuite) TestAllowedOrigins() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	for _, origin := range []string{"", "https://app.example.com", "http://APP.example.com", "https://secure.example.org", "https://app.example.com:8443", "http://" + s.wsproxyServer} {
+		_, _, err := s.connectFromOrigin(ctx, origin, "")
+		s.NoError(err, origin)
+	}
+}
+
+func (s *originPolicyTestSuite) TestDisallowedOriginsRejected() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	for _, origin := range []string{"https://evil.test", "https://example.com.evil.test", "http://secure.example.org"} {
+		connId, response, err := s.connectFromOrigin(ctx, origin, "")
+		s.Error(err, origin)
+		s.Equal(http.StatusForbidden, response.StatusCode, origin)
+		s.Empty(s.mockApp.GetCalls(connId), origin)
+	}
+}
+
+func (s *originPolicyTestSuite) TestTenantAllowedOrigins() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, _, err := s.connectFromOrigin(ctx, "https://tenant1.test", "tenant-1")
+	s.NoError(err)
+
+	otherTenantConnId, response, otherTenantErr := s.connectFromOrigin(ctx, "https://tenant1.test", "tenant-2")
+	s.Error(otherTenantErr)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+	// the application, having accepted the connection, learns of its rejection
+	<-s.mockApp.OnDisconnect(otherTenantConnId)
+	s.Len(s.mockApp.GetCalls(otherTenantConnId), 2)
+	s.Equal(wsproxy.OriginNotAllowedReason, s.mockApp.GetDisconnectReason(otherTenantConnId))
+
+	noTenantConnId, response, noTenantErr := s.connectFromOrigin(ctx, "https://tenant1.test", "")
+	s.Error(noTenantErr)
+	s.Equal(http.StatusForbidden, response.StatusCode)
+	<-s.mockApp.OnDisconnect(noTenantConnId)
+}
+
+func (s *originPolicyTestSuite) TestInvalidPatternRejectedAtStartup() {
+	conf := config.Config{
+		ServerHost:   "localhost",
+		AppBaseUrl:   "http://" + s.mockApp.GetAppAddress(),
+		OriginPolicy: config.OriginPolicyConfig{AllowedOrigins: []string{"[invalid"}},
+	}
+	server := wsproxy.NewServer(s.ctx, conf, func() wsproxy.ConnectionID { return wsproxy.CreateID(s.ctx) })
+	s.Error(server.SetupAndStart(nil))
+}
+
+func (s *insecureOriginPolicyTestSuite) TestAnyOriginAllowed() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, _, err := s.connectFromOrigin(ctx, "https://evil.test", "")
+	s.NoError(err)
+}
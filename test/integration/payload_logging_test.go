@@ -0,0 +1,214 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+// logBuffer captures the logs of the proxy
+type logBuffer struct {
+	mux    sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buffer.String()
+}
+
+// logCapturingSuite captures the logs of the proxy at debug level
+type logCapturingSuite struct {
+	*baseTestSuite
+	logs          *logBuffer
+	previousLevel zerolog.Level
+}
+
+func newLogCapturingSuite(name string, configure func(conf *config.Config)) *logCapturingSuite {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", name).Logger()
+	base := NewBaseTestSuite(logger.WithContext(context.Background()))
+	base.configure = configure
+	return &logCapturingSuite{baseTestSuite: base, logs: &logBuffer{}}
+}
+
+type payloadLoggingTestSuite struct {
+	*logCapturingSuite
+}
+
+func TestPayloadLoggingTestSuite(t *testing.T) {
+	configure := func(conf *config.Config) {
+		conf.PayloadLogging = &config.PayloadLoggingConfig{MaxLength: 96}
+		conf.Redaction = config.RedactionConfig{
+			JSONPaths: []string{"password"},
+			Patterns:  []string{`\d{4}-\d{4}-\d{4}-\d{4}`},
+		}
+	}
+
+	suite.Run(t, &payloadLoggingTestSuite{
+		logCapturingSuite: newLogCapturingSuite("TestPayloadLoggingTestSuite", configure),
+	})
+}
+
+// payloadLoggingOffTestSuite checks the defaults: payloads aren't logged
+type payloadLoggingOffTestSuite struct {
+	*logCapturingSuite
+}
+
+func TestPayloadLoggingOffTestSuite(t *testing.T) {
+	suite.Run(t, &payloadLoggingOffTestSuite{
+		logCapturingSuite: newLogCapturingSuite("TestPayloadLoggingOffTestSuite", nil),
+	})
+}
+
+// unreachableAppLoggingTestSuite checks the logs of the failures to call the application
+type unreachableAppLoggingTestSuite struct {
+	*logCapturingSuite
+}
+
+func TestUnreachableAppLoggingTestSuite(t *testing.T) {
+	configure := func(conf *config.Config) {
+		// nothing listens on port 1
+		conf.AppBaseUrl = "http://127.0.0.1:1"
+	}
+
+	suite.Run(t, &unreachableAppLoggingTestSuite{
+		logCapturingSuite: newLogCapturingSuite("TestUnreachableAppLoggingTestSuite", configure),
+	})
+}
+
+func (s *logCapturingSuite) SetupSuite() {
+	s.previousLevel = logging.Level()
+	logging.SetLevel(zerolog.DebugLevel)
+	logging.SetOutput(s.logs)
+	s.baseTestSuite.SetupSuite()
+}
+
+func (s *logCapturingSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	logging.SetOutput(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+	logging.SetLevel(s.previousLevel)
+}
+
+// exchangeMessage connects a client with "query", sends "message" to the application and pushes "pushed" to the client
+func (s *logCapturingSuite) exchangeMessage(ctx context.Context, query url.Values, message mockapp.MessageJSON, pushed string) {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+
+	msgFromAppChan := make(chan string, 1)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	client.connectQuery = query
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.NoError(client.writeMessage(ctx, message))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+
+	response, pushErr := s.pushToClient(ctx, connId, pushed, nil)
+	s.NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal(pushed, <-msgFromAppChan)
+}
+
+func (s *payloadLoggingTestSuite) TestPayloadsRedacted() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.exchangeMessage(
+		ctx,
+		url.Values{"access_token": []string{"secret-token"}, "device": []string{"phone"}},
+		mockapp.MessageJSON{"message": "card 1111-2222-3333-4444", "password": "hunter2"},
+		"pushed",
+	)
+
+	logs := s.logs.String()
+	s.Contains(logs, "[REDACTED]")
+	s.Contains(logs, "card [REDACTED]")
+	s.Contains(logs, "device=phone")
+	s.NotContains(logs, "hunter2")
+	s.NotContains(logs, "1111-2222-3333-4444")
+	s.NotContains(logs, "secret-token")
+}
+
+func (s *payloadLoggingTestSuite) TestLongPayloadsTruncated() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	longText := strings.Repeat("a", 200) + "tail-of-the-message"
+	s.exchangeMessage(ctx, nil, mockapp.MessageJSON{"message": longText}, "pushed")
+
+	logs := s.logs.String()
+	s.Contains(logs, strings.Repeat("a", 32))
+	s.Contains(logs, "bytes)")
+	s.NotContains(logs, "tail-of-the-message")
+}
+
+func (s *payloadLoggingOffTestSuite) TestPayloadsNotLogged() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.exchangeMessage(
+		ctx,
+		url.Values{"token": []string{"secret-token"}},
+		mockapp.MessageJSON{"message": "top-secret-message"},
+		"top-secret-push",
+	)
+
+	logs := s.logs.String()
+	s.NotEmpty(logs)
+	s.NotContains(logs, "top-secret-message")
+	s.NotContains(logs, "secret-token")
+}
+
+func (s *unreachableAppLoggingTestSuite) TestQueryRedactedFromRequestErrors() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := NewClient(s.wsproxyServer, nil)
+	client.connectQuery = url.Values{"access_token": []string{"secret-token"}, "device": []string{"phone"}}
+	response, err := client.connect(ctx)
+	s.Error(err)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	logs := s.logs.String()
+	s.Contains(logs, "failed to send request")
+	s.Contains(logs, "device=phone")
+	s.NotContains(logs, "secret-token")
+}
+
+func (s *payloadLoggingTestSuite) TestInvalidConfigurationRejectedAtStartup() {
+	for _, conf := range []config.Config{
+		{Redaction: config.RedactionConfig{Patterns: []string{`(unclosed`}}},
+		{PayloadLogging: &config.PayloadLoggingConfig{Mode: "verbatim"}},
+	} {
+		conf.ServerHost = "localhost"
+		conf.AppBaseUrl = "http://" + s.mockApp.GetAppAddress()
+		server := wsproxy.NewServer(s.ctx, conf, func() wsproxy.ConnectionID { return wsproxy.CreateID(s.ctx) })
+		s.Error(server.SetupAndStart(nil))
+	}
+}
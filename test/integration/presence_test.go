@@ -0,0 +1,220 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const presenceDebounce = 300 * time.Millisecond
+
+type userPresence struct {
+	UserID      string `json:"userId"`
+	Online      bool   `json:"online"`
+	Connections int    `json:"connections"`
+}
+
+type presenceTestSuite struct {
+	*baseTestSuite
+}
+
+func TestPresenceTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestPresenceTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.PresenceEvents = &config.PresenceEventsConfig{Debounce: presenceDebounce}
+	}
+
+	suite.Run(
+		t,
+		&presenceTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+// clusteredPresenceTestSuite tracks the presence of users in the registry
+type clusteredPresenceTestSuite struct {
+	presenceTestSuite
+	redis *miniredis.Miniredis
+}
+
+func TestClusteredPresenceTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestClusteredPresenceTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	redis := miniredis.NewMiniRedis()
+	if startErr := redis.Start(); startErr != nil {
+		t.Fatal(startErr)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+	t.Setenv("MY_INSTANCE_IPADDRESS", "127.0.0.1")
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.RedisHost = redis.Host()
+		conf.RedisPort = redisPort
+		conf.RelaySecret = "relay-secret"
+		conf.PresenceEvents = &config.PresenceEventsConfig{Debounce: presenceDebounce}
+	}
+
+	suite.Run(
+		t,
+		&clusteredPresenceTestSuite{
+			presenceTestSuite: presenceTestSuite{baseTestSuite: base},
+			redis:             redis,
+		},
+	)
+}
+
+func (s *clusteredPresenceTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.redis.Close()
+}
+
+func (s *presenceTestSuite) connectAs(ctx context.Context, userId string) *Client {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"userId": userId})
+
+	client := NewClient(s.wsproxyServer, nil)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	return client
+}
+
+func (s *presenceTestSuite) disconnect(ctx context.Context, client *Client) {
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(client.connectionId)
+}
+
+// nextPresenceChange returns the next presence change of the user the app is notified of
+func (s *presenceTestSuite) nextPresenceChange(ctx context.Context, userId string) (mockapp.PresenceChange, bool) {
+	for {
+		select {
+		case change := <-s.mockApp.PresenceChanges():
+			if change.UserID == userId {
+				return change, true
+			}
+		case <-ctx.Done():
+			return mockapp.PresenceChange{}, false
+		}
+	}
+}
+
+func (s *presenceTestSuite) getPresence(ctx context.Context, userId string) userPresence {
+	response, body, err := s.getFromProxy(ctx, fmt.Sprintf("%s/%s", wsproxy.PresencePath, userId))
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	presence := userPresence{}
+	s.NoError(json.Unmarshal([]byte(body), &presence))
+	return presence
+}
+
+func (s *presenceTestSuite) TestPresenceOfUser() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.Equal(userPresence{UserID: "presence-user"}, s.getPresence(ctx, "presence-user"))
+
+	first := s.connectAs(ctx, "presence-user")
+	change, ok := s.nextPresenceChange(ctx, "presence-user")
+	s.True(ok)
+	s.True(change.Online)
+
+	second := s.connectAs(ctx, "presence-user")
+	s.Equal(userPresence{UserID: "presence-user", Online: true, Connections: 2}, s.getPresence(ctx, "presence-user"))
+
+	response, body, err := s.postJSONToProxy(ctx, string(wsproxy.PresencePath), `{"userIds":["presence-user","absent-user"]}`)
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.JSONEq(
+		`{"presence":[{"userId":"presence-user","online":true,"connections":2},{"userId":"absent-user","online":false,"connections":0}]}`,
+		body,
+	)
+
+	s.disconnect(ctx, first)
+	s.disconnect(ctx, second)
+	change, ok = s.nextPresenceChange(ctx, "presence-user")
+	s.True(ok)
+	s.False(change.Online)
+	s.Equal(userPresence{UserID: "presence-user"}, s.getPresence(ctx, "presence-user"))
+}
+
+func (s *presenceTestSuite) TestConnectNotHeldUpByPresenceNotification() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.mockApp.SetPresenceDelay(time.Second)
+	defer s.mockApp.SetPresenceDelay(0)
+
+	start := time.Now()
+	client := s.connectAs(ctx, "user-slow-app")
+	s.Less(time.Since(start), time.Second)
+
+	change, ok := s.nextPresenceChange(ctx, "user-slow-app")
+	s.True(ok)
+	s.True(change.Online)
+
+	s.disconnect(ctx, client)
+	change, ok = s.nextPresenceChange(ctx, "user-slow-app")
+	s.True(ok)
+	s.False(change.Online)
+}
+
+func (s *presenceTestSuite) TestQuickReconnectDoesNotFlap() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := s.connectAs(ctx, "flapping-user")
+	change, ok := s.nextPresenceChange(ctx, "flapping-user")
+	s.True(ok)
+	s.True(change.Online)
+
+	s.disconnect(ctx, client)
+	client = s.connectAs(ctx, "flapping-user")
+
+	quietCtx, quietCancel := context.WithTimeout(ctx, 3*presenceDebounce)
+	defer quietCancel()
+	_, changed := s.nextPresenceChange(quietCtx, "flapping-user")
+	s.False(changed)
+
+	s.disconnect(ctx, client)
+	change, ok = s.nextPresenceChange(ctx, "flapping-user")
+	s.True(ok)
+	s.False(change.Online)
+}
+
+func (s *clusteredPresenceTestSuite) TestPresenceRecordedInRegistry() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := s.connectAs(ctx, "registered-user")
+	change, ok := s.nextPresenceChange(ctx, "registered-user")
+	s.True(ok)
+	s.True(change.Online)
+	s.True(s.redis.Exists("presence:registered-user"))
+	members, _ := s.redis.Members("user-connections:registered-user")
+	s.Equal([]string{string(client.connectionId)}, members)
+
+	s.disconnect(ctx, client)
+	change, ok = s.nextPresenceChange(ctx, "registered-user")
+	s.True(ok)
+	s.False(change.Online)
+	s.False(s.redis.Exists("presence:registered-user"))
+}
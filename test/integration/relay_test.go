@@ -0,0 +1,297 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/grpcapi"
+	"wsproxy/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"nhooyr.io/websocket"
+)
+
+const (
+	relaySecret     = "relay-secret"
+	relayAPIKey     = "relay-backend-key"
+	instanceAddress = "127.0.0.1"
+	// peerAddress is the address of the second instance: the instances of a cluster share the port
+	peerAddress = "127.0.0.2"
+)
+
+// relayTestSuite runs a cluster of two instances with back-end authentication: the one of the base suite and its peer
+type relayTestSuite struct {
+	*baseTestSuite
+	redis    *miniredis.Miniredis
+	peerConf config.Config
+	peer     *wsproxy.Server
+}
+
+func TestRelayTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestRelayTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	redis := miniredis.NewMiniRedis()
+	if startErr := redis.Start(); startErr != nil {
+		t.Fatal(startErr)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	port := freePort(t)
+	t.Setenv("MY_INSTANCE_IPADDRESS", instanceAddress)
+	t.Setenv("MY_INSTANCE_PORT", strconv.Itoa(port))
+	t.Setenv("MY_INSTANCE_PROTOCOL", "http")
+
+	s := &relayTestSuite{baseTestSuite: NewBaseTestSuite(ctx), redis: redis}
+	s.configure = func(conf *config.Config) {
+		conf.ServerHost = instanceAddress
+		conf.ServerPort = port
+		conf.RedisHost = redis.Host()
+		conf.RedisPort = redisPort
+		conf.RelaySecret = relaySecret
+		conf.BackendAuthentication = config.BackendAuthConfig{
+			APIKeys: map[string]string{relayAPIKey: "backend"},
+		}
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+		conf.GRPC = &config.GRPCConfig{}
+		s.peerConf = *conf
+		s.peerConf.ServerHost = peerAddress
+	}
+
+	suite.Run(t, s)
+}
+
+// freePort returns a port free on the loopback interface
+func freePort(t *testing.T) int {
+	listener, listenErr := net.Listen("tcp", instanceAddress+":0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *relayTestSuite) SetupSuite() {
+	s.baseTestSuite.SetupSuite()
+
+	s.peer = wsproxy.NewServer(s.ctx, s.peerConf, func() wsproxy.ConnectionID { return s.nextConnId })
+	ready := make(chan struct{})
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- s.peer.SetupAndStart(func(int, func()) { close(ready) })
+	}()
+	select {
+	case <-ready:
+	case err := <-startErr:
+		s.FailNow("peer failed to start", err)
+	}
+}
+
+func (s *relayTestSuite) TearDownSuite() {
+	if s.peer != nil {
+		s.peer.Stop()
+	}
+	s.baseTestSuite.TearDownSuite()
+	s.redis.Close()
+}
+
+// connectToPeer connects a client of the user to the peer instance, which registers the connection under its own address
+func (s *relayTestSuite) connectToPeer(ctx context.Context, userId string, msgFromAppChan chan string) (*Client, wsproxy.ConnectionID) {
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"userId": userId})
+
+	// The instances of a cluster tell their address by the environment, which the two instances share here
+	s.Require().NoError(os.Setenv("MY_INSTANCE_IPADDRESS", peerAddress))
+	defer os.Setenv("MY_INSTANCE_IPADDRESS", instanceAddress)
+
+	client := NewClient(s.peer.Addr, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+	return client, connId
+}
+
+func (s *relayTestSuite) disconnect(ctx context.Context, client *Client, connId wsproxy.ConnectionID) {
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *relayTestSuite) send(request *http.Request) (*http.Response, string) {
+	response, requestErr := http.DefaultClient.Do(request)
+	s.Require().NoError(requestErr)
+	defer response.Body.Close()
+	body, readErr := io.ReadAll(response.Body)
+	s.Require().NoError(readErr)
+	return response, string(body)
+}
+
+func (s *relayTestSuite) TestPushRelayedToPeer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 1)
+	client, connId := s.connectToPeer(ctx, "user-1", msgFromAppChan)
+	defer s.disconnect(ctx, client, connId)
+
+	response, pushErr := s.pushToClient(ctx, connId, "relayed", http.Header{wsproxy.APIKeyHeaderKey: []string{relayAPIKey}})
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("relayed", <-msgFromAppChan)
+
+	response, pushErr = s.pushToClient(ctx, connId, "unauthenticated", nil)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *relayTestSuite) TestConnectionDetailsRelayedToPeer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId := s.connectToPeer(ctx, "user-1", nil)
+	defer s.disconnect(ctx, client, connId)
+
+	response, body, err := s.getFromAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId))
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	var details struct{ ID string }
+	s.NoError(json.Unmarshal([]byte(body), &details))
+	s.Equal(string(connId), details.ID)
+
+	response, body, err = s.getFromAdmin(ctx, string(wsproxy.ConnectionsPath))
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	var list struct{ Total int }
+	s.NoError(json.Unmarshal([]byte(body), &list))
+	s.Equal(1, list.Total)
+}
+
+func (s *relayTestSuite) TestCloseRelayedToPeer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId := s.connectToPeer(ctx, "user-1", nil)
+
+	response, _, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId), "")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal(websocket.StatusNormalClosure, (<-client.closed).Code)
+	<-s.mockApp.OnDisconnect(connId)
+	s.Equal(wsproxy.ClosedByAppReason, s.mockApp.GetDisconnectReason(connId))
+}
+
+func (s *relayTestSuite) TestUserConnectionsClosedOnPeer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId := s.connectToPeer(ctx, "banned-user", nil)
+
+	response, body, err := s.deleteOnAdmin(ctx, fmt.Sprintf("%s/%s%s", wsproxy.UsersPath, "banned-user", wsproxy.ConnectionsPath), "")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.JSONEq(`{"closed":1}`, body)
+	s.Equal(websocket.StatusNormalClosure, (<-client.closed).Code)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *relayTestSuite) TestConnectionEventsStreamedFromPeer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	clientConn, dialErr := grpc.NewClient(s.wsGateway.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(dialErr)
+	defer clientConn.Close()
+	events, subscribeErr := grpcapi.NewWsproxyServiceClient(clientConn).SubscribeConnectionEvents(
+		metadata.AppendToOutgoingContext(ctx, "x-wsgw-api-key", relayAPIKey),
+		&grpcapi.SubscribeConnectionEventsRequest{},
+	)
+	s.Require().NoError(subscribeErr)
+	_, headerErr := events.Header()
+	s.Require().NoError(headerErr)
+
+	client, connId := s.connectToPeer(ctx, "user-1", nil)
+	s.disconnect(ctx, client, connId)
+
+	// the events of the connections of the previous tests may still be on their way
+	nextEvent := func() *grpcapi.ConnectionEvent {
+		for {
+			event, recvErr := events.Recv()
+			s.Require().NoError(recvErr)
+			if event.ConnectionId == string(connId) {
+				return event
+			}
+		}
+	}
+	connected := nextEvent()
+	s.Equal(grpcapi.ConnectionEvent_TYPE_CONNECTED, connected.Type)
+	s.Equal("user-1", connected.UserId)
+	s.Equal(grpcapi.ConnectionEvent_TYPE_DISCONNECTED, nextEvent().Type)
+}
+
+func (s *relayTestSuite) TestRelayedMarkerNotTrustedFromBackends() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 1)
+	client, connId := s.connectToPeer(ctx, "user-1", msgFromAppChan)
+	defer s.disconnect(ctx, client, connId)
+
+	// the header once marking relayed requests neither lifts the page size limit nor keeps requests from being relayed
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s?limit=5000", s.wsGateway.AdminAddr, wsproxy.ConnectionsPath), nil)
+	s.Require().NoError(createReqErr)
+	request.Header.Set(wsproxy.APIKeyHeaderKey, adminAPIKey)
+	request.Header.Set("X-WSGW-RELAYED", "true")
+	response, _ := s.send(request)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+
+	response, pushErr := s.pushToClient(ctx, connId, "relayed", http.Header{
+		wsproxy.APIKeyHeaderKey: []string{relayAPIKey},
+		"X-WSGW-RELAYED":        []string{"true"},
+	})
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("relayed", <-msgFromAppChan)
+}
+
+func (s *relayTestSuite) TestRelayEndpointsRequireRelaySecret() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client, connId := s.connectToPeer(ctx, "user-1", nil)
+	defer s.disconnect(ctx, client, connId)
+
+	relayUrl := fmt.Sprintf("http://%s%s%s/%s", s.peer.Addr, wsproxy.RelayPath, wsproxy.MessagePath, connId)
+	for _, secret := range []string{"", "wrong-secret"} {
+		request, createReqErr := http.NewRequestWithContext(ctx, http.MethodPost, relayUrl, strings.NewReader("spoofed"))
+		s.Require().NoError(createReqErr)
+		// back-end credentials don't authenticate relayed requests
+		request.Header.Set(wsproxy.APIKeyHeaderKey, relayAPIKey)
+		if len(secret) > 0 {
+			request.Header.Set(wsproxy.RelaySecretHeaderKey, secret)
+		}
+		response, _ := s.send(request)
+		s.Equal(http.StatusUnauthorized, response.StatusCode)
+	}
+}
+
+func (s *relayTestSuite) TestRelaySecretRequiredWhenClustered() {
+	conf := s.peerConf
+	conf.RelaySecret = ""
+	server := wsproxy.NewServer(s.ctx, conf, func() wsproxy.ConnectionID { return wsproxy.CreateID(s.ctx) })
+	s.Error(server.SetupAndStart(nil))
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+type subprotocolsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestSubprotocolsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestSubprotocolsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Subprotocols = []string{"graphql-transport-ws", "mqtt"}
+		conf.Admin = &config.AdminConfig{Authentication: adminAuthentication}
+	}
+
+	suite.Run(t, &subprotocolsTestSuite{baseTestSuite: base})
+}
+
+// connectOffering connects a client offering the subprotocols
+func (s *subprotocolsTestSuite) connectOffering(ctx context.Context, connId wsproxy.ConnectionID, subprotocols ...string) (*Client, *http.Response, error) {
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, nil)
+	response, err := client.connect(ctx, &websocket.DialOptions{
+		HTTPHeader:   http.Header{"Authorization": []string{"some credentials"}},
+		Subprotocols: subprotocols,
+	})
+	return client, response, err
+}
+
+func (s *subprotocolsTestSuite) disconnect(ctx context.Context, client *Client, connId wsproxy.ConnectionID) {
+	s.NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *subprotocolsTestSuite) TestSubprotocolNegotiated() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	client, _, err := s.connectOffering(ctx, connId, "v2.custom", "mqtt", "graphql-transport-ws")
+	s.Require().NoError(err)
+	defer s.disconnect(ctx, client, connId)
+
+	s.Equal("graphql-transport-ws", client.wsConn.Subprotocol())
+
+	connectHeader := s.mockApp.GetConnectRequest(connId).Header
+	s.Equal("graphql-transport-ws", connectHeader.Get(wsproxy.SubprotocolHeaderKey))
+	s.Equal("v2.custom, mqtt, graphql-transport-ws", connectHeader.Get(wsproxy.OfferedSubprotocolsHeaderKey))
+
+	message := mockapp.MessageJSON{"message": "subscribe"}
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.NoError(client.writeMessage(ctx, message))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+	s.Equal("graphql-transport-ws", s.mockApp.GetLastMessageHeader(connId).Get(wsproxy.SubprotocolHeaderKey))
+
+	response, body, getErr := s.getFromAdmin(ctx, fmt.Sprintf("%s/%s", wsproxy.ConnectionsPath, connId))
+	s.NoError(getErr)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var info struct{ Subprotocol string }
+	s.NoError(json.Unmarshal([]byte(body), &info))
+	s.Equal("graphql-transport-ws", info.Subprotocol)
+}
+
+func (s *subprotocolsTestSuite) TestSubprotocolChosenByApp() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"subprotocol": "v2.custom"})
+	client, _, err := s.connectOffering(ctx, connId, "mqtt", "v2.custom")
+	s.Require().NoError(err)
+	defer s.disconnect(ctx, client, connId)
+
+	s.Equal("v2.custom", client.wsConn.Subprotocol())
+}
+
+func (s *subprotocolsTestSuite) TestSubprotocolNotOfferedChosenByApp() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.mockApp.SetConnectResponse(connId, map[string]any{"subprotocol": "v3.custom"})
+	_, response, err := s.connectOffering(ctx, connId, "mqtt")
+	s.Error(err)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+}
+
+func (s *subprotocolsTestSuite) TestNoSubprotocolSupported() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	client, _, err := s.connectOffering(ctx, connId, "v1.unknown")
+	s.Require().NoError(err)
+	defer s.disconnect(ctx, client, connId)
+
+	s.Empty(client.wsConn.Subprotocol())
+	s.Empty(s.mockApp.GetConnectRequest(connId).Header.Get(wsproxy.SubprotocolHeaderKey))
+}
@@ -0,0 +1,293 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/grpcapi"
+	"wsproxy/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+// testCA issues the certificates of the TLS tests
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+func newTestCA() (*testCA, error) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wsproxy test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, createErr := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if createErr != nil {
+		return nil, createErr
+	}
+	certificate, parseErr := x509.ParseCertificate(der)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &testCA{certificate: certificate, key: key, pool: pool}, nil
+}
+
+// issue issues a certificate to "commonName" (valid for localhost) and writes it with its key to "certFile" and
+// "keyFile" (if not empty)
+func (ca *testCA) issue(commonName string, serial int64, certFile string, keyFile string) (tls.Certificate, error) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		return tls.Certificate{}, keyErr
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, createErr := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if createErr != nil {
+		return tls.Certificate{}, createErr
+	}
+	keyDER, marshalErr := x509.MarshalECPrivateKey(key)
+	if marshalErr != nil {
+		return tls.Certificate{}, marshalErr
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if len(certFile) > 0 {
+		if writeErr := os.WriteFile(certFile, certPEM, 0o600); writeErr != nil {
+			return tls.Certificate{}, writeErr
+		}
+		if writeErr := os.WriteFile(keyFile, keyPEM, 0o600); writeErr != nil {
+			return tls.Certificate{}, writeErr
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// writePEM writes the certificate of the CA to "file"
+func (ca *testCA) writePEM(file string) error {
+	return os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0o600)
+}
+
+type tlsTestSuite struct {
+	*baseTestSuite
+	ca       *testCA
+	certFile string
+	keyFile  string
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestTLSTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	ca, caErr := newTestCA()
+	if caErr != nil {
+		t.Fatal(caErr)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	if _, issueErr := ca.issue("server-1", 2, certFile, keyFile); issueErr != nil {
+		t.Fatal(issueErr)
+	}
+	if writeErr := ca.writePEM(caFile); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.TLS = &config.TLSConfig{
+			CertFile:       certFile,
+			KeyFile:        keyFile,
+			ReloadInterval: 10 * time.Millisecond,
+			MinVersion:     "1.3",
+		}
+		conf.PlainHTTP = &config.PlainHTTPConfig{}
+		conf.BackendAuthentication = config.BackendAuthConfig{MTLS: true}
+		conf.GRPC = &config.GRPCConfig{
+			TLS: &config.TLSConfig{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				ClientCAFile: caFile,
+			},
+		}
+		conf.Admin = &config.AdminConfig{
+			Authentication: config.BackendAuthConfig{MTLS: true},
+			TLS: &config.TLSConfig{
+				CertFile:          certFile,
+				KeyFile:           keyFile,
+				ClientCAFile:      caFile,
+				RequireClientCert: true,
+			},
+		}
+	}
+
+	suite.Run(t, &tlsTestSuite{baseTestSuite: base, ca: ca, certFile: certFile, keyFile: keyFile})
+}
+
+// httpsClient returns an HTTP client trusting the test CA, otherwise configured by "tlsConfig"
+func (s *tlsTestSuite) httpsClient(tlsConfig *tls.Config) *http.Client {
+	tlsConfig.RootCAs = s.ca.pool
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+}
+
+func (s *tlsTestSuite) TestConnectOverTLS() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	wsConn, _, dialErr := websocket.Dial(ctx, fmt.Sprintf("wss://%s%s", s.wsproxyServer, wsproxy.ConnectPath), &websocket.DialOptions{
+		HTTPClient: s.httpsClient(&tls.Config{}),
+		HTTPHeader: http.Header{"Authorization": []string{"some credentials"}},
+	})
+	s.Require().NoError(dialErr)
+	client := &Client{wsConn: wsConn}
+	ackedConnId, readErr := client.readConnId(ctx)
+	s.NoError(readErr)
+	s.Equal(connId, ackedConnId)
+
+	s.NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *tlsTestSuite) TestPlainHTTPServedAlongside() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.wsGateway.PlainAddr, wsproxy.HealthzPath), nil)
+	s.Require().NoError(createReqErr)
+	response, requestErr := http.DefaultClient.Do(request)
+	s.Require().NoError(requestErr)
+	response.Body.Close()
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	// plain HTTP isn't served on the TLS port
+	request, createReqErr = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.wsproxyServer, wsproxy.HealthzPath), nil)
+	s.Require().NoError(createReqErr)
+	response, requestErr = http.DefaultClient.Do(request)
+	if requestErr == nil {
+		response.Body.Close()
+		s.Equal(http.StatusBadRequest, response.StatusCode)
+	}
+}
+
+func (s *tlsTestSuite) TestMinVersionEnforced() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s%s", s.wsproxyServer, wsproxy.HealthzPath), nil)
+	s.Require().NoError(createReqErr)
+	_, requestErr := s.httpsClient(&tls.Config{MaxVersion: tls.VersionTLS12}).Do(request)
+	s.Error(requestErr)
+}
+
+func (s *tlsTestSuite) TestCertificateReloaded() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	servedCommonName := func() string {
+		request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s%s", s.wsproxyServer, wsproxy.HealthzPath), nil)
+		s.Require().NoError(createReqErr)
+		response, requestErr := s.httpsClient(&tls.Config{}).Do(request)
+		s.Require().NoError(requestErr)
+		response.Body.Close()
+		return response.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	s.Equal("server-1", servedCommonName())
+
+	_, issueErr := s.ca.issue("server-2", 3, s.certFile, s.keyFile)
+	s.Require().NoError(issueErr)
+	// makes the change visible whatever the resolution of the modification times
+	later := time.Now().Add(time.Minute)
+	s.Require().NoError(os.Chtimes(s.certFile, later, later))
+	s.Require().NoError(os.Chtimes(s.keyFile, later, later))
+
+	s.Eventually(func() bool { return servedCommonName() == "server-2" }, time.Second*5, time.Millisecond*20)
+}
+
+func (s *tlsTestSuite) TestAdminRequiresClientCertificate() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	metricsUrl := fmt.Sprintf("https://%s%s", s.wsGateway.AdminAddr, wsproxy.MetricsPath)
+
+	request, createReqErr := http.NewRequestWithContext(ctx, http.MethodGet, metricsUrl, nil)
+	s.Require().NoError(createReqErr)
+	_, requestErr := s.httpsClient(&tls.Config{}).Do(request)
+	s.Error(requestErr)
+
+	clientCertificate, issueErr := s.ca.issue("ops", 4, "", "")
+	s.Require().NoError(issueErr)
+	request, createReqErr = http.NewRequestWithContext(ctx, http.MethodGet, metricsUrl, nil)
+	s.Require().NoError(createReqErr)
+	response, requestErr := s.httpsClient(&tls.Config{Certificates: []tls.Certificate{clientCertificate}}).Do(request)
+	s.Require().NoError(requestErr)
+	response.Body.Close()
+	s.Equal(http.StatusOK, response.StatusCode)
+}
+
+func (s *tlsTestSuite) TestGRPCOverTLSAuthenticatesClientCertificates() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	push := func(tlsConfig *tls.Config) error {
+		tlsConfig.RootCAs = s.ca.pool
+		clientConn, dialErr := grpc.NewClient(s.wsGateway.GRPCAddr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		s.Require().NoError(dialErr)
+		defer clientConn.Close()
+		_, pushErr := grpcapi.NewWsproxyServiceClient(clientConn).Push(ctx, &grpcapi.PushRequest{ConnectionId: "unknown", Message: "hello"})
+		return pushErr
+	}
+
+	s.Equal(codes.Unauthenticated, status.Code(push(&tls.Config{})))
+
+	clientCertificate, issueErr := s.ca.issue("backend", 5, "", "")
+	s.Require().NoError(issueErr)
+	// authenticated, the call gets as far as looking the connection up
+	s.Equal(codes.NotFound, status.Code(push(&tls.Config{Certificates: []tls.Certificate{clientCertificate}})))
+}
@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const testTokenIssuer = "https://issuer.wsproxy.test"
+
+// tokenIssuer publishes its signing key via a JWKS endpoint and issues JWTs signed with it
+type tokenIssuer struct {
+	server *httptest.Server
+	signer jose.Signer
+}
+
+func newTokenIssuer() *tokenIssuer {
+	privateKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	if keyErr != nil {
+		panic(keyErr)
+	}
+	keyId := "test-key"
+
+	signer, signerErr := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: privateKey, KeyID: keyId}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if signerErr != nil {
+		panic(signerErr)
+	}
+
+	jwks := jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: &privateKey.PublicKey, KeyID: keyId, Algorithm: string(jose.RS256), Use: "sig"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+
+	return &tokenIssuer{server: server, signer: signer}
+}
+
+func (i *tokenIssuer) jwksURL() string {
+	return i.server.URL
+}
+
+func (i *tokenIssuer) close() {
+	i.server.Close()
+}
+
+// issue returns a token valid for a minute with the standard claims set and the extra claims added
+func (i *tokenIssuer) issue(subject string, audience string, extraClaims map[string]any) string {
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:   testTokenIssuer,
+		Subject:  subject,
+		Audience: jwt.Audience{audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+	}
+	token, err := jwt.Signed(i.signer).Claims(claims).Claims(extraClaims).Serialize()
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
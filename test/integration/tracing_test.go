@@ -0,0 +1,224 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	wsproxy "wsproxy/internal"
+	"wsproxy/internal/config"
+	"wsproxy/internal/logging"
+	"wsproxy/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	callerTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerTraceParent = "00-" + callerTraceId + "-00f067aa0ba902b7-01"
+)
+
+// spanBuffer collects the spans written by the stdout exporter
+type spanBuffer struct {
+	mux    sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *spanBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buffer.Write(p)
+}
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+	}
+}
+
+// spans decodes the spans exported so far
+func (b *spanBuffer) spans() []exportedSpan {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	spans := []exportedSpan{}
+	decoder := json.NewDecoder(bytes.NewReader(b.buffer.Bytes()))
+	for {
+		var span exportedSpan
+		if err := decoder.Decode(&span); err != nil {
+			if !errors.Is(err, io.EOF) {
+				panic(err)
+			}
+			return spans
+		}
+		spans = append(spans, span)
+	}
+}
+
+// hasSpan tells whether a span named "name" was exported as part of the trace "traceId"
+func (b *spanBuffer) hasSpan(name string, traceId string) bool {
+	for _, span := range b.spans() {
+		if span.Name == name && span.SpanContext.TraceID == traceId {
+			return true
+		}
+	}
+	return false
+}
+
+type tracingTestSuite struct {
+	*baseTestSuite
+	exported *spanBuffer
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestTracingTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	exported := &spanBuffer{}
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Tracing = &config.TracingConfig{
+			Exporter:     config.StdoutTracingExporter,
+			StdoutWriter: exported,
+		}
+	}
+
+	suite.Run(
+		t,
+		&tracingTestSuite{
+			baseTestSuite: base,
+			exported:      exported,
+		},
+	)
+}
+
+type batchedTracingTestSuite struct {
+	*baseTestSuite
+	exported *spanBuffer
+}
+
+func TestBatchedTracingTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestBatchedTracingTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	exported := &spanBuffer{}
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.Tracing = &config.TracingConfig{
+			Exporter:     config.StdoutTracingExporter,
+			StdoutWriter: exported,
+		}
+		conf.MessageBatching = &config.MessageBatchingConfig{MaxDelay: time.Millisecond * 10}
+	}
+
+	suite.Run(
+		t,
+		&batchedTracingTestSuite{
+			baseTestSuite: base,
+			exported:      exported,
+		},
+	)
+}
+
+func (s *tracingTestSuite) TestPushContinuesCallersTrace() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	msgFromAppChan := make(chan string, 1)
+	client := NewClient(s.wsproxyServer, msgFromAppChan)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	header := http.Header{}
+	header.Set("traceparent", callerTraceParent)
+	response, pushErr := s.pushToClient(ctx, connId, "traced", header)
+	s.NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("traced", <-msgFromAppChan)
+
+	s.Eventually(func() bool {
+		return s.exported.hasSpan("push", callerTraceId) && s.exported.hasSpan("ws.write", callerTraceId)
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func (s *tracingTestSuite) TestAppCallbacksCarryTraceContext() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, make(chan string, 1))
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.NotEmpty(s.mockApp.GetConnectRequest(connId).Header.Get("traceparent"))
+
+	message := mockapp.MessageJSON{"message": "hi"}
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	err = client.writeMessage(ctx, message)
+	s.NoError(err)
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+
+	s.NotEmpty(s.mockApp.GetLastMessageHeader(connId).Get("traceparent"))
+	s.Eventually(func() bool {
+		for _, span := range s.exported.spans() {
+			if span.Name == "handleClientMessage" {
+				return true
+			}
+		}
+		return false
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func (s *batchedTracingTestSuite) TestMessageBatchCarriesTraceContext() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	connId := wsproxy.CreateID(ctx)
+	s.nextConnId = connId
+	s.mockApp.ExpectConnDisconn(connId)
+
+	client := NewClient(s.wsproxyServer, make(chan string, 1))
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	message := mockapp.MessageJSON{"message": "hi"}
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.NoError(client.writeMessage(ctx, message))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 2 }, time.Second*5, time.Millisecond*10)
+
+	s.NotEmpty(s.mockApp.GetLastMessageHeader(connId).Get("traceparent"))
+	s.Eventually(func() bool {
+		for _, span := range s.exported.spans() {
+			if span.Name == "sendMessageBatch" {
+				return true
+			}
+		}
+		return false
+	}, time.Second*5, time.Millisecond*10)
+}
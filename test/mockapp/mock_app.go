@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,7 @@ const BadCredential = "bad-credential"
 
 const (
 	MockMethodConnect         = "connect"
+	MockMethodConnected       = "connected"
 	MockMethodDisconnected    = "disconnected"
 	MockMethodMessageReceived = "messageReceived"
 )
@@ -34,11 +36,44 @@ type MockApp interface {
 	On(methodName string, connId wsproxy.ConnectionID, arguments ...any)
 	ExpectConnDisconn(connId wsproxy.ConnectionID)
 	GetCalls(connId wsproxy.ConnectionID) []mock.Call
+	GetConnectRequest(connId wsproxy.ConnectionID) *ConnectRequest
+	GetLastMessageHeader(connId wsproxy.ConnectionID) http.Header
+	GetDisconnectReason(connId wsproxy.ConnectionID) string
+	SetConnectResponse(connId wsproxy.ConnectionID, body any)
+	SetConnectRejection(connId wsproxy.ConnectionID, statusCode int, header http.Header, body any)
+	SetMessageResponse(connId wsproxy.ConnectionID, statusCode int, body any)
+	SetMessageDelay(connId wsproxy.ConnectionID, delay time.Duration)
+	SetPresenceDelay(delay time.Duration)
+	GetMessageBatchCount() int
+	PresenceChanges() <-chan PresenceChange
 	OnDisconnect(connectionId wsproxy.ConnectionID) chan struct{}
 }
 
 type MessageJSON map[string]string
 
+type mockResponse struct {
+	statusCode int
+	body       any
+}
+
+type connectRejection struct {
+	statusCode int
+	header     http.Header
+	body       any
+}
+
+// PresenceChange is a presence change the app was notified of
+type PresenceChange struct {
+	UserID string `json:"userId"`
+	Online bool   `json:"online"`
+}
+
+// ConnectRequest holds what the app received of a connection request
+type ConnectRequest struct {
+	Header http.Header
+	Query  url.Values
+}
+
 type MyMock struct {
 	disconnectNotification chan struct{}
 	mock.Mock
@@ -52,6 +87,10 @@ func (m *MyMock) connect() {
 	m.Called()
 }
 
+func (m *MyMock) connected(userId string, tenantId string) {
+	m.Called(userId, tenantId)
+}
+
 func (m *MyMock) disconnected() {
 	m.Called()
 	m.disconnectNotification <- struct{}{}
@@ -69,13 +108,41 @@ type mockApplication struct {
 	logger        zerolog.Logger
 	connMocks     map[string]*MyMock
 	connMocksMux  sync.Mutex
+	// connectRequests holds the connection requests received by connection-id
+	connectRequests map[string]*ConnectRequest
+	// connectResponses holds the JSON bodies to respond the connection requests with by connection-id
+	connectResponses map[string]any
+	// connectRejections holds the rejections to respond the connection requests with by connection-id
+	connectRejections map[string]connectRejection
+	// messageResponses holds the responses to the messages received by connection-id
+	messageResponses map[string]mockResponse
+	// messageDelays holds how long processing the messages takes by connection-id
+	messageDelays map[string]time.Duration
+	// messageBatchCount is the number of message batches received
+	messageBatchCount int
+	// lastMessageHeaders holds the headers of the last message received by connection-id
+	lastMessageHeaders map[string]http.Header
+	// disconnectReasons holds the reasons of the disconnections received by connection-id
+	disconnectReasons map[string]string
+	// presenceChanges receives the presence changes notified
+	presenceChanges chan PresenceChange
+	// presenceDelay is how long processing the presence changes takes
+	presenceDelay time.Duration
 }
 
 func NewMockApp(getWsproxyUrl func() string) MockApp {
 	return &mockApplication{
-		getWsproxyUrl: getWsproxyUrl,
-		logger:        logging.Get().With().Str("unit", "mockApplication").Logger(),
-		connMocks:     make(map[string]*MyMock),
+		getWsproxyUrl:      getWsproxyUrl,
+		logger:             logging.Get().With().Str("unit", "mockApplication").Logger(),
+		connMocks:          make(map[string]*MyMock),
+		connectRequests:    make(map[string]*ConnectRequest),
+		connectResponses:   make(map[string]any),
+		connectRejections:  make(map[string]connectRejection),
+		lastMessageHeaders: make(map[string]http.Header),
+		disconnectReasons:  make(map[string]string),
+		messageResponses:   make(map[string]mockResponse),
+		messageDelays:      make(map[string]time.Duration),
+		presenceChanges:    make(chan PresenceChange, 64),
 	}
 }
 
@@ -140,6 +207,20 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 			m.connMocksMux.Lock()
 			defer m.connMocksMux.Unlock()
 
+			m.connectRequests[connId] = &ConnectRequest{Header: req.Header.Clone(), Query: req.URL.Query()}
+
+			if rejection, ok := m.connectRejections[connId]; ok {
+				for name, values := range rejection.header {
+					res.Writer.Header()[name] = values
+				}
+				if rejection.body != nil {
+					res.AbortWithStatusJSON(rejection.statusCode, rejection.body)
+					return
+				}
+				res.AbortWithStatus(rejection.statusCode)
+				return
+			}
+
 			_, ok := m.connMocks[connId]
 			if !ok {
 				logger.Info().Str(wsproxy.ConnectionIDKey, connId).Msg("No mock for connection yet, creating...")
@@ -148,11 +229,34 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 				return
 			}
 			m.connMocks[connId].connect()
+
+			if body, ok := m.connectResponses[connId]; ok {
+				res.JSON(200, body)
+				return
+			}
 		}
 
 		res.Status(200)
 	})
 
+	ws.POST(string(wsproxy.ConnectedPath), func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "WS connected handler").Logger()
+		req := g.Request
+		res := g
+
+		connHeaderKey := wsproxy.ConnectionIDHeaderKey
+		if connId := req.Header.Get(connHeaderKey); connId != "" {
+			m.connMocksMux.Lock()
+			defer m.connMocksMux.Unlock()
+			if _, ok := m.connMocks[connId]; !ok {
+				logger.Error().Str(wsproxy.ConnectionIDKey, connId).Msg("connection not mocked")
+				res.Status(500)
+				return
+			}
+			m.connMocks[connId].connected(req.Header.Get(wsproxy.UserIDHeaderKey), req.Header.Get(wsproxy.TenantIDHeaderKey))
+		}
+	})
+
 	ws.POST(string(wsproxy.DisonnectedPath), func(g *gin.Context) {
 		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "WS disconnection handler").Logger()
 		req := g.Request
@@ -167,6 +271,7 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 				res.Status(500)
 				return
 			}
+			m.disconnectReasons[connId] = req.Header.Get(wsproxy.DisconnectReasonHeaderKey)
 			m.connMocks[connId].disconnected()
 		}
 	})
@@ -185,6 +290,10 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 				return
 			}
 
+			if delay := m.getMessageDelay(connId); delay > 0 {
+				time.Sleep(delay)
+			}
+
 			m.connMocksMux.Lock()
 			defer m.connMocksMux.Unlock()
 			if _, ok := m.connMocks[connId]; !ok {
@@ -192,8 +301,80 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 				res.Status(500)
 				return
 			}
+			m.lastMessageHeaders[connId] = req.Header.Clone()
 			m.connMocks[connId].messageReceived(parseMessageJSON(bodyAsBytes))
+
+			if response, ok := m.messageResponses[connId]; ok {
+				res.JSON(response.statusCode, response.body)
+			}
+		}
+	})
+
+	ws.POST(string(wsproxy.MessagesPath), func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("method", "WS message batch handler").Logger()
+
+		var batch []struct {
+			ConnectionID  string          `json:"connectionId"`
+			UserID        string          `json:"userId"`
+			TenantID      string          `json:"tenantId"`
+			Metadata      json.RawMessage `json:"metadata"`
+			CorrelationID string          `json:"correlationId"`
+			Message       json.RawMessage `json:"message"`
+		}
+		if bindErr := g.ShouldBindJSON(&batch); bindErr != nil {
+			logger.Error().Err(bindErr).Send()
+			g.Status(400)
+			return
+		}
+
+		var delay time.Duration
+		for _, entry := range batch {
+			delay = max(delay, m.getMessageDelay(entry.ConnectionID))
+		}
+		time.Sleep(delay)
+
+		m.connMocksMux.Lock()
+		defer m.connMocksMux.Unlock()
+		m.messageBatchCount++
+
+		results := make([]map[string]any, len(batch))
+		for index, entry := range batch {
+			results[index] = map[string]any{"status": 200}
+			if _, ok := m.connMocks[entry.ConnectionID]; !ok {
+				logger.Error().Str(wsproxy.ConnectionIDKey, entry.ConnectionID).Msg("connection not mocked")
+				results[index] = map[string]any{"status": 500}
+				continue
+			}
+			// What the app would have received of the message had it been sent alone
+			header := http.Header{}
+			header.Set(wsproxy.ConnectionIDHeaderKey, entry.ConnectionID)
+			header.Set(wsproxy.UserIDHeaderKey, entry.UserID)
+			header.Set(wsproxy.TenantIDHeaderKey, entry.TenantID)
+			header.Set(wsproxy.MetadataHeaderKey, string(entry.Metadata))
+			header.Set(wsproxy.CorrelationIDHeaderKey, entry.CorrelationID)
+			header.Set("traceparent", g.Request.Header.Get("traceparent"))
+			m.lastMessageHeaders[entry.ConnectionID] = header
+			m.connMocks[entry.ConnectionID].messageReceived(parseMessageJSON(entry.Message))
+
+			if response, ok := m.messageResponses[entry.ConnectionID]; ok {
+				results[index] = map[string]any{"status": response.statusCode, "body": response.body}
+			}
 		}
+		g.JSON(200, results)
+	})
+
+	ws.POST(string(wsproxy.PresencePath), func(g *gin.Context) {
+		change := PresenceChange{}
+		if bindErr := g.ShouldBindJSON(&change); bindErr != nil {
+			g.Status(400)
+			return
+		}
+		m.connMocksMux.Lock()
+		delay := m.presenceDelay
+		m.connMocksMux.Unlock()
+		time.Sleep(delay)
+		m.presenceChanges <- change
+		g.Status(200)
 	})
 
 	return rootEngine, nil
@@ -226,6 +407,75 @@ func (m *mockApplication) GetCalls(connId wsproxy.ConnectionID) []mock.Call {
 	return m.connMocks[string(connId)].Calls
 }
 
+func (m *mockApplication) GetConnectRequest(connId wsproxy.ConnectionID) *ConnectRequest {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	return m.connectRequests[string(connId)]
+}
+
+func (m *mockApplication) GetDisconnectReason(connId wsproxy.ConnectionID) string {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	return m.disconnectReasons[string(connId)]
+}
+
+func (m *mockApplication) GetLastMessageHeader(connId wsproxy.ConnectionID) http.Header {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	return m.lastMessageHeaders[string(connId)]
+}
+
+// SetConnectResponse makes the app respond the request for the connection with the JSON body
+func (m *mockApplication) SetConnectResponse(connId wsproxy.ConnectionID, body any) {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	m.connectResponses[string(connId)] = body
+}
+
+// SetConnectRejection makes the app reject the request for the connection with the status, headers and JSON body
+func (m *mockApplication) SetConnectRejection(connId wsproxy.ConnectionID, statusCode int, header http.Header, body any) {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	m.connectRejections[string(connId)] = connectRejection{statusCode: statusCode, header: header, body: body}
+}
+
+// SetMessageResponse makes the app respond the messages received over the connection with the status and JSON body
+func (m *mockApplication) SetMessageResponse(connId wsproxy.ConnectionID, statusCode int, body any) {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	m.messageResponses[string(connId)] = mockResponse{statusCode: statusCode, body: body}
+}
+
+// SetMessageDelay makes processing the messages received over the connection take the specified time
+func (m *mockApplication) SetMessageDelay(connId wsproxy.ConnectionID, delay time.Duration) {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	m.messageDelays[string(connId)] = delay
+}
+
+// SetPresenceDelay makes processing the presence changes take the specified time
+func (m *mockApplication) SetPresenceDelay(delay time.Duration) {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	m.presenceDelay = delay
+}
+
+func (m *mockApplication) getMessageDelay(connId string) time.Duration {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	return m.messageDelays[connId]
+}
+
+func (m *mockApplication) GetMessageBatchCount() int {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	return m.messageBatchCount
+}
+
+func (m *mockApplication) PresenceChanges() <-chan PresenceChange {
+	return m.presenceChanges
+}
+
 func (s *mockApplication) SendToClient(connId wsproxy.ConnectionID, message MessageJSON) error {
 	url := fmt.Sprintf("%s%s/%s", s.getWsproxyUrl(), wsproxy.MessagePath, connId)
 	req, createReqErr := http.NewRequest(http.MethodPost, url, strings.NewReader(message["message"]))